@@ -0,0 +1,145 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+var (
+	enableAccessorsTypeMarker = markers.Must(markers.MakeDefinition("accessors:generate", markers.DescribesType, false))
+
+	skipAccessorsFieldMarker = markers.Must(markers.MakeDefinition("accessors:skip", markers.DescribesField, struct{}{}))
+	nameAccessorsFieldMarker = markers.Must(markers.MakeDefinition("accessors:name", markers.DescribesField, ""))
+)
+
+func init() {
+	registerGenerator("accessors", AccessorsGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// AccessorsGenerator generates getter and setter methods for struct fields.
+type AccessorsGenerator struct{}
+
+func (AccessorsGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableAccessorsTypeMarker, skipAccessorsFieldMarker, nameAccessorsFieldMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableAccessorsTypeMarker,
+		markers.SimpleHelp("object", "enables or disables getter and setter generation for this type"),
+	)
+	into.AddHelp(
+		skipAccessorsFieldMarker,
+		markers.SimpleHelp("object", "disables getter and setter generation for this field"),
+	)
+	into.AddHelp(
+		nameAccessorsFieldMarker,
+		markers.SimpleHelp("object", "overrides the name used in the getter and setter of this field (Get<name> and Set<name>)"),
+	)
+
+	return nil
+}
+
+func (AccessorsGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableAccessorsTypeMarker, "zz_generated.accessors.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		for _, s := range structs {
+			if err := generateAccessors(code, root, s.Info, s.Type, s.Struct); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+	})
+}
+
+// generateAccessors generates the getters and setters of the fields of the
+// given struct. The returned errors are diagnostics.
+func generateAccessors(code *jen.File, pkg *loader.Package, info *markers.TypeInfo, typeInfo types.Type, stype *types.Struct) error {
+	var accessors []jen.Code
+	generated := make(map[string]string)
+
+	for i := 0; i < stype.NumFields(); i++ {
+		field := stype.Field(i)
+
+		if field.Name() == "_" {
+			continue
+		}
+
+		name := strings.ToUpper(field.Name()[:1]) + field.Name()[1:]
+
+		if i < len(info.Fields) {
+			fieldMarkers := info.Fields[i].Markers
+
+			if fieldMarkers.Get(skipAccessorsFieldMarker.Name) != nil {
+				continue
+			}
+
+			if rename, isRenamed := fieldMarkers.Get(nameAccessorsFieldMarker.Name).(string); isRenamed {
+				if !token.IsIdentifier(rename) {
+					return newDiagnostic(codeInvalidMarker, nameAccessorsFieldMarker, "", "invalid accessor name %q of field %s", rename, field.Name())
+				}
+
+				name = strings.ToUpper(rename[:1]) + rename[1:]
+			}
+		}
+
+		getter, setter := "Get"+name, "Set"+name
+
+		for _, method := range []string{getter, setter} {
+			if other, exists := generated[method]; exists {
+				return newDiagnostic(codeCollision, nameAccessorsFieldMarker, "rename one of them",
+					"%s of field %s is already generated for field %s", method, field.Name(), other)
+			}
+			generated[method] = field.Name()
+
+			// promoted fields and methods are simply shadowed by the generated ones
+			if _, ind, _ := types.LookupFieldOrMethod(typeInfo, true, pkg.Types, method); len(ind) == 1 {
+				return newDiagnostic(codeCollision, nameAccessorsFieldMarker, "rename the accessors of the field",
+					"%s of field %s collides with an existing field or method", method, field.Name())
+			}
+		}
+
+		accessors = append(accessors,
+			jen.Commentf("%s returns the %s field of o.", getter, field.Name()).Line().
+				Func().
+				Params(jen.Id("o").Op("*").Id(info.Name)).
+				Id(getter).
+				Params().
+				Params(typeCode(pkg, field.Type())).
+				Block(jen.Return(jen.Id("o").Dot(field.Name()))),
+
+			jen.Commentf("%s sets the %s field of o.", setter, field.Name()).Line().
+				Func().
+				Params(jen.Id("o").Op("*").Id(info.Name)).
+				Id(setter).
+				Params(jen.Id("value").Add(typeCode(pkg, field.Type()))).
+				Block(jen.Id("o").Dot(field.Name()).Op("=").Id("value")),
+		)
+	}
+
+	for _, accessor := range accessors {
+		code.Add(accessor)
+	}
+
+	return nil
+}
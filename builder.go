@@ -0,0 +1,103 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+var (
+	enableBuilderTypeMarker = markers.Must(markers.MakeDefinition("builder:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("builder", BuilderGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// BuilderGenerator generates fluent builder types for structs.
+type BuilderGenerator struct{}
+
+func (BuilderGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableBuilderTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableBuilderTypeMarker,
+		markers.SimpleHelp("object", "enables or disables builder generation for this type"),
+	)
+
+	return nil
+}
+
+func (BuilderGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableBuilderTypeMarker, "zz_generated.builder.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		for _, s := range structs {
+			generateBuilder(code, root, s.Info.Name, s.Struct)
+		}
+	})
+}
+
+// generateBuilder generates the builder type of the given struct.
+func generateBuilder(code *jen.File, pkg *loader.Package, name string, stype *types.Struct) {
+	builderName := name + "Builder"
+
+	code.Commentf("%s builds %s values.", builderName, name)
+	code.Type().Id(builderName).Struct(
+		jen.Id("value").Id(name),
+	)
+
+	code.Commentf("New%s returns a new builder with a zero %s value.", builderName, name)
+	code.Func().
+		Id("New" + builderName).
+		Params().
+		Params(jen.Op("*").Id(builderName)).
+		Block(jen.Return(jen.Op("&").Id(builderName).Values()))
+
+	for i := 0; i < stype.NumFields(); i++ {
+		field := stype.Field(i)
+
+		// unexported fields can't be set by the users of the builder anyway
+		if !field.Exported() {
+			continue
+		}
+
+		code.Commentf("With%s sets the %s field of the built value.", field.Name(), field.Name())
+		code.Func().
+			Params(jen.Id("b").Op("*").Id(builderName)).
+			Id("With"+field.Name()).
+			Params(jen.Id("value").Add(typeCode(pkg, field.Type()))).
+			Params(jen.Op("*").Id(builderName)).
+			Block(
+				jen.Id("b").Dot("value").Dot(field.Name()).Op("=").Id("value"),
+				jen.Return(jen.Id("b")),
+			)
+	}
+
+	code.Commentf("Build returns the built %s value.", name)
+	code.Func().
+		Params(jen.Id("b").Op("*").Id(builderName)).
+		Id("Build").
+		Params().
+		Params(jen.Id(name)).
+		Block(jen.Return(jen.Id("b").Dot("value")))
+}
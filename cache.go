@@ -0,0 +1,223 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+	"sigs.k8s.io/yaml"
+)
+
+// copyCache stores the hashes of the inputs of the last successful generation,
+// and the files it output, by package import path.
+type copyCache struct {
+	Packages map[string]string `json:"packages"`
+	// Files are the item paths of the files output for each package, the
+	// packages are generated again if any of them is missing.
+	Files map[string][]string `json:"files"`
+}
+
+// loadCopyCache reads the given cache file, returning an empty cache if it doesn't exist yet.
+func loadCopyCache(ctx *genall.GenerationContext, path string) (copyCache, error) {
+	cache := copyCache{Packages: map[string]string{}, Files: map[string][]string{}}
+
+	cacheBytes, err := ctx.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return copyCache{}, err
+	}
+
+	if err := yaml.UnmarshalStrict(cacheBytes, &cache); err != nil {
+		return copyCache{}, fmt.Errorf("invalid cache file %s (remove it to regenerate everything): %w", path, err)
+	}
+
+	if cache.Packages == nil {
+		cache.Packages = map[string]string{}
+	}
+	if cache.Files == nil {
+		cache.Files = map[string][]string{}
+	}
+
+	return cache, nil
+}
+
+// saveCopyCache writes the given cache to the cache file.
+//
+// It isn't an artifact of the generation, so it's written directly instead of using the output rules.
+func saveCopyCache(path string, cache copyCache) error {
+	cacheBytes, err := yaml.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, cacheBytes, 0644)
+}
+
+// upToDate checks if the generation of the given package can be skipped: its
+// inputs hash to the cached hash, and the files output for it are still there.
+func (c copyCache) upToDate(rule genall.OutputRule, root *loader.Package, hash string) bool {
+	files, known := c.Files[root.PkgPath]
+	if c.Packages[root.PkgPath] != hash || !known {
+		return false
+	}
+
+	outDir := outputDir(rule, root)
+	if outDir == "" {
+		return false
+	}
+
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(file))); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// recordedOutput records the item paths of the files output for each package.
+//
+// The files of each package are output one after another (see processRoots),
+// so it isn't safe for concurrent use.
+type recordedOutput struct {
+	genall.OutputRule
+
+	files map[*loader.Package][]string
+}
+
+func (o recordedOutput) Open(pkg *loader.Package, itemPath string) (io.WriteCloser, error) {
+	if pkg != nil {
+		o.files[pkg] = append(o.files[pkg], filepath.ToSlash(itemPath))
+	}
+
+	return o.OutputRule.Open(pkg, itemPath)
+}
+
+// packageInputHash hashes everything the code generated for the given package
+// depends on: its source files, the source files of the packages it imports
+// (directly or not, e.g. declaring its external types, the structs of deep
+// copied fields, or implemented interfaces), which of the markers of the other
+// generators are registered, the given options, and the generator itself.
+//
+// The standard library only changes with the Go version, so it's left out.
+// Only the package syntax is needed, so that unchanged packages don't have to be type-checked.
+func packageInputHash(col *markers.Collector, root *loader.Package, options ...string) (string, error) {
+	hash := sha256.New()
+
+	// a different build of the generator may generate different code
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(hash, "generator %s\n", buildInfo.Main.Version)
+		for _, setting := range buildInfo.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+				fmt.Fprintf(hash, "%s %s\n", setting.Key, setting.Value)
+			}
+		}
+	}
+
+	for _, option := range options {
+		fmt.Fprintf(hash, "option %q\n", option)
+	}
+
+	// the markers of the other generators are only collected if they run too
+	for _, marker := range []*markers.Definition{enableDeepCopyTypeMarker, enableEqualTypeMarker, enableValidateTypeMarker} {
+		fmt.Fprintf(hash, "marker %s %t\n", marker.Name, col.Registry.Lookup("+"+marker.Name, marker.Target) != nil)
+	}
+
+	if err := hashFiles(hash, root.CompiledGoFiles); err != nil {
+		return "", err
+	}
+
+	imported := make(map[string]*loader.Package)
+	addImports(root, imported)
+
+	for _, pkgPath := range sortedKeys(imported) {
+		fmt.Fprintf(hash, "import %s\n", pkgPath)
+
+		if err := hashFiles(hash, imported[pkgPath].CompiledGoFiles); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// addImports adds the packages imported by the given one (directly or not) to
+// imported, by import path, except for the ones of the standard library.
+func addImports(pkg *loader.Package, imported map[string]*loader.Package) {
+	for pkgPath, imp := range pkg.Imports() {
+		if _, seen := imported[pkgPath]; seen || inGoRoot(imp) {
+			continue
+		}
+
+		imported[pkgPath] = imp
+		addImports(imp, imported)
+	}
+}
+
+// inGoRoot checks if the given package is part of the standard library.
+func inGoRoot(pkg *loader.Package) bool {
+	if len(pkg.GoFiles) == 0 {
+		// there's only the builtin unsafe package without files
+		return true
+	}
+
+	return strings.HasPrefix(pkg.GoFiles[0], filepath.Join(build.Default.GOROOT, "src")+string(filepath.Separator))
+}
+
+// hashFiles adds the names and contents of the given files to the hash.
+func hashFiles(hash io.Writer, files []string) error {
+	files = append([]string(nil), files...)
+	sort.Strings(files)
+
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(hash, "file %s %d\n", filepath.Base(file), len(contents))
+		if _, err := hash.Write(contents); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keepsOutput checks if the given output rule writes files that are kept between
+// runs, which skipping unchanged packages relies on (e.g. verifying or printing
+// the generated code has to generate it for every package).
+func keepsOutput(rule genall.OutputRule) bool {
+	switch rule.(type) {
+	case genall.OutputToDirectory, genall.OutputArtifacts, OutputToBase:
+		return true
+	default:
+		return false
+	}
+}
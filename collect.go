@@ -0,0 +1,127 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"regexp"
+	"sort"
+
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// typeFilter restricts generation to the types with matching names (when not nil).
+var typeFilter *regexp.Regexp
+
+// typeSelected checks if code should be generated for the type with the given name.
+func typeSelected(name string) bool {
+	return typeFilter == nil || typeFilter.MatchString(name)
+}
+
+// checkTypes type-checks the given package, loading the packages referenced
+// by its type declarations first.
+//
+// Interfaces are checked as well (the mock generator needs their methods), the
+// types only referenced by unchecked declarations would be silently invalid.
+func checkTypes(ctx *genall.GenerationContext, root *loader.Package) {
+	ctx.Checker.Check(root, func(ast.Node) bool { return true })
+
+	root.NeedTypesInfo()
+}
+
+// markedTypes type-checks the given package, and returns the exported types
+// that have the given type marker enabled (see markerEnabledOnType), warning
+// about the unexported ones.
+func markedTypes(ctx *genall.GenerationContext, root *loader.Package, enableMarker *markers.Definition) ([]*markers.TypeInfo, error) {
+	startPackage(root)
+	checkTypes(ctx, root)
+
+	var infos []*markers.TypeInfo
+
+	if err := markers.EachType(ctx.Collector, root, func(info *markers.TypeInfo) {
+		enabled, err := markerEnabledOnType(info, enableMarker)
+		if err != nil {
+			report(root, info.RawSpec, newDiagnostic(codeInvalidMarker, enableMarker, "", "%v", err))
+
+			return
+		}
+
+		if !enabled || !typeSelected(info.Name) {
+			return
+		}
+
+		matchType(root, enableMarker.Name, info.Name)
+
+		if !ast.IsExported(info.Name) {
+			warn(root, info.RawSpec, newDiagnostic(codeUnexportedType, enableMarker, "export it, or remove the marker",
+				"%s is unexported, nothing is generated for it", info.Name))
+
+			return
+		}
+
+		infos = append(infos, info)
+	}); err != nil {
+		return nil, err
+	}
+
+	// the order of types doesn't depend on how they're spread across files
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos, nil
+}
+
+// markedTypeNames returns the names of the exported types of the given package
+// marked with the given type marker, without type-checking it.
+//
+// It's used to find out which types another generator generates methods for
+// in the same run: their markers are only registered if it's run as well.
+func markedTypeNames(col *markers.Collector, root *loader.Package, enableMarker *markers.Definition) (map[string]bool, error) {
+	names := make(map[string]bool)
+
+	if err := markers.EachType(col, root, func(info *markers.TypeInfo) {
+		enabled, err := markerEnabledOnType(info, enableMarker)
+		if err == nil && enabled && ast.IsExported(info.Name) && typeSelected(info.Name) {
+			names[info.Name] = true
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// reportGeneric reports the given type as unsupported by the generator of the
+// given marker if it's generic, returning whether it is.
+//
+// Only shallowcopy renders the type parameters of the types it generates code
+// for, the other generators refer to types by their bare names.
+func reportGeneric(root *loader.Package, info *markers.TypeInfo, typeInfo types.Type, enableMarker *markers.Definition) bool {
+	named, isNamed := typeInfo.(*types.Named)
+	if !isNamed || named.TypeParams().Len() == 0 {
+		return false
+	}
+
+	report(root, info.RawSpec, newDiagnostic(codeUnsupportedType, enableMarker,
+		fmt.Sprintf("mark a type instantiating it instead (e.g. type Int%[1]s %[1]s[int])", info.Name),
+		"generic type %s is not supported", info.Name))
+
+	return true
+}
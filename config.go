@@ -0,0 +1,74 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/yaml"
+)
+
+// copyConfig lists types to generate shallowcopy methods for without marking
+// them in the source (e.g. because they're vendored), by package.
+//
+// For example:
+//
+//	packages:
+//	- path: github.com/org/repo/pkg
+//	  types:
+//	  - Foo
+//	  - Bar
+type copyConfig struct {
+	Packages []packageConfig `json:"packages"`
+}
+
+// packageConfig lists the types of a single package.
+type packageConfig struct {
+	// Path is the import path of the package.
+	Path string `json:"path"`
+	// Types are the names of the types in the package.
+	Types []string `json:"types"`
+}
+
+// loadCopyConfig reads the given config file, returning the configured type
+// names by package import path.
+func loadCopyConfig(ctx *genall.GenerationContext, path string) (map[string]map[string]bool, error) {
+	configBytes, err := ctx.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config copyConfig
+	if err := yaml.UnmarshalStrict(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	configured := make(map[string]map[string]bool, len(config.Packages))
+	for _, pkg := range config.Packages {
+		if pkg.Path == "" {
+			return nil, fmt.Errorf("invalid config file %s: package without a path", path)
+		}
+
+		if configured[pkg.Path] == nil {
+			configured[pkg.Path] = make(map[string]bool, len(pkg.Types))
+		}
+		for _, name := range pkg.Types {
+			configured[pkg.Path][name] = true
+		}
+	}
+
+	return configured, nil
+}
@@ -0,0 +1,509 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+const (
+	convertToMethod   = "ConvertTo"
+	convertFromMethod = "ConvertFrom"
+)
+
+var (
+	convertToTypeMarker     = markers.Must(markers.MakeDefinition("convert:generate:to", markers.DescribesType, ""))
+	convertIgnoreTypeMarker = markers.Must(markers.MakeDefinition("convert:generate:ignore", markers.DescribesType, []string(nil)))
+)
+
+func init() {
+	registerGenerator("convert", ConvertGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// ConvertGenerator generates code containing ConvertTo and ConvertFrom method
+// implementations, converting structs to (and from) other versions of them
+// (e.g. v1alpha1 and v1 API types) field by field.
+//
+// Fields are matched by name, fields without a counterpart in the other type
+// are errors (unless ignored). Values of identical types are assigned, other
+// types are converted if their underlying types are identical, or using their
+// ConvertTo and ConvertFrom methods (e.g. generated in the same run), and
+// pointers, slices, maps and arrays of those are converted element by element.
+type ConvertGenerator struct{}
+
+func (ConvertGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, convertToTypeMarker, convertIgnoreTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		convertToTypeMarker,
+		markers.SimpleHelp("object", "sets the type to generate conversions to and from, as <package path or name>.<type> (or just <type> in the same package)"),
+	)
+	into.AddHelp(
+		convertIgnoreTypeMarker,
+		markers.SimpleHelp("object", "lists the fields (of either type) left out of the conversions"),
+	)
+
+	return nil
+}
+
+func (ConvertGenerator) Generate(ctx *genall.GenerationContext) error {
+	for _, root := range ctx.Roots {
+		structs, err := markedStructs(ctx, root, convertToTypeMarker)
+		if err != nil {
+			root.AddError(err)
+			return nil
+		}
+
+		if len(structs) == 0 {
+			continue
+		}
+
+		c := &converter{pkg: root, targets: make(map[string]*types.Named, len(structs))}
+
+		resolved := make([]*types.Named, len(structs))
+		for i, s := range structs {
+			target, err := stringMarkerOnType(s.Info, convertToTypeMarker)
+			if err == nil {
+				resolved[i], err = resolveConvertTarget(ctx, root, target)
+			}
+			if err != nil {
+				report(root, s.Info.RawSpec, newDiagnostic(codeInvalidMarker, convertToTypeMarker, "", "%s: %v", s.Info.Name, err))
+
+				continue
+			}
+
+			c.targets[s.Info.Name] = resolved[i]
+		}
+
+		code := jen.NewFile(root.Name)
+
+		for i, s := range structs {
+			if resolved[i] == nil {
+				continue
+			}
+
+			if err := c.generate(code, s, resolved[i]); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+
+		renderOut(ctx, root, code, "zz_generated.convert.go", "")
+	}
+
+	return nil
+}
+
+// resolveConvertTarget resolves the type to convert to (as given by the
+// convert:generate:to marker) among the package itself, its imports and the
+// packages included in the paths.
+func resolveConvertTarget(ctx *genall.GenerationContext, root *loader.Package, target string) (*types.Named, error) {
+	pkg := root.Types
+	typeName := target
+
+	if dot := strings.LastIndex(target, "."); dot >= 0 {
+		pkgName, candidates := target[:dot], make(map[string]*types.Package)
+
+		for _, imported := range root.Types.Imports() {
+			candidates[imported.Path()] = imported
+		}
+		for _, other := range ctx.Roots {
+			other.NeedTypesInfo()
+			candidates[other.PkgPath] = other.Types
+		}
+
+		pkg = candidates[pkgName]
+		if pkg == nil {
+			// packages can be referred to by their name as well, if it's unambiguous
+			for _, candidate := range candidates {
+				if candidate.Name() != pkgName {
+					continue
+				}
+
+				if pkg != nil {
+					return nil, fmt.Errorf("package name %s of %s is ambiguous, use the import path instead", pkgName, target)
+				}
+
+				pkg = candidate
+			}
+		}
+
+		if pkg == nil {
+			return nil, fmt.Errorf("package %s of %s has to be imported by %s or included in the paths", pkgName, target, root.PkgPath)
+		}
+
+		typeName = target[dot+1:]
+	}
+
+	typeObj, isType := pkg.Scope().Lookup(typeName).(*types.TypeName)
+	if !isType || (pkg != root.Types && !typeObj.Exported()) {
+		return nil, fmt.Errorf("%s is not an accessible type", target)
+	}
+
+	named, isNamed := typeObj.Type().(*types.Named)
+	if !isNamed || named.TypeParams().Len() > 0 {
+		return nil, fmt.Errorf("%s is not a named non-generic type", target)
+	}
+
+	if _, isStruct := named.Underlying().(*types.Struct); !isStruct {
+		return nil, fmt.Errorf("%s is not a struct type", target)
+	}
+
+	if pkg != root.Types && importsPackage(pkg, root.Types, make(map[*types.Package]bool)) {
+		return nil, fmt.Errorf("package %s of %s imports %s, converting to it would create an import cycle", pkg.Path(), target, root.PkgPath)
+	}
+
+	return named, nil
+}
+
+// importsPackage checks if pkg imports the other package, directly or indirectly.
+func importsPackage(pkg, other *types.Package, visited map[*types.Package]bool) bool {
+	if visited[pkg] {
+		return false
+	}
+	visited[pkg] = true
+
+	for _, imported := range pkg.Imports() {
+		if imported.Path() == other.Path() || importsPackage(imported, other, visited) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// converter emits the statements converting values between the marked types
+// and the types they are converted to.
+type converter struct {
+	pkg *loader.Package
+	// targets are the types conversions are generated to, by the name of the marked type.
+	targets map[string]*types.Named
+}
+
+// generate generates the ConvertTo and ConvertFrom methods of the given
+// struct. The returned errors are diagnostics.
+func (c *converter) generate(code *jen.File, s markedStruct, target *types.Named) error {
+	for _, method := range []string{convertToMethod, convertFromMethod} {
+		if _, ind, _ := types.LookupFieldOrMethod(s.Type, true, c.pkg.Types, method); len(ind) == 1 {
+			return newDiagnostic(codeCollision, convertToTypeMarker, "rename it", "%s collides with an existing field or method", method)
+		}
+	}
+
+	targetStruct := target.Underlying().(*types.Struct)
+	targetName := c.typeString(target)
+
+	// unexported fields of other packages can't be converted
+	accessible := func(field *types.Var) bool {
+		return field.Name() != "_" && (field.Exported() || field.Pkg() == c.pkg.Types)
+	}
+
+	ignored := make(map[string]bool)
+	if values, isSet := s.Info.Markers.Get(convertIgnoreTypeMarker.Name).([]string); isSet {
+		for _, name := range values {
+			ignored[name] = true
+		}
+	}
+
+	targetFields := make(map[string]*types.Var, targetStruct.NumFields())
+	for i := 0; i < targetStruct.NumFields(); i++ {
+		if field := targetStruct.Field(i); accessible(field) {
+			targetFields[field.Name()] = field
+		}
+	}
+
+	var toBody, fromBody []jen.Code
+	var unmatched []string
+	matched := make(map[string]bool)
+
+	for i := 0; i < s.Struct.NumFields(); i++ {
+		field := s.Struct.Field(i)
+
+		if field.Name() == "_" || ignored[field.Name()] {
+			continue
+		}
+
+		targetField, exists := targetFields[field.Name()]
+		if !exists || !accessible(field) {
+			unmatched = append(unmatched, field.Name())
+
+			continue
+		}
+		matched[field.Name()] = true
+
+		ours := func(v string) func() *jen.Statement {
+			return func() *jen.Statement { return jen.Id(v).Dot(field.Name()) }
+		}
+
+		to, err := c.convert(ours("out"), ours("o"), targetField.Type(), field.Type(), true, 0)
+		if err != nil {
+			return newDiagnostic(codeUnsupportedType, nil, fmt.Sprintf("ignore it with +%s", convertIgnoreTypeMarker.Name), "field %s: %v", field.Name(), err)
+		}
+
+		from, err := c.convert(ours("o"), ours("in"), field.Type(), targetField.Type(), false, 0)
+		if err != nil {
+			return newDiagnostic(codeUnsupportedType, nil, fmt.Sprintf("ignore it with +%s", convertIgnoreTypeMarker.Name), "field %s: %v", field.Name(), err)
+		}
+
+		toBody = append(toBody, to...)
+		fromBody = append(fromBody, from...)
+	}
+
+	var unmatchedTarget []string
+	for i := 0; i < targetStruct.NumFields(); i++ {
+		field := targetStruct.Field(i)
+		if accessible(field) && !matched[field.Name()] && !ignored[field.Name()] {
+			unmatchedTarget = append(unmatchedTarget, field.Name())
+		}
+	}
+
+	for name := range ignored {
+		if _, isTargetField := targetFields[name]; isTargetField {
+			continue
+		}
+
+		if obj, _, _ := types.LookupFieldOrMethod(s.Type, false, c.pkg.Types, name); obj == nil {
+			return newDiagnostic(codeInvalidMarker, convertIgnoreTypeMarker, "remove it from the marker",
+				"ignored field %s is a field of neither %s nor %s", name, s.Info.Name, targetName)
+		}
+	}
+
+	var unmatchedFields []string
+	if len(unmatched) > 0 {
+		unmatchedFields = append(unmatchedFields, fmt.Sprintf("%s (of %s)", strings.Join(unmatched, ", "), s.Info.Name))
+	}
+	if len(unmatchedTarget) > 0 {
+		unmatchedFields = append(unmatchedFields, fmt.Sprintf("%s (of %s)", strings.Join(unmatchedTarget, ", "), targetName))
+	}
+	if len(unmatchedFields) > 0 {
+		return newDiagnostic(codeUnsupportedType, nil, fmt.Sprintf("ignore them with +%s if they can't be converted", convertIgnoreTypeMarker.Name),
+			"fields without a counterpart: %s", strings.Join(unmatchedFields, ", "))
+	}
+
+	code.Commentf("%s sets the fields of the given %s from o, leaving its ignored fields as they are.", convertToMethod, targetName)
+	code.Func().
+		Params(jen.Id("o").Id(s.Info.Name)).
+		Id(convertToMethod).
+		Params(jen.Id("out").Op("*").Add(typeCode(c.pkg, target))).
+		Block(toBody...)
+
+	code.Commentf("%s sets the fields of o from the given %s, leaving its ignored fields as they are.", convertFromMethod, targetName)
+	code.Func().
+		Params(jen.Id("o").Op("*").Id(s.Info.Name)).
+		Id(convertFromMethod).
+		Params(jen.Id("in").Add(typeCode(c.pkg, target))).
+		Block(fromBody...)
+
+	return nil
+}
+
+// typeString returns the given type as written in the package (qualified by package names).
+func (c *converter) typeString(t types.Type) string {
+	return types.TypeString(t, func(pkg *types.Package) string {
+		if pkg == c.pkg.Types {
+			return ""
+		}
+
+		return pkg.Name()
+	})
+}
+
+// hasConversion checks if the given type of this package has (or will have)
+// conversion methods to and from the other type.
+func (c *converter) hasConversion(ours, other types.Type) bool {
+	named, isNamed := ours.(*types.Named)
+	if !isNamed || named.Obj().Pkg() != c.pkg.Types {
+		return false
+	}
+
+	if target, isGenerated := c.targets[named.Obj().Name()]; isGenerated {
+		return types.Identical(target, other)
+	}
+
+	// conversions can be implemented manually as well
+	convertTo, _, _ := types.LookupFieldOrMethod(named, true, c.pkg.Types, convertToMethod)
+	convertFrom, _, _ := types.LookupFieldOrMethod(named, true, c.pkg.Types, convertFromMethod)
+	if convertTo == nil || convertFrom == nil {
+		return false
+	}
+
+	toSig, isFunc := convertTo.Type().(*types.Signature)
+	if !isFunc || toSig.Params().Len() != 1 || toSig.Results().Len() != 0 || !types.Identical(toSig.Params().At(0).Type(), types.NewPointer(other)) {
+		return false
+	}
+
+	fromSig, isFunc := convertFrom.Type().(*types.Signature)
+
+	return isFunc && fromSig.Params().Len() == 1 && fromSig.Results().Len() == 0 && types.Identical(fromSig.Params().At(0).Type(), other)
+}
+
+// convert returns the statements setting dst (of type dstType) to the
+// converted src (of type srcType). The types of this package are the ones of
+// src when converting to the target types, and the ones of dst otherwise.
+//
+// The depth is the loop nesting level, used for naming loop variables.
+func (c *converter) convert(dst, src func() *jen.Statement, dstType, srcType types.Type, toTarget bool, depth int) ([]jen.Code, error) {
+	if types.Identical(dstType, srcType) {
+		return []jen.Code{dst().Op("=").Add(src())}, nil
+	}
+
+	if toTarget && c.hasConversion(srcType, dstType) {
+		return []jen.Code{src().Dot(convertToMethod).Call(jen.Op("&").Add(dst()))}, nil
+	}
+
+	if !toTarget && c.hasConversion(dstType, srcType) {
+		return []jen.Code{dst().Dot(convertFromMethod).Call(src())}, nil
+	}
+
+	_, isPointer := dstType.(*types.Pointer)
+	if !isPointer && types.IdenticalIgnoreTags(dstType.Underlying(), srcType.Underlying()) {
+		return []jen.Code{dst().Op("=").Add(typeCode(c.pkg, dstType)).Call(src())}, nil
+	}
+
+	cannotConvert := fmt.Errorf("cannot convert %s to %s", c.typeString(srcType), c.typeString(dstType))
+
+	switch dstUnderlying := dstType.Underlying().(type) {
+	case *types.Pointer:
+		srcPointer, isPointer := srcType.Underlying().(*types.Pointer)
+		if !isPointer {
+			return nil, cannotConvert
+		}
+
+		var elem []jen.Code
+
+		switch dstElem, srcElem := dstUnderlying.Elem(), srcPointer.Elem(); {
+		// the methods are called on the pointers themselves
+		case toTarget && c.hasConversion(srcElem, dstElem):
+			elem = []jen.Code{src().Dot(convertToMethod).Call(dst())}
+		case !toTarget && c.hasConversion(dstElem, srcElem):
+			elem = []jen.Code{dst().Dot(convertFromMethod).Call(jen.Op("*").Add(src()))}
+		default:
+			var err error
+			if elem, err = c.convert(deref(dst, dstElem), deref(src, srcElem), dstElem, srcElem, toTarget, depth); err != nil {
+				return nil, err
+			}
+		}
+
+		return []jen.Code{jen.If(src().Op("==").Nil()).Block(dst().Op("=").Nil()).Else().Block(append([]jen.Code{
+			dst().Op("=").New(typeCode(c.pkg, dstUnderlying.Elem())),
+		}, elem...)...)}, nil
+
+	case *types.Slice:
+		srcSlice, isSlice := srcType.Underlying().(*types.Slice)
+		if !isSlice {
+			return nil, cannotConvert
+		}
+
+		index := loopVar("i", depth)
+
+		elem, err := c.convert(
+			func() *jen.Statement { return dst().Index(jen.Id(index)) },
+			func() *jen.Statement { return src().Index(jen.Id(index)) },
+			dstUnderlying.Elem(), srcSlice.Elem(), toTarget, depth+1,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return []jen.Code{jen.If(src().Op("==").Nil()).Block(dst().Op("=").Nil()).Else().Block(
+			dst().Op("=").Make(typeCode(c.pkg, dstType), jen.Len(src())),
+			jen.For(jen.Id(index).Op(":=").Range().Add(src())).Block(elem...),
+		)}, nil
+
+	case *types.Array:
+		srcArray, isArray := srcType.Underlying().(*types.Array)
+		if !isArray || srcArray.Len() != dstUnderlying.Len() {
+			return nil, cannotConvert
+		}
+
+		index := loopVar("i", depth)
+
+		elem, err := c.convert(
+			func() *jen.Statement { return dst().Index(jen.Id(index)) },
+			func() *jen.Statement { return src().Index(jen.Id(index)) },
+			dstUnderlying.Elem(), srcArray.Elem(), toTarget, depth+1,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return []jen.Code{jen.For(jen.Id(index).Op(":=").Range().Add(src())).Block(elem...)}, nil
+
+	case *types.Map:
+		srcMap, isMap := srcType.Underlying().(*types.Map)
+		if !isMap {
+			return nil, cannotConvert
+		}
+
+		key, val, converted := loopVar("key", depth), loopVar("val", depth), loopVar("converted", depth)
+
+		// keys are only converted by conversions (not methods), so they stay comparable
+		convertedKey := jen.Id(key)
+		if !types.Identical(dstUnderlying.Key(), srcMap.Key()) {
+			if !types.IdenticalIgnoreTags(dstUnderlying.Key().Underlying(), srcMap.Key().Underlying()) {
+				return nil, cannotConvert
+			}
+
+			convertedKey = typeCode(c.pkg, dstUnderlying.Key()).Call(jen.Id(key))
+		}
+
+		// map elements aren't addressable, so they're converted into a variable first
+		elem := []jen.Code{dst().Index(convertedKey).Op("=").Id(val)}
+		if !types.Identical(dstUnderlying.Elem(), srcMap.Elem()) {
+			convertElem, err := c.convert(
+				func() *jen.Statement { return jen.Id(converted) },
+				func() *jen.Statement { return jen.Id(val) },
+				dstUnderlying.Elem(), srcMap.Elem(), toTarget, depth+1,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			elem = append(append([]jen.Code{
+				jen.Var().Id(converted).Add(typeCode(c.pkg, dstUnderlying.Elem())),
+			}, convertElem...),
+				dst().Index(convertedKey).Op("=").Id(converted),
+			)
+		}
+
+		return []jen.Code{jen.If(src().Op("==").Nil()).Block(dst().Op("=").Nil()).Else().Block(
+			dst().Op("=").Make(typeCode(c.pkg, dstType), jen.Len(src())),
+			jen.For(jen.List(jen.Id(key), jen.Id(val)).Op(":=").Range().Add(src())).Block(elem...),
+		)}, nil
+
+	default:
+		return nil, cannotConvert
+	}
+}
+
+// deref returns the value the given pointer (to the given type) points to,
+// in parentheses if it's indexed or converted further.
+func deref(pointer func() *jen.Statement, elem types.Type) func() *jen.Statement {
+	switch elem.Underlying().(type) {
+	case *types.Basic, *types.Struct:
+		return func() *jen.Statement { return jen.Op("*").Add(pointer()) }
+	default:
+		return func() *jen.Statement { return jen.Parens(jen.Op("*").Add(pointer())) }
+	}
+}
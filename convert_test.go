@@ -0,0 +1,161 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestConvert(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package converted
+
+type Phase string
+
+type Count int
+
+// +convert:generate:to=Cluster
+// +convert:generate:ignore=Deprecated;Status
+type OldCluster struct {
+	Name       string
+	Phase      string
+	Replicas   Count
+	Timeout    *Count
+	Limits     map[string]Count
+	Pools      []OldPool
+	Primary    *OldPool
+	Zones      [2]string
+	Deprecated bool
+}
+
+// +convert:generate:to=Pool
+type OldPool struct {
+	Name string
+	Size Count
+}
+
+type Cluster struct {
+	Name     string
+	Phase    Phase
+	Replicas int
+	Timeout  *int
+	Limits   map[string]int
+	Pools    []Pool
+	Primary  *Pool
+	Zones    [2]string
+	Status   string
+}
+
+type Pool struct {
+	Name string
+	Size int
+}
+`,
+		"types_test.go": `package converted
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	timeout := Count(30)
+	old := OldCluster{
+		Name:       "cluster",
+		Phase:      "Running",
+		Replicas:   3,
+		Timeout:    &timeout,
+		Limits:     map[string]Count{"cpu": 2},
+		Pools:      []OldPool{{Name: "a", Size: 1}, {Name: "b", Size: 2}},
+		Primary:    &OldPool{Name: "a", Size: 1},
+		Zones:      [2]string{"x", "y"},
+		Deprecated: true,
+	}
+
+	var converted Cluster
+	old.ConvertTo(&converted)
+
+	want := Cluster{
+		Name:     "cluster",
+		Phase:    "Running",
+		Replicas: 3,
+		Timeout:  new(int),
+		Limits:   map[string]int{"cpu": 2},
+		Pools:    []Pool{{Name: "a", Size: 1}, {Name: "b", Size: 2}},
+		Primary:  &Pool{Name: "a", Size: 1},
+		Zones:    [2]string{"x", "y"},
+	}
+	*want.Timeout = 30
+	if !reflect.DeepEqual(converted, want) {
+		t.Errorf("ConvertTo() = %+v, want %+v", converted, want)
+	}
+
+	// the conversion doesn't share memory with the original
+	*old.Timeout, old.Limits["cpu"], old.Pools[0].Size = 60, 4, 5
+	if *converted.Timeout != 30 || converted.Limits["cpu"] != 2 || converted.Pools[0].Size != 1 {
+		t.Errorf("ConvertTo() shares memory with the converted value: %+v", converted)
+	}
+
+	// ignored fields are left as they are
+	back := OldCluster{Deprecated: true}
+	converted.Status = "ignored"
+	back.ConvertFrom(converted)
+
+	wantBack := OldCluster{
+		Name:       "cluster",
+		Phase:      "Running",
+		Replicas:   3,
+		Timeout:    &timeout,
+		Limits:     map[string]Count{"cpu": 2},
+		Pools:      []OldPool{{Name: "a", Size: 1}, {Name: "b", Size: 2}},
+		Primary:    &OldPool{Name: "a", Size: 1},
+		Zones:      [2]string{"x", "y"},
+		Deprecated: true,
+	}
+	*wantBack.Timeout = 30
+	if !reflect.DeepEqual(back, wantBack) {
+		t.Errorf("ConvertFrom() = %+v, want %+v", back, wantBack)
+	}
+
+	// nil values stay nil
+	var empty Cluster
+	OldCluster{}.ConvertTo(&empty)
+	if !reflect.DeepEqual(empty, Cluster{}) {
+		t.Errorf("ConvertTo() of the zero value = %+v, want the zero value", empty)
+	}
+}
+`,
+	}, "convert").succeeded(t).test(t)
+}
+
+func TestConvertUnmatchedField(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package converted
+
+// +convert:generate:to=Pool
+type OldPool struct {
+	Name  string
+	Nodes int
+}
+
+type Pool struct {
+	Name string
+	Size int
+}
+`,
+	}, "convert").failedWith(t, "Nodes (of OldPool), Size (of Pool)")
+}
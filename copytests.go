@@ -0,0 +1,202 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+// testField is a struct field the generated tests set to known values.
+type testField struct {
+	Name string
+	// Value is the (non-zero) value of the field in the filled test case.
+	Value jen.Code
+	// Other is a different value the field is modified to.
+	Other jen.Code
+	// Reference indicates that the field refers to other values (e.g. a slice).
+	Reference bool
+}
+
+// testFieldFor returns the values the tests set the given field to, if its type is supported.
+func testFieldFor(pkg *loader.Package, field *types.Var) (testField, bool) {
+	tested := testField{Name: field.Name()}
+
+	switch underlying := field.Type().Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case underlying.Info()&types.IsBoolean != 0:
+			tested.Value, tested.Other = jen.True(), jen.False()
+		case underlying.Info()&types.IsString != 0:
+			tested.Value, tested.Other = jen.Lit("a"), jen.Lit("b")
+		case underlying.Info()&(types.IsInteger|types.IsFloat) != 0:
+			tested.Value, tested.Other = jen.Lit(1), jen.Lit(2)
+		default:
+			return testField{}, false
+		}
+
+	// references are set to values that are merely non-nil, and modified to nil
+	case *types.Pointer:
+		tested.Value, tested.Other, tested.Reference = jen.New(typeCode(pkg, underlying.Elem())), jen.Nil(), true
+	case *types.Slice:
+		tested.Value, tested.Other, tested.Reference = jen.Make(typeCode(pkg, field.Type()), jen.Lit(1)), jen.Nil(), true
+	case *types.Map:
+		tested.Value, tested.Other, tested.Reference = jen.Make(typeCode(pkg, field.Type())), jen.Nil(), true
+
+	default:
+		return testField{}, false
+	}
+
+	return tested, true
+}
+
+// generateTests generates the fuzz and unit tests of the structs that requested
+// them, returning nil if there are none.
+func generateTests(pkg *loader.Package, structs []copyStructs) *jen.File {
+	var code *jen.File
+
+	for _, s := range structs {
+		if !s.Fuzz && !s.Tests {
+			continue
+		}
+
+		if code == nil {
+			code = jen.NewFile(pkg.Name)
+		}
+
+		if s.Fuzz {
+			generateFuzzTest(code, s)
+		}
+		if s.Tests {
+			generateCopyTest(code, s)
+		}
+	}
+
+	return code
+}
+
+// generateCopyTest generates the table-driven test of the given struct,
+// checking that its copies are equal to the original, and that modifying the
+// fields of the copy doesn't affect the original (and the other way around).
+func generateCopyTest(code *jen.File, s copyStructs) {
+	filled := make([]keyValue, 0, len(s.TestFields))
+	var fields, others, references, nils []jen.Code
+
+	for _, field := range s.TestFields {
+		filled = append(filled, keyValue{Key: field.Name, Value: field.Value})
+		fields = append(fields, jen.Id("c").Dot(field.Name))
+		others = append(others, field.Other)
+
+		if field.Reference {
+			references = append(references, jen.Id("o").Dot(field.Name))
+			nils = append(nils, jen.Nil())
+		}
+	}
+
+	// the values are tested through pointers for pointer receivers
+	value := func(name string) jen.Code {
+		if s.Pointer {
+			return jen.Op("*").Id(name)
+		}
+
+		return jen.Id(name)
+	}
+
+	body := []jen.Code{jen.Id("o").Op(":=").Id("test").Dot("value")}
+	if s.Pointer {
+		body = []jen.Code{
+			jen.Id("value").Op(":=").Id("test").Dot("value"),
+			jen.Id("o").Op(":=").Op("&").Id("value"),
+		}
+	}
+
+	shallowCopy := func(assign string) []jen.Code {
+		if !s.ValidateAfter {
+			return []jen.Code{jen.Id("c").Op(assign).Id("o").Dot(s.CopyMethod).Call()}
+		}
+
+		return []jen.Code{
+			jen.List(jen.Id("c"), jen.Err()).Op(assign).Id("o").Dot(s.CopyMethod).Call(),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				// the test values aren't necessarily valid
+				jen.Id("t").Dot("Skipf").Call(jen.Lit("the value isn't valid: %v"), jen.Err()),
+			),
+		}
+	}
+
+	body = append(body, shallowCopy(":=")...)
+	body = append(body, jen.If(jen.Op("!").Add(testEqual(s, value("c"), value("o")))).Block(
+		jen.Id("t").Dot("Fatalf").Call(jen.Lit(s.CopyMethod+"() = %#v, want %#v"), value("c"), value("o")),
+	))
+
+	if len(fields) > 0 {
+		body = append(body,
+			jen.Line(),
+			jen.List(fields...).Op("=").List(others...),
+			jen.If(jen.Op("!").Add(testEqual(s, value("o"), jen.Id("test").Dot("value")))).Block(
+				jen.Id("t").Dot("Errorf").Call(jen.Lit("modifying the copy changed the original to %#v"), value("o")),
+			),
+		)
+	}
+
+	if len(references) > 0 {
+		body = append(body, jen.Line())
+		body = append(body, shallowCopy("=")...)
+		body = append(body,
+			jen.List(references...).Op("=").List(nils...),
+			jen.If(jen.Op("!").Add(testEqual(s, value("c"), jen.Id("test").Dot("value")))).Block(
+				jen.Id("t").Dot("Errorf").Call(jen.Lit("modifying the original changed the copy to %#v"), value("c")),
+			),
+		)
+	}
+
+	code.Func().
+		Id("Test"+s.StructName+"_"+s.CopyMethod).
+		Params(jen.Id("t").Op("*").Qual("testing", "T")).
+		Block(
+			jen.Id("tests").Op(":=").Index().Struct(
+				jen.Id("name").String(),
+				jen.Id("value").Id(s.StructName),
+			).Values(
+				jen.Line().Values(jen.Dict{jen.Id("name"): jen.Lit("zero")}),
+				jen.Line().Values(jen.Dict{
+					jen.Id("name"):  jen.Lit("filled"),
+					jen.Id("value"): jen.Id(s.StructName).Values(orderedDict(filled)...),
+				}),
+				jen.Line(),
+			),
+			jen.Line(),
+			jen.For(jen.List(jen.Id("_"), jen.Id("test")).Op(":=").Range().Id("tests")).Block(
+				jen.Id("t").Dot("Run").Call(jen.Id("test").Dot("name"), jen.Func().Params(jen.Id("t").Op("*").Qual("testing", "T")).Block(body...)),
+			),
+		)
+}
+
+// testEqual returns the expression checking whether the given values of the
+// struct are equal, using its Equal method when it has one.
+func testEqual(s copyStructs, x, y jen.Code) jen.Code {
+	if !s.Equal {
+		return jen.Qual("reflect", "DeepEqual").Call(x, y)
+	}
+
+	// dereferenced values need parentheses to call methods on them
+	if s.Pointer {
+		x = jen.Parens(x)
+	}
+
+	return jen.Add(x).Dot(equalMethod).Call(y)
+}
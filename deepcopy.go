@@ -0,0 +1,621 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+var (
+	enableDeepCopyTypeMarker  = markers.Must(markers.MakeDefinition("deepcopy:generate", markers.DescribesType, false))
+	deepCopyAcyclicTypeMarker = markers.Must(markers.MakeDefinition("deepcopy:generate:acyclic", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("deepcopy", DeepCopyGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// DeepCopyGenerator generates code containing DeepCopy and DeepCopyInto method implementations.
+type DeepCopyGenerator struct{}
+
+func (DeepCopyGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableDeepCopyTypeMarker, deepCopyAcyclicTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableDeepCopyTypeMarker,
+		markers.SimpleHelp("object", "enables or disables deepcopy implementation generation for this type"),
+	)
+	into.AddHelp(
+		deepCopyAcyclicTypeMarker,
+		markers.SimpleHelp("object", "skips keeping track of the copied values of recursive types, promising that their values never refer to themselves (e.g. trees without parent pointers)"),
+	)
+
+	return nil
+}
+
+func (DeepCopyGenerator) Generate(ctx *genall.GenerationContext) error {
+	for _, root := range ctx.Roots {
+		infos, err := markedTypes(ctx, root, enableDeepCopyTypeMarker)
+		if err != nil {
+			root.AddError(err)
+			return nil
+		}
+
+		if len(infos) == 0 {
+			continue
+		}
+
+		copier := &deepCopier{
+			pkg:       root,
+			generated: make(map[string]bool, len(infos)),
+			tracked:   make(map[string]bool),
+			visiting:  make(map[*types.Named]bool),
+		}
+
+		var copied []deepCopiedType
+		for _, info := range infos {
+			typeInfo := root.TypesInfo.TypeOf(info.RawSpec.Name)
+			if typeInfo == types.Typ[types.Invalid] {
+				report(root, info.RawSpec, newDiagnostic(codeUnknownType, nil, "fix the type errors of the package first", "unknown type %s", info.Name))
+
+				continue
+			}
+
+			switch typeInfo.Underlying().(type) {
+			case *types.Struct, *types.Slice, *types.Map, *types.Array:
+			default:
+				report(root, info.RawSpec, newDiagnostic(codeUnsupportedType, enableDeepCopyTypeMarker, "remove the marker",
+					"%s is not a struct, slice, map or array type", info.Name))
+
+				continue
+			}
+
+			if reportGeneric(root, info, typeInfo, enableDeepCopyTypeMarker) {
+				continue
+			}
+
+			copier.generated[info.Name] = true
+			copied = append(copied, deepCopiedType{info: info, typeInfo: typeInfo})
+		}
+
+		// the values of recursive types can refer to themselves (e.g. a child node
+		// to its parent), so their copies keep track of the values they copied
+		// already, unless they're promised not to
+		for _, t := range copied {
+			acyclic, err := boolMarkerOnType(t.info, deepCopyAcyclicTypeMarker)
+			if err != nil {
+				report(root, t.info.RawSpec, newDiagnostic(codeInvalidMarker, deepCopyAcyclicTypeMarker, "", "%v", err))
+				delete(copier.generated, t.info.Name)
+
+				continue
+			}
+
+			if acyclic || copier.selfReference(t.typeInfo.(*types.Named)) == "" {
+				continue
+			}
+
+			if existing, _, _ := types.LookupFieldOrMethod(t.typeInfo, true /* check pointers too */, root.Types, trackedDeepCopyMethod); existing != nil {
+				report(root, t.info.RawSpec, newDiagnostic(codeCollision, nil, "rename it",
+					"%s of %s collides with the generated method keeping track of the copied values", trackedDeepCopyMethod, t.info.Name))
+				delete(copier.generated, t.info.Name)
+
+				continue
+			}
+
+			copier.tracked[t.info.Name] = true
+		}
+
+		// types whose copy fails don't get methods, so the types calling them
+		// have to be copied again without them, until no more copies fail
+		for failed := true; failed; {
+			failed = false
+
+			for i, t := range copied {
+				if !copier.generated[t.info.Name] {
+					continue
+				}
+
+				// NB: we copy the underlying type, checking for a DeepCopyInto method
+				// on the named type itself would just make it call itself
+				copier.tracking = copier.tracked[t.info.Name]
+				body, err := copier.copyVar(t.typeInfo.Underlying())
+				if err != nil {
+					report(root, t.info.RawSpec, newDiagnostic(codeUncopyableField, nil, "", "%s: %v", t.info.Name, err))
+					delete(copier.generated, t.info.Name)
+					failed = true
+
+					continue
+				}
+
+				copied[i].body = body
+			}
+		}
+
+		if len(copier.generated) == 0 {
+			continue
+		}
+
+		code := jen.NewFile(root.Name)
+
+		for _, t := range copied {
+			if !copier.generated[t.info.Name] {
+				continue
+			}
+
+			name := t.info.Name
+			body := append([]jen.Code{jen.Op("*").Id("out").Op("=").Op("*").Id("in")}, t.body...)
+
+			if copier.tracked[name] {
+				code.Comment(fmt.Sprintf("%s copies the receiver into out, recording the copies made (by source pointer) in copied,", trackedDeepCopyMethod))
+				code.Comment("so values referred to more than once are copied once. in must be non-nil.")
+				code.Func().
+					Params(jen.Id("in").Op("*").Id(name)).
+					Id(trackedDeepCopyMethod).
+					Params(jen.Id("out").Op("*").Id(name), jen.Id("copied").Map(jen.Interface()).Interface()).
+					Block(append([]jen.Code{jen.Id("copied").Index(jen.Id("in")).Op("=").Id("out")}, body...)...)
+
+				body = []jen.Code{jen.Id("in").Dot(trackedDeepCopyMethod).Call(jen.Id("out"), jen.Make(jen.Map(jen.Interface()).Interface()))}
+			}
+
+			code.Comment("DeepCopyInto copies the receiver into out. in must be non-nil.")
+			code.Func().
+				Params(jen.Id("in").Op("*").Id(name)).
+				Id("DeepCopyInto").
+				Params(jen.Id("out").Op("*").Id(name)).
+				Block(body...)
+
+			code.Comment(fmt.Sprintf("DeepCopy creates a new %s, deep-copying the receiver into it.", name))
+			code.Func().
+				Params(jen.Id("in").Op("*").Id(name)).
+				Id("DeepCopy").
+				Params().
+				Params(jen.Op("*").Id(name)).
+				Block(
+					jen.If(jen.Id("in").Op("==").Nil()).Block(jen.Return(jen.Nil())),
+					jen.Id("out").Op(":=").New(jen.Id(name)),
+					jen.Id("in").Dot("DeepCopyInto").Call(jen.Id("out")),
+					jen.Return(jen.Id("out")),
+				)
+		}
+
+		renderOut(ctx, root, code, "zz_generated.deepcopy.go", "")
+	}
+
+	return nil
+}
+
+// trackedDeepCopyMethod is the name of the method generated for recursive types,
+// deep-copying values while keeping track of the copies made.
+const trackedDeepCopyMethod = "deepCopyInto"
+
+// deepCopiedType is a marked type, with the statements deep-copying it once they're built.
+type deepCopiedType struct {
+	info     *markers.TypeInfo
+	typeInfo types.Type
+	body     []jen.Code
+}
+
+// deepCopier emits the statements deep-copying values of a given type.
+//
+// The emitted statements work on two pointer variables, in and out, pointing
+// to the source and the destination value.  The destination always holds
+// a shallow copy of the source already, so only values with reference
+// semantics (pointers, slices and maps) need to be copied explicitly.
+type deepCopier struct {
+	pkg *loader.Package
+	// generated lists the types deepcopy methods are generated for in this package.
+	generated map[string]bool
+	// tracked lists the generated types whose copies keep track of the values
+	// copied, in a map named copied.
+	tracked map[string]bool
+	// tracking is set while emitting the statements of a tracked type, which
+	// pass the copied map on to the other tracked types.
+	tracking bool
+	// visiting guards against recursing forever into named types without deepcopy methods.
+	visiting map[*types.Named]bool
+}
+
+// hasDeepCopyInto checks if the given type has (or will have) a DeepCopyInto method.
+func (c *deepCopier) hasDeepCopyInto(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed {
+		return false
+	}
+
+	if named.Obj().Pkg() == c.pkg.Types && c.generated[named.Obj().Name()] {
+		return true
+	}
+
+	method, ind, _ := types.LookupFieldOrMethod(named, true /* check pointers too */, named.Obj().Pkg(), "DeepCopyInto")
+	if len(ind) != 1 {
+		// ignore embedded methods, they only copy the embedded value
+		return false
+	}
+
+	methodSig, isFunc := method.(*types.Func)
+	if !isFunc {
+		return false
+	}
+
+	return methodSig.Type().(*types.Signature).Params().Len() == 1
+}
+
+// hasDeepCopy checks if the given type has a DeepCopy method of its own,
+// returning a pointer to the copy (e.g. an instance of a generic type with one).
+func (c *deepCopier) hasDeepCopy(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed {
+		return false
+	}
+
+	method, ind, _ := types.LookupFieldOrMethod(named, true /* check pointers too */, named.Obj().Pkg(), "DeepCopy")
+	if len(ind) != 1 {
+		// ignore embedded methods, they only copy the embedded value
+		return false
+	}
+
+	methodFunc, isFunc := method.(*types.Func)
+	if !isFunc {
+		return false
+	}
+
+	methodSig := methodFunc.Type().(*types.Signature)
+	if methodSig.Params().Len() != 0 || methodSig.Results().Len() != 1 {
+		return false
+	}
+
+	return types.Identical(methodSig.Results().At(0).Type(), types.NewPointer(named))
+}
+
+// tracks checks if the given type is copied passing on the values copied so
+// far, making the copy of a pointer to a value copied already point to its copy.
+func (c *deepCopier) tracks(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !c.tracking || !isNamed || named.Obj().Pkg() != c.pkg.Types {
+		return false
+	}
+
+	return c.tracked[named.Obj().Name()] && c.generated[named.Obj().Name()]
+}
+
+// copyInto returns the statement deep-copying in into out (a pointer) of a
+// type having a DeepCopyInto method.
+func (c *deepCopier) copyInto(in *jen.Statement, out jen.Code, t types.Type) jen.Code {
+	if c.tracks(t) {
+		return in.Dot(trackedDeepCopyMethod).Call(out, jen.Id("copied"))
+	}
+
+	return in.Dot("DeepCopyInto").Call(out)
+}
+
+// selfReference returns what values of the given type can refer to other
+// values of it through (e.g. the Parent field of a tree node), or "" if they
+// can't. Types copied by DeepCopyInto or DeepCopy methods of their own aren't
+// followed.
+func (c *deepCopier) selfReference(named *types.Named) string {
+	seen := make(map[*types.Named]bool)
+
+	stype, isStruct := named.Underlying().(*types.Struct)
+	if !isStruct {
+		if c.refersTo(named.Underlying(), named, seen) {
+			return "its elements"
+		}
+
+		return ""
+	}
+
+	for i := 0; i < stype.NumFields(); i++ {
+		if c.refersTo(stype.Field(i).Type(), named, seen) {
+			return "field " + stype.Field(i).Name()
+		}
+	}
+
+	return ""
+}
+
+// refersTo checks if values of the given type can refer to values of the
+// target type, following the types in seen only once.
+func (c *deepCopier) refersTo(t types.Type, target *types.Named, seen map[*types.Named]bool) bool {
+	if named, isNamed := t.(*types.Named); isNamed {
+		if types.Identical(named, target) {
+			return true
+		}
+
+		generated := named.Obj().Pkg() == c.pkg.Types && c.generated[named.Obj().Name()]
+		if seen[named] || (!generated && (c.hasDeepCopyInto(named) || c.hasDeepCopy(named))) || c.copiedByValue(named) {
+			return false
+		}
+
+		seen[named] = true
+	}
+
+	switch underlying := t.Underlying().(type) {
+	case *types.Pointer:
+		return c.refersTo(underlying.Elem(), target, seen)
+	case *types.Slice:
+		return c.refersTo(underlying.Elem(), target, seen)
+	case *types.Array:
+		return c.refersTo(underlying.Elem(), target, seen)
+	case *types.Map:
+		return c.refersTo(underlying.Key(), target, seen) || c.refersTo(underlying.Elem(), target, seen)
+	case *types.Struct:
+		for i := 0; i < underlying.NumFields(); i++ {
+			if c.refersTo(underlying.Field(i).Type(), target, seen) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// copiedByValue checks if the given type is a struct of another package with
+// unexported fields (e.g. time.Time). Those fields can't be copied one by one,
+// so values of such types are copied as a whole, the way their package hands
+// them out.
+func (c *deepCopier) copiedByValue(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed || named.Obj().Pkg() == c.pkg.Types {
+		return false
+	}
+
+	stype, isStruct := named.Underlying().(*types.Struct)
+	if !isStruct {
+		return false
+	}
+
+	for i := 0; i < stype.NumFields(); i++ {
+		if !stype.Field(i).Exported() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyVar returns the statements deep-copying *in into *out (which already
+// holds a shallow copy of *in), or nothing if a shallow copy is enough.
+func (c *deepCopier) copyVar(t types.Type) ([]jen.Code, error) {
+	if c.hasDeepCopyInto(t) {
+		return []jen.Code{c.copyInto(jen.Id("in"), jen.Id("out"), t)}, nil
+	}
+
+	if c.hasDeepCopy(t) {
+		return []jen.Code{jen.Op("*").Id("out").Op("=").Op("*").Id("in").Dot("DeepCopy").Call()}, nil
+	}
+
+	if c.copiedByValue(t) {
+		return nil, nil
+	}
+
+	if named, isNamed := t.(*types.Named); isNamed {
+		if c.visiting[named] {
+			return nil, fmt.Errorf("recursive type %s needs a DeepCopyInto method", named.Obj().Name())
+		}
+
+		c.visiting[named] = true
+		defer delete(c.visiting, named)
+	}
+
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic, *types.Signature, *types.Chan:
+		// functions are immutable, channels are meant to be shared
+		return nil, nil
+
+	case *types.Interface:
+		return nil, fmt.Errorf("cannot deep copy interface type %s", t)
+
+	case *types.Pointer, *types.Slice, *types.Map:
+		body, err := c.copyNonNil(t)
+		if err != nil || len(body) == 0 {
+			return body, err
+		}
+
+		return []jen.Code{jen.If(jen.Op("*").Id("in").Op("!=").Nil()).Block(body...)}, nil
+
+	case *types.Array:
+		elem, err := c.copyVar(underlying.Elem())
+		if err != nil || len(elem) == 0 {
+			return elem, err
+		}
+
+		return []jen.Code{jen.For(jen.Id("i").Op(":=").Range().Op("*").Id("in")).Block(
+			append([]jen.Code{
+				shadowVars(jen.Op("&").Parens(jen.Op("*").Id("in")).Index(jen.Id("i")), jen.Op("&").Parens(jen.Op("*").Id("out")).Index(jen.Id("i"))),
+			}, elem...)...,
+		)}, nil
+
+	case *types.Struct:
+		var stmts []jen.Code
+
+		for i := 0; i < underlying.NumFields(); i++ {
+			field := underlying.Field(i)
+
+			fieldStmts, err := c.copyField(field)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(fieldStmts) > 0 && !field.Exported() && field.Pkg() != c.pkg.Types {
+				return nil, fmt.Errorf("cannot deep copy unexported field %s of %s", field.Name(), t)
+			}
+
+			stmts = append(stmts, fieldStmts...)
+		}
+
+		return stmts, nil
+
+	default:
+		return nil, fmt.Errorf("cannot deep copy type %s", t)
+	}
+}
+
+// copyField returns the statements deep-copying in.Field into out.Field.
+func (c *deepCopier) copyField(field *types.Var) ([]jen.Code, error) {
+	inField := func() *jen.Statement { return jen.Id("in").Dot(field.Name()) }
+	outField := func() *jen.Statement { return jen.Id("out").Dot(field.Name()) }
+	shadow := shadowVars(jen.Op("&").Add(inField()), jen.Op("&").Add(outField()))
+
+	if c.hasDeepCopyInto(field.Type()) {
+		return []jen.Code{c.copyInto(inField(), jen.Op("&").Add(outField()), field.Type())}, nil
+	}
+
+	switch field.Type().Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map:
+		if named, isNamed := field.Type().(*types.Named); isNamed {
+			if c.visiting[named] {
+				return nil, fmt.Errorf("recursive type %s needs a DeepCopyInto method", named.Obj().Name())
+			}
+
+			c.visiting[named] = true
+			defer delete(c.visiting, named)
+		}
+
+		body, err := c.copyNonNil(field.Type())
+		if err != nil || len(body) == 0 {
+			return body, err
+		}
+
+		return []jen.Code{jen.If(inField().Op("!=").Nil()).Block(append([]jen.Code{shadow}, body...)...)}, nil
+
+	default:
+		body, err := c.copyVar(field.Type())
+		if err != nil || len(body) == 0 {
+			return body, err
+		}
+
+		return []jen.Code{jen.Block(append([]jen.Code{shadow}, body...)...)}, nil
+	}
+}
+
+// copyNonNil returns the statements deep-copying the non-nil pointer, slice or map *in into *out.
+func (c *deepCopier) copyNonNil(t types.Type) ([]jen.Code, error) {
+	switch underlying := t.Underlying().(type) {
+	case *types.Pointer:
+		elemType := underlying.Elem()
+		stmts := []jen.Code{jen.Op("*").Id("out").Op("=").New(typeCode(c.pkg, elemType))}
+
+		// the values copied already are pointed to by their copies
+		if c.tracks(elemType) {
+			return []jen.Code{jen.If(
+				jen.List(jen.Id("copiedOut"), jen.Id("isCopied")).Op(":=").Id("copied").Index(jen.Op("*").Id("in")),
+				jen.Id("isCopied"),
+			).Block(
+				jen.Op("*").Id("out").Op("=").Id("copiedOut").Assert(jen.Op("*").Add(typeCode(c.pkg, elemType))),
+			).Else().Block(
+				append(stmts, c.copyInto(jen.Parens(jen.Op("*").Id("in")), jen.Op("*").Id("out"), elemType))...,
+			)}, nil
+		}
+
+		if c.hasDeepCopyInto(elemType) {
+			return append(stmts, c.copyInto(jen.Parens(jen.Op("*").Id("in")), jen.Op("*").Id("out"), elemType)), nil
+		}
+
+		if c.hasDeepCopy(elemType) {
+			return []jen.Code{jen.Op("*").Id("out").Op("=").Parens(jen.Op("*").Id("in")).Dot("DeepCopy").Call()}, nil
+		}
+
+		stmts = append(stmts, jen.Op("**").Id("out").Op("=").Op("**").Id("in"))
+
+		elem, err := c.copyVar(elemType)
+		if err != nil {
+			return nil, err
+		}
+		if len(elem) > 0 {
+			// the pointers themselves were declared in the current scope
+			stmts = append(stmts, jen.Block(append([]jen.Code{
+				shadowVars(jen.Op("*").Id("in"), jen.Op("*").Id("out")),
+			}, elem...)...))
+		}
+
+		return stmts, nil
+
+	case *types.Slice:
+		elemType := underlying.Elem()
+		stmts := []jen.Code{jen.Op("*").Id("out").Op("=").Make(typeCode(c.pkg, t), jen.Len(jen.Op("*").Id("in")))}
+
+		if c.hasDeepCopyInto(elemType) {
+			return append(stmts, jen.For(jen.Id("i").Op(":=").Range().Op("*").Id("in")).Block(
+				c.copyInto(jen.Parens(jen.Op("*").Id("in")).Index(jen.Id("i")), jen.Op("&").Parens(jen.Op("*").Id("out")).Index(jen.Id("i")), elemType),
+			)), nil
+		}
+
+		stmts = append(stmts, jen.Copy(jen.Op("*").Id("out"), jen.Op("*").Id("in")))
+
+		elem, err := c.copyVar(elemType)
+		if err != nil {
+			return nil, err
+		}
+		if len(elem) > 0 {
+			stmts = append(stmts, jen.For(jen.Id("i").Op(":=").Range().Op("*").Id("in")).Block(
+				append([]jen.Code{
+					shadowVars(jen.Op("&").Parens(jen.Op("*").Id("in")).Index(jen.Id("i")), jen.Op("&").Parens(jen.Op("*").Id("out")).Index(jen.Id("i"))),
+				}, elem...)...,
+			))
+		}
+
+		return stmts, nil
+
+	case *types.Map:
+		elemType := underlying.Elem()
+		stmts := []jen.Code{jen.Op("*").Id("out").Op("=").Make(typeCode(c.pkg, t), jen.Len(jen.Op("*").Id("in")))}
+
+		var loop []jen.Code
+		if c.hasDeepCopyInto(elemType) {
+			loop = []jen.Code{
+				jen.Var().Id("outVal").Add(typeCode(c.pkg, elemType)),
+				c.copyInto(jen.Id("val"), jen.Op("&").Id("outVal"), elemType),
+				jen.Parens(jen.Op("*").Id("out")).Index(jen.Id("key")).Op("=").Id("outVal"),
+			}
+		} else {
+			elem, err := c.copyVar(elemType)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(elem) == 0 {
+				loop = []jen.Code{jen.Parens(jen.Op("*").Id("out")).Index(jen.Id("key")).Op("=").Id("val")}
+			} else {
+				loop = []jen.Code{
+					jen.Id("outVal").Op(":=").Id("val"),
+					jen.Block(append([]jen.Code{
+						shadowVars(jen.Op("&").Id("val"), jen.Op("&").Id("outVal")),
+					}, elem...)...),
+					jen.Parens(jen.Op("*").Id("out")).Index(jen.Id("key")).Op("=").Id("outVal"),
+				}
+			}
+		}
+
+		return append(stmts, jen.For(jen.List(jen.Id("key"), jen.Id("val")).Op(":=").Range().Op("*").Id("in")).Block(loop...)), nil
+
+	default:
+		return nil, fmt.Errorf("cannot deep copy type %s", t)
+	}
+}
+
+// shadowVars declares new in and out variables, shadowing the current ones.
+func shadowVars(in, out jen.Code) jen.Code {
+	return jen.List(jen.Id("in"), jen.Id("out")).Op(":=").List(in, out)
+}
@@ -0,0 +1,321 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"time"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// setDefaultsMethod is the name of the generated method.
+const setDefaultsMethod = "SetDefaults"
+
+var (
+	enableDefaultsTypeMarker = markers.Must(markers.MakeDefinition("default:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("default", DefaultsGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// DefaultsGenerator generates code containing SetDefaults method implementations,
+// assigning the default values set with +default markers to zero-valued fields.
+//
+// Defaults can be set on fields of string, numeric and bool types (and pointers
+// to them, which are only defaulted when nil), as literals of the field type.
+// time.Duration fields also accept duration strings (e.g. "30s").
+//
+// Fields of types having a SetDefaults method themselves (or generated in the
+// same run) are defaulted using it.
+type DefaultsGenerator struct{}
+
+func (DefaultsGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableDefaultsTypeMarker, defaultFieldMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableDefaultsTypeMarker,
+		markers.SimpleHelp("object", "enables or disables SetDefaults implementation generation for this type"),
+	)
+	into.AddHelp(
+		defaultFieldMarker,
+		markers.SimpleHelp("object", "sets the default value of this field, as a Go literal"),
+	)
+
+	return nil
+}
+
+func (DefaultsGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableDefaultsTypeMarker, "zz_generated.defaults.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		generated := make(map[string]bool, len(structs))
+		for _, s := range structs {
+			generated[s.Info.Name] = true
+		}
+
+		for _, s := range structs {
+			if err := generateSetDefaults(code, root, generated, s); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+	})
+}
+
+// generateSetDefaults generates the SetDefaults method of the given struct.
+// The returned errors are diagnostics.
+func generateSetDefaults(code *jen.File, pkg *loader.Package, generated map[string]bool, s markedStruct) error {
+	if _, ind, _ := types.LookupFieldOrMethod(s.Type, true, pkg.Types, setDefaultsMethod); len(ind) == 1 {
+		return newDiagnostic(codeCollision, enableDefaultsTypeMarker, "rename it", "%s collides with an existing field or method", setDefaultsMethod)
+	}
+
+	var body []jen.Code
+
+	for i := 0; i < s.Struct.NumFields(); i++ {
+		field := s.Struct.Field(i)
+		fieldValue := func() *jen.Statement { return jen.Id("o").Dot(field.Name()) }
+
+		var literal markers.RawArguments
+		if i < len(s.Info.Fields) {
+			literal, _ = s.Info.Fields[i].Markers.Get(defaultFieldMarker.Name).(markers.RawArguments)
+		}
+
+		if literal == nil {
+			switch t := field.Type().(type) {
+			case *types.Named:
+				if hasSetDefaults(pkg, generated, t) {
+					body = append(body, fieldValue().Dot(setDefaultsMethod).Call())
+				}
+			case *types.Pointer:
+				if hasSetDefaults(pkg, generated, t.Elem()) {
+					body = append(body, jen.If(fieldValue().Op("!=").Nil()).Block(fieldValue().Dot(setDefaultsMethod).Call()))
+				}
+			}
+
+			continue
+		}
+
+		if pointer, isPointer := field.Type().(*types.Pointer); isPointer {
+			value, err := literalOfType(pkg, pointer.Elem(), string(literal))
+			if err != nil {
+				return newDiagnostic(codeInvalidMarker, defaultFieldMarker, "", "invalid default value %s of field %s: %v", literal, field.Name(), err)
+			}
+
+			body = append(body, jen.If(fieldValue().Op("==").Nil()).Block(
+				fieldValue().Op("=").New(typeCode(pkg, pointer.Elem())),
+				jen.Op("*").Add(fieldValue()).Op("=").Add(value),
+			))
+
+			continue
+		}
+
+		value, err := literalOfType(pkg, field.Type(), string(literal))
+		if err != nil {
+			return newDiagnostic(codeInvalidMarker, defaultFieldMarker, "", "invalid default value %s of field %s: %v", literal, field.Name(), err)
+		}
+
+		basic := field.Type().Underlying().(*types.Basic)
+
+		var isZero jen.Code
+		switch {
+		case basic.Info()&types.IsBoolean != 0:
+			isZero = jen.Op("!").Add(fieldValue())
+		case basic.Info()&types.IsString != 0:
+			isZero = fieldValue().Op("==").Lit("")
+		default:
+			isZero = fieldValue().Op("==").Lit(0)
+		}
+
+		body = append(body, jen.If(isZero).Block(fieldValue().Op("=").Add(value)))
+	}
+
+	code.Commentf("%s sets the zero-valued fields of o to their defaults.", setDefaultsMethod)
+	code.Func().
+		Params(jen.Id("o").Op("*").Id(s.Info.Name)).
+		Id(setDefaultsMethod).
+		Params().
+		Block(body...)
+
+	return nil
+}
+
+// literalOfType validates the given literal of the given string, numeric or
+// bool type, returning its code.
+//
+// time.Duration literals can also be duration strings (e.g. "30s").
+func literalOfType(pkg *loader.Package, t types.Type, literal string) (jen.Code, error) {
+	expr, err := parser.ParseExpr(literal)
+	if err != nil {
+		return nil, err
+	}
+
+	basic, isBasic := t.Underlying().(*types.Basic)
+	if !isBasic || basic.Info()&(types.IsBoolean|types.IsString|types.IsNumeric) == 0 || basic.Info()&types.IsComplex != 0 {
+		return nil, fmt.Errorf("only string, numeric and bool values are supported, not %s", t)
+	}
+
+	if basic.Info()&types.IsBoolean != 0 {
+		if ident, isIdent := expr.(*ast.Ident); !isIdent || (ident.Name != "true" && ident.Name != "false") {
+			return nil, fmt.Errorf("expected true or false")
+		}
+
+		return jen.Op(literal), nil
+	}
+
+	// negative numbers are unary expressions
+	negative := false
+	if unary, isUnary := expr.(*ast.UnaryExpr); isUnary && unary.Op == token.SUB && basic.Info()&types.IsNumeric != 0 {
+		negative, expr = true, unary.X
+	}
+
+	lit, isLit := expr.(*ast.BasicLit)
+
+	if basic.Info()&types.IsString != 0 {
+		if !isLit || lit.Kind != token.STRING {
+			return nil, fmt.Errorf("expected a string literal")
+		}
+
+		return jen.Op(literal), nil
+	}
+
+	if !isLit {
+		return nil, fmt.Errorf("expected a number")
+	}
+
+	if isDuration(t) && lit.Kind == token.STRING {
+		text, _ := strconv.Unquote(lit.Value)
+
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, err
+		}
+
+		return durationCode(pkg, t, duration), nil
+	}
+
+	value := constant.MakeFromLiteral(lit.Value, lit.Kind, 0)
+	if negative {
+		value = constant.UnaryOp(token.SUB, value, 0)
+	}
+
+	switch {
+	case value.Kind() != constant.Int && value.Kind() != constant.Float:
+		return nil, fmt.Errorf("expected a number")
+	case basic.Info()&types.IsInteger != 0:
+		if err := checkIntegerRange(basic, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return jen.Op(literal), nil
+}
+
+// checkIntegerRange checks that the given constant fits into the given integer type.
+func checkIntegerRange(basic *types.Basic, value constant.Value) error {
+	intValue := constant.ToInt(value)
+	if intValue.Kind() != constant.Int {
+		return fmt.Errorf("%s isn't an integer", value)
+	}
+
+	unsigned := basic.Info()&types.IsUnsigned != 0
+	bits := map[types.BasicKind]uint{
+		types.Int8: 8, types.Int16: 16, types.Int32: 32,
+		types.Uint8: 8, types.Uint16: 16, types.Uint32: 32,
+	}[basic.Kind()]
+	if bits == 0 {
+		// int, uint, uintptr (assuming 64 bit platforms) and the 64 bit types
+		bits = 64
+	}
+
+	lowest, highest := constant.MakeInt64(0), constant.MakeUint64(1<<bits-1)
+	if !unsigned {
+		lowest = constant.MakeInt64(-1 << (bits - 1))
+		highest = constant.MakeInt64(1<<(bits-1) - 1)
+	}
+
+	if constant.Compare(intValue, token.LSS, lowest) || constant.Compare(intValue, token.GTR, highest) {
+		return fmt.Errorf("%s overflows %s", value, basic)
+	}
+
+	return nil
+}
+
+// isDuration checks if the given type is time.Duration.
+func isDuration(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+
+	return isNamed && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "time" && named.Obj().Name() == "Duration"
+}
+
+// durationCode renders the given duration as a multiple of the largest unit dividing it (e.g. 90 * time.Minute).
+func durationCode(pkg *loader.Package, t types.Type, duration time.Duration) jen.Code {
+	units := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"Hour", time.Hour},
+		{"Minute", time.Minute},
+		{"Second", time.Second},
+		{"Millisecond", time.Millisecond},
+		{"Microsecond", time.Microsecond},
+	}
+
+	for _, unit := range units {
+		if duration%unit.value == 0 {
+			return jen.Lit(int(duration/unit.value)).Op("*").Qual("time", unit.name)
+		}
+	}
+
+	return typeCode(pkg, t).Call(jen.Lit(int(duration)))
+}
+
+// hasSetDefaults checks if the given type has (or will have) a SetDefaults() method.
+func hasSetDefaults(pkg *loader.Package, generated map[string]bool, t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed {
+		return false
+	}
+
+	if named.Obj().Pkg() == pkg.Types && generated[named.Obj().Name()] {
+		return true
+	}
+
+	method, ind, _ := types.LookupFieldOrMethod(named, true /* check pointers too */, named.Obj().Pkg(), setDefaultsMethod)
+	if len(ind) != 1 {
+		// ignore embedded methods, they only default the embedded value
+		return false
+	}
+
+	methodFunc, isFunc := method.(*types.Func)
+	if !isFunc {
+		return false
+	}
+
+	methodSig := methodFunc.Type().(*types.Signature)
+
+	return methodSig.Params().Len() == 0 && methodSig.Results().Len() == 0
+}
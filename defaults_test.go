@@ -0,0 +1,131 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestDefaults(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package defaulted
+
+import "time"
+
+type Queue string
+
+// +default:generate=true
+type Worker struct {
+	// +default="default"
+	Queue Queue
+	// +default=4
+	Concurrency int
+	// +default=-1
+	Priority int8
+	// +default=0.5
+	Ratio float64
+	// +default=true
+	Enabled *bool
+	// +default="1m30s"
+	Timeout time.Duration
+	// +default=3
+	Retries *uint32
+	Backoff Backoff
+	Limits  *Backoff
+}
+
+// +default:generate=true
+type Backoff struct {
+	// +default="250ms"
+	Initial time.Duration
+	// +default=2
+	Factor float64
+}
+`,
+		"types_test.go": `package defaulted
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSetDefaults(t *testing.T) {
+	var worker Worker
+	worker.SetDefaults()
+
+	enabled, retries := true, uint32(3)
+	want := Worker{
+		Queue:       "default",
+		Concurrency: 4,
+		Priority:    -1,
+		Ratio:       0.5,
+		Enabled:     &enabled,
+		Timeout:     90 * time.Second,
+		Retries:     &retries,
+		Backoff:     Backoff{Initial: 250 * time.Millisecond, Factor: 2},
+	}
+	if !reflect.DeepEqual(worker, want) {
+		t.Errorf("SetDefaults() of the zero value = %+v, want %+v", worker, want)
+	}
+
+	// set fields are kept, pointers are kept even if they point to zero values
+	disabled, noRetries := false, uint32(0)
+	worker = Worker{
+		Queue:       "custom",
+		Concurrency: 1,
+		Enabled:     &disabled,
+		Retries:     &noRetries,
+		Backoff:     Backoff{Factor: 1.5},
+		Limits:      &Backoff{Initial: time.Second},
+	}
+	worker.SetDefaults()
+
+	want = Worker{
+		Queue:       "custom",
+		Concurrency: 1,
+		Priority:    -1,
+		Ratio:       0.5,
+		Enabled:     &disabled,
+		Timeout:     90 * time.Second,
+		Retries:     &noRetries,
+		Backoff:     Backoff{Initial: 250 * time.Millisecond, Factor: 1.5},
+		Limits:      &Backoff{Initial: time.Second, Factor: 2},
+	}
+	if !reflect.DeepEqual(worker, want) {
+		t.Errorf("SetDefaults() = %+v, want %+v", worker, want)
+	}
+	if *worker.Enabled || worker.Enabled != &disabled {
+		t.Errorf("SetDefaults() replaced a pointer to false")
+	}
+}
+`,
+	}, "default").succeeded(t).test(t)
+}
+
+func TestDefaultsInvalidValue(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package defaulted
+
+// +default:generate=true
+type Worker struct {
+	// +default=300
+	Priority int8
+}
+`,
+	}, "default").failedWith(t, "invalid default value 300 of field Priority: 300 overflows int8")
+}
@@ -0,0 +1,213 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// diagnosticCode identifies a kind of problem found in the marked code. Codes
+// are stable, so they can be looked up in the README, or matched by scripts.
+type diagnosticCode string
+
+const (
+	// codeUnknownType is reported for types that failed to type-check.
+	codeUnknownType diagnosticCode = "SC001"
+	// codeInvalidMarker is reported for markers with unsupported or conflicting values.
+	codeInvalidMarker diagnosticCode = "SC002"
+	// codeUnsupportedType is reported for types of a kind the generator can't handle.
+	codeUnsupportedType diagnosticCode = "SC003"
+	// codeUnsupportedOption is reported for options that don't apply to the marked type.
+	codeUnsupportedOption diagnosticCode = "SC004"
+	// codeMissingMethod is reported when a method the generated code calls is missing.
+	codeMissingMethod diagnosticCode = "SC005"
+	// codeCollision is reported when a generated name is already taken.
+	codeCollision diagnosticCode = "SC006"
+	// codeInvalidTag is reported for unsupported struct tag values.
+	codeInvalidTag diagnosticCode = "SC007"
+	// codeUncopyableField is reported for fields that can't be deep copied.
+	codeUncopyableField diagnosticCode = "SC008"
+	// codeConfig is reported for types listed in the config file that can't be generated.
+	codeConfig diagnosticCode = "SC009"
+	// codeUncomparableField is reported for fields that can't be compared.
+	codeUncomparableField diagnosticCode = "SC011"
+	// codeTemplate is reported for templates that fail to produce Go code.
+	codeTemplate diagnosticCode = "SC012"
+
+	// codeUnexportedType is reported for marked types that are skipped because they're unexported.
+	codeUnexportedType diagnosticCode = "SC101"
+	// codeSharedField is reported for fields that the copy keeps sharing with the original.
+	codeSharedField diagnosticCode = "SC102"
+)
+
+// strictDiagnostics turns warnings into errors, failing the run.
+var strictDiagnostics bool
+
+// diagnostic is a problem found in the marked code, with the marker it
+// concerns (if any), and a suggestion on how to fix it.
+type diagnostic struct {
+	Code       diagnosticCode
+	Warning    bool
+	Marker     string
+	Message    string
+	Suggestion string
+}
+
+// newDiagnostic returns an error diagnostic with the given code, concerning
+// the given marker (nil if none).
+func newDiagnostic(code diagnosticCode, marker *markers.Definition, suggestion string, format string, args ...interface{}) diagnostic {
+	d := diagnostic{Code: code, Message: fmt.Sprintf(format, args...), Suggestion: suggestion}
+	if marker != nil {
+		d.Marker = marker.Name
+	}
+
+	return d
+}
+
+// prefixed returns the diagnostic with its message prefixed by the given
+// context (e.g. the field it's about).
+func (d diagnostic) prefixed(context string) diagnostic {
+	d.Message = context + ": " + d.Message
+
+	return d
+}
+
+// Error formats the diagnostic as "<severity> <code> (+<marker>): <message>; <suggestion>".
+func (d diagnostic) Error() string {
+	var b strings.Builder
+
+	if d.Warning {
+		b.WriteString("warning ")
+	} else {
+		b.WriteString("error ")
+	}
+	b.WriteString(string(d.Code))
+
+	if d.Marker != "" {
+		fmt.Fprintf(&b, " (+%s)", d.Marker)
+	}
+
+	fmt.Fprintf(&b, ": %s", d.Message)
+
+	if d.Suggestion != "" {
+		fmt.Fprintf(&b, "; %s", d.Suggestion)
+	}
+
+	return b.String()
+}
+
+// reportedDiagnostics collects the diagnostics of a run until it's finished,
+// they may be reported by several workers at the same time.
+var reportedDiagnostics struct {
+	sync.Mutex
+	diagnostics []positionedDiagnostic
+}
+
+// positionedDiagnostic is a reported diagnostic with its package and position.
+type positionedDiagnostic struct {
+	pkg        *loader.Package
+	position   token.Position
+	diagnostic diagnostic
+}
+
+// report attaches the given diagnostic to the position of the given node.
+//
+// Errors are added to the package, like any other error. Warnings are printed
+// after the run (see printWarnings) without failing it, unless they're strict.
+// Generators sharing code (e.g. equal and diff) may find the same problem, it's
+// only reported once.
+func report(pkg *loader.Package, node ast.Node, d diagnostic) {
+	position := pkg.Fset.Position(node.Pos())
+
+	reportedDiagnostics.Lock()
+	defer reportedDiagnostics.Unlock()
+
+	for _, reported := range reportedDiagnostics.diagnostics {
+		if reported.position == position && reported.diagnostic == d {
+			return
+		}
+	}
+
+	if !d.Warning || strictDiagnostics {
+		pkg.AddError(loader.ErrFromNode(d, node))
+	}
+
+	reportedDiagnostics.diagnostics = append(reportedDiagnostics.diagnostics, positionedDiagnostic{pkg: pkg, position: position, diagnostic: d})
+}
+
+// reportOnType reports the given error of generating code for the given type,
+// which has to be a diagnostic, prefixing its message with the name of the type.
+func reportOnType(pkg *loader.Package, info *markers.TypeInfo, err error) {
+	report(pkg, info.RawSpec, err.(diagnostic).prefixed(info.Name))
+}
+
+// warn reports the given diagnostic as a warning.
+func warn(pkg *loader.Package, node ast.Node, d diagnostic) {
+	d.Warning = true
+
+	report(pkg, node, d)
+}
+
+// takeDiagnostics returns the diagnostics reported since it was last called,
+// sorted by position.
+func takeDiagnostics() []positionedDiagnostic {
+	reportedDiagnostics.Lock()
+	diagnostics := reportedDiagnostics.diagnostics
+	reportedDiagnostics.diagnostics = nil
+	reportedDiagnostics.Unlock()
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].position, diagnostics[j].position
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		return a.Column < b.Column
+	})
+
+	return diagnostics
+}
+
+// printWarnings prints the warnings among the given diagnostics (errors are
+// printed with the other errors of the packages).
+func printWarnings(out io.Writer, diagnostics []positionedDiagnostic) {
+	for _, d := range diagnostics {
+		if d.diagnostic.Warning && !strictDiagnostics {
+			fmt.Fprintf(out, "%s: %v\n", d.position, d.diagnostic)
+		}
+	}
+}
+
+// fieldNode returns the node of the field at the given index of the type for
+// positioning diagnostics, or the type itself if it's not known.
+func fieldNode(info *markers.TypeInfo, i int) ast.Node {
+	if i < len(info.Fields) && info.Fields[i].RawField != nil {
+		return info.Fields[i].RawField
+	}
+
+	return info.RawSpec
+}
@@ -0,0 +1,162 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+const (
+	// diffMethod is the name of the generated method.
+	diffMethod = "Diff"
+
+	// fieldDiffType is the name of the type describing a differing field, generated once per package.
+	fieldDiffType = "FieldDiff"
+)
+
+var (
+	enableDiffTypeMarker = markers.Must(markers.MakeDefinition("diff:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("diff", DiffGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// DiffGenerator generates code containing Diff method implementations,
+// listing the fields that differ between two values (e.g. for audit logs).
+//
+// Fields are compared like the equal generator does, and a FieldDiff type
+// holding the name and the old and new values of a field is generated in each
+// package.
+type DiffGenerator struct{}
+
+func (DiffGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableDiffTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableDiffTypeMarker,
+		markers.SimpleHelp("object", "enables or disables Diff implementation generation for this type"),
+	)
+
+	return nil
+}
+
+func (DiffGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableDiffTypeMarker, "zz_generated.diff.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		if root.Types.Scope().Lookup(fieldDiffType) != nil {
+			report(root, structs[0].Info.RawSpec, newDiagnostic(codeCollision, enableDiffTypeMarker, "rename it",
+				"%s collides with an existing declaration in package %s", fieldDiffType, root.PkgPath))
+
+			return
+		}
+
+		// compare using Equal methods generated in the same run as well
+		equalGenerated, err := markedTypeNames(ctx.Collector, root, enableEqualTypeMarker)
+		if err != nil {
+			root.AddError(err)
+
+			return
+		}
+
+		comparer := &equalComparer{
+			pkg:       root,
+			generated: equalGenerated,
+			visiting:  make(map[*types.Named]bool),
+		}
+
+		code.Commentf("%s is a field that differs between two values.", fieldDiffType)
+		code.Type().Id(fieldDiffType).Struct(
+			jen.Comment("Field is the name of the field."),
+			jen.Id("Field").String(),
+			jen.Comment("Old is the value of the field in the receiver of Diff."),
+			jen.Id("Old").Interface(),
+			jen.Comment("New is the value of the field in the other value."),
+			jen.Id("New").Interface(),
+		)
+
+		for _, s := range structs {
+			if err := generateDiff(code, root, comparer, s); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+	})
+}
+
+// generateDiff generates the Diff method of the given struct. The returned
+// errors are diagnostics.
+func generateDiff(code *jen.File, pkg *loader.Package, comparer *equalComparer, s markedStruct) error {
+	if _, ind, _ := types.LookupFieldOrMethod(s.Type, true, pkg.Types, diffMethod); len(ind) == 1 {
+		return newDiagnostic(codeCollision, enableDiffTypeMarker, "rename it", "%s collides with an existing field or method", diffMethod)
+	}
+
+	body := []jen.Code{jen.Var().Id("diffs").Index().Id(fieldDiffType)}
+
+	for i := 0; i < s.Struct.NumFields(); i++ {
+		field := s.Struct.Field(i)
+
+		if field.Name() == "_" {
+			continue
+		}
+
+		ours := func() *jen.Statement { return jen.Id("o").Dot(field.Name()) }
+		theirs := func() *jen.Statement { return jen.Id("other").Dot(field.Name()) }
+
+		var differs jen.Code
+
+		switch {
+		case comparer.hasEqual(field.Type()):
+			differs = jen.Op("!").Add(ours()).Dot(equalMethod).Call(theirs())
+
+		case isComparedDirectly(field.Type()):
+			differs = ours().Op("!=").Add(theirs())
+
+		default:
+			// the comparison returns false from the enclosing function when the values differ
+			compare, err := comparer.compare(ours, theirs, field.Type(), 0)
+			if err != nil {
+				return uncomparableField(field, err)
+			}
+
+			differs = jen.Op("!").Func().Params().Bool().Block(append(compare, jen.Return(jen.True()))...).Call()
+		}
+
+		body = append(body, jen.If(differs).Block(
+			jen.Id("diffs").Op("=").Append(jen.Id("diffs"), jen.Id(fieldDiffType).Values(orderedDict([]keyValue{
+				{Key: "Field", Value: jen.Lit(field.Name())},
+				{Key: "Old", Value: ours()},
+				{Key: "New", Value: theirs()},
+			})...)),
+		))
+	}
+
+	code.Commentf("%s returns the fields of o and other that differ, in declaration order.", diffMethod)
+	code.Func().
+		Params(jen.Id("o").Id(s.Info.Name)).
+		Id(diffMethod).
+		Params(jen.Id("other").Id(s.Info.Name)).
+		Params(jen.Index().Id(fieldDiffType)).
+		Block(append(body, jen.Return(jen.Id("diffs")))...)
+
+	return nil
+}
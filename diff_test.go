@@ -0,0 +1,80 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package diffed
+
+import "time"
+
+// +diff:generate=true
+type Deployment struct {
+	Image    string
+	Replicas *int
+	Timeout  time.Duration
+	Started  time.Time
+	Env      []string
+	Labels   map[string]string
+}
+`,
+		"types_test.go": `package diffed
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	one, otherOne, two := 1, 1, 2
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	old := Deployment{Image: "app:1", Replicas: &one, Timeout: time.Second, Started: started, Env: []string{"A=1"}, Labels: map[string]string{"a": "b"}}
+
+	same := old
+	same.Replicas, same.Started, same.Env = &otherOne, started.In(time.FixedZone("CET", 3600)), []string{"A=1"}
+	if diffs := old.Diff(same); len(diffs) != 0 {
+		t.Errorf("Diff() of equal values = %+v, want no differences", diffs)
+	}
+
+	changed := old
+	changed.Image, changed.Replicas, changed.Labels = "app:2", &two, nil
+
+	want := []FieldDiff{
+		{Field: "Image", Old: "app:1", New: "app:2"},
+		{Field: "Replicas", Old: &one, New: &two},
+		{Field: "Labels", Old: map[string]string{"a": "b"}, New: map[string]string(nil)},
+	}
+	if diffs := old.Diff(changed); !reflect.DeepEqual(diffs, want) {
+		t.Errorf("Diff() = %+v, want %+v", diffs, want)
+	}
+	if diffs := old.Diff(changed); diffs[1].Old != &one || diffs[1].New != &two {
+		t.Errorf("Diff() reports the values %v and %v, want the fields themselves", diffs[1].Old, diffs[1].New)
+	}
+
+	// the differences are listed in declaration order
+	reversed := changed.Diff(old)
+	if len(reversed) != 3 || reversed[0].Field != "Image" || reversed[0].Old != "app:2" || reversed[2].Field != "Labels" {
+		t.Errorf("Diff() the other way = %+v, want the fields in declaration order with their values swapped", reversed)
+	}
+}
+`,
+	}, "diff").succeeded(t).test(t)
+}
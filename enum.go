@@ -0,0 +1,200 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/constant"
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+var (
+	enableEnumTypeMarker = markers.Must(markers.MakeDefinition("enum:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("enum", EnumGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// EnumGenerator generates code for integer and string types with constants
+// declared in the same package, containing the IsValid, MarshalText and
+// UnmarshalText methods, and the <Type>Values and Parse<Type> functions.
+//
+// The text form of the constants of string types is their value, for integer
+// types it's the name of the constant (the first one declared for aliases).
+type EnumGenerator struct{}
+
+func (EnumGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableEnumTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableEnumTypeMarker,
+		markers.SimpleHelp("object", "enables or disables enum method and function generation for this type"),
+	)
+
+	return nil
+}
+
+func (EnumGenerator) Generate(ctx *genall.GenerationContext) error {
+	for _, root := range ctx.Roots {
+		infos, err := markedTypes(ctx, root, enableEnumTypeMarker)
+		if err != nil {
+			root.AddError(err)
+			return nil
+		}
+
+		if len(infos) == 0 {
+			continue
+		}
+
+		code := jen.NewFile(root.Name)
+
+		for _, info := range infos {
+			typeInfo := root.TypesInfo.TypeOf(info.RawSpec.Name)
+			if typeInfo == types.Typ[types.Invalid] {
+				report(root, info.RawSpec, newDiagnostic(codeUnknownType, nil, "fix the type errors of the package first", "unknown type %s", info.Name))
+
+				continue
+			}
+
+			if reportGeneric(root, info, typeInfo, enableEnumTypeMarker) {
+				continue
+			}
+
+			if err := generateEnum(code, root, info.Name, typeInfo); err != nil {
+				reportOnType(root, info, err)
+			}
+		}
+
+		renderOut(ctx, root, code, "zz_generated.enum.go", "")
+	}
+
+	return nil
+}
+
+// generateEnum generates the methods and functions of the given integer or
+// string type. The returned errors are diagnostics.
+func generateEnum(code *jen.File, pkg *loader.Package, name string, t types.Type) error {
+	basic, isBasic := t.Underlying().(*types.Basic)
+	if !isBasic || basic.Info()&(types.IsInteger|types.IsString) == 0 {
+		return newDiagnostic(codeUnsupportedType, enableEnumTypeMarker, "remove the marker", "only integer and string types can be enums")
+	}
+	isString := basic.Info()&types.IsString != 0
+
+	for _, method := range []string{"IsValid", "MarshalText", "UnmarshalText"} {
+		if _, ind, _ := types.LookupFieldOrMethod(t, true, pkg.Types, method); len(ind) == 1 {
+			return newDiagnostic(codeCollision, enableEnumTypeMarker, "rename it", "%s collides with an existing field or method", method)
+		}
+	}
+
+	valuesFunc, parseFunc := name+"Values", "Parse"+name
+	for _, function := range []string{valuesFunc, parseFunc} {
+		if pkg.Types.Scope().Lookup(function) != nil {
+			return newDiagnostic(codeCollision, enableEnumTypeMarker, "rename it", "%s collides with an existing declaration", function)
+		}
+	}
+
+	consts := typeConstants(pkg, t)
+	if len(consts) == 0 {
+		return newDiagnostic(codeUnsupportedType, enableEnumTypeMarker, fmt.Sprintf("declare constants of type %s", name), "no constants are declared")
+	}
+
+	values := make([]jen.Code, 0, len(consts))
+	marshalCases := make([]jen.Code, 0, len(consts))
+	parseCases := make([]jen.Code, 0, len(consts))
+
+	for _, c := range consts {
+		values = append(values, jen.Id(c.Name()))
+
+		// string constants are written as their values, like when converted
+		text := c.Name()
+		if isString {
+			text = constant.StringVal(c.Val())
+		}
+
+		marshalCases = append(marshalCases, jen.Case(jen.Id(c.Name())).Block(jen.Return(jen.Index().Byte().Call(jen.Lit(text)), jen.Nil())))
+		parseCases = append(parseCases, jen.Case(jen.Lit(text)).Block(jen.Return(jen.Id(c.Name()), jen.Nil())))
+	}
+
+	var zero, invalid jen.Code
+	if isString {
+		zero, invalid = jen.Lit(""), jen.Lit("invalid "+name+" %q")
+	} else {
+		zero, invalid = jen.Lit(0), jen.Lit("invalid "+name+" %d")
+	}
+
+	code.Commentf("IsValid checks if v is one of the %s constants.", name)
+	code.Func().
+		Params(jen.Id("v").Id(name)).
+		Id("IsValid").
+		Params().
+		Params(jen.Bool()).
+		Block(
+			jen.Switch(jen.Id("v")).Block(jen.Case(values...).Block(jen.Return(jen.True()))),
+			jen.Return(jen.False()),
+		)
+
+	code.Commentf("%s returns the %s constants, in the order of declaration.", valuesFunc, name)
+	code.Func().
+		Id(valuesFunc).
+		Params().
+		Params(jen.Index().Id(name)).
+		Block(jen.Return(jen.Index().Id(name).Values(values...)))
+
+	code.Commentf("%s returns the %s constant written as s.", parseFunc, name)
+	code.Func().
+		Id(parseFunc).
+		Params(jen.Id("s").String()).
+		Params(jen.Id(name), jen.Error()).
+		Block(
+			jen.Switch(jen.Id("s")).Block(parseCases...),
+			jen.Return(zero, jen.Qual("fmt", "Errorf").Call(jen.Lit("invalid "+name+" %q"), jen.Id("s"))),
+		)
+
+	code.Commentf("MarshalText implements encoding.TextMarshaler, failing for values other than the %s constants.", name)
+	code.Func().
+		Params(jen.Id("v").Id(name)).
+		Id("MarshalText").
+		Params().
+		Params(jen.Index().Byte(), jen.Error()).
+		Block(
+			jen.Switch(jen.Id("v")).Block(marshalCases...),
+			jen.Return(jen.Nil(), jen.Qual("fmt", "Errorf").Call(invalid, jen.Id("v"))),
+		)
+
+	code.Commentf("UnmarshalText implements encoding.TextUnmarshaler, using %s.", parseFunc)
+	code.Func().
+		Params(jen.Id("v").Op("*").Id(name)).
+		Id("UnmarshalText").
+		Params(jen.Id("text").Index().Byte()).
+		Params(jen.Error()).
+		Block(
+			jen.List(jen.Id("parsed"), jen.Err()).Op(":=").Id(parseFunc).Call(jen.String().Call(jen.Id("text"))),
+			jen.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Err())),
+			jen.Id("*v").Op("=").Id("parsed"),
+			jen.Return(jen.Nil()),
+		)
+
+	return nil
+}
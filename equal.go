@@ -0,0 +1,323 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// equalMethod is the name of the generated method.
+const equalMethod = "Equal"
+
+var (
+	enableEqualTypeMarker = markers.Must(markers.MakeDefinition("equal:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("equal", EqualGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// EqualGenerator generates code containing Equal method implementations.
+//
+// Slices and maps are equal if they have the same length and equal elements
+// (so nil and empty ones are equal), pointers are equal if they point to
+// equal values, and types having an Equal method themselves (e.g. time.Time)
+// are compared using it.
+type EqualGenerator struct{}
+
+func (EqualGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableEqualTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableEqualTypeMarker,
+		markers.SimpleHelp("object", "enables or disables Equal implementation generation for this type"),
+	)
+
+	return nil
+}
+
+func (EqualGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableEqualTypeMarker, "zz_generated.equal.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		comparer := &equalComparer{
+			pkg:       root,
+			generated: make(map[string]bool, len(structs)),
+			visiting:  make(map[*types.Named]bool),
+		}
+		for _, s := range structs {
+			comparer.generated[s.Info.Name] = true
+		}
+
+		for _, s := range structs {
+			var body []jen.Code
+			var err error
+
+			for i := 0; i < s.Struct.NumFields(); i++ {
+				field := s.Struct.Field(i)
+
+				if field.Name() == equalMethod {
+					err = newDiagnostic(codeCollision, nil, "rename the field", "field %s collides with the generated %s method", field.Name(), equalMethod)
+
+					break
+				}
+
+				var fieldBody []jen.Code
+				fieldBody, err = comparer.compare(
+					func() *jen.Statement { return jen.Id("o").Dot(field.Name()) },
+					func() *jen.Statement { return jen.Id("other").Dot(field.Name()) },
+					field.Type(), 0,
+				)
+				if err != nil {
+					err = uncomparableField(field, err)
+
+					break
+				}
+
+				body = append(body, fieldBody...)
+			}
+			if err != nil {
+				reportOnType(root, s.Info, err)
+
+				continue
+			}
+
+			code.Comment("Equal reports whether o and other are equal, comparing them field by field.")
+			code.Func().
+				Params(jen.Id("o").Id(s.Info.Name)).
+				Id(equalMethod).
+				Params(jen.Id("other").Id(s.Info.Name)).
+				Params(jen.Bool()).
+				Block(append(body, jen.Return(jen.True()))...)
+		}
+	})
+}
+
+// uncomparableField returns the diagnostic of failing to compare the given
+// field, which equal and diff report alike (so it's reported once).
+func uncomparableField(field *types.Var, err error) diagnostic {
+	return newDiagnostic(codeUncomparableField, nil, "", "field %s: %v", field.Name(), err)
+}
+
+// equalComparer emits the statements comparing values of a given type,
+// returning false from the enclosing function when they differ.
+type equalComparer struct {
+	pkg *loader.Package
+	// generated lists the types Equal methods are generated for in this package.
+	generated map[string]bool
+	// visiting guards against recursing forever into named types without Equal methods.
+	visiting map[*types.Named]bool
+}
+
+// hasEqual checks if the given type has (or will have) an Equal method.
+func (c *equalComparer) hasEqual(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed {
+		return false
+	}
+
+	if named.Obj().Pkg() == c.pkg.Types && c.generated[named.Obj().Name()] {
+		return true
+	}
+
+	return hasEqualMethod(named)
+}
+
+// hasEqualMethod checks if the given type has an Equal(T) bool method (like time.Time).
+func hasEqualMethod(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed {
+		return false
+	}
+
+	method, ind, _ := types.LookupFieldOrMethod(named, true /* check pointers too */, named.Obj().Pkg(), equalMethod)
+	if len(ind) != 1 {
+		// ignore embedded methods, they only compare the embedded value
+		return false
+	}
+
+	methodFunc, isFunc := method.(*types.Func)
+	if !isFunc {
+		return false
+	}
+
+	methodSig := methodFunc.Type().(*types.Signature)
+	if methodSig.Params().Len() != 1 || methodSig.Results().Len() != 1 {
+		return false
+	}
+
+	return types.Identical(methodSig.Params().At(0).Type(), named) &&
+		types.Identical(methodSig.Results().At(0).Type(), types.Typ[types.Bool])
+}
+
+// compare returns the statements returning false if a and b (of the given type) differ.
+//
+// The depth is the loop nesting level, used for naming loop variables.
+func (c *equalComparer) compare(a, b func() *jen.Statement, t types.Type, depth int) ([]jen.Code, error) {
+	notEqual := func(cond jen.Code) []jen.Code {
+		return []jen.Code{jen.If(cond).Block(jen.Return(jen.False()))}
+	}
+
+	if c.hasEqual(t) {
+		return notEqual(jen.Op("!").Add(a()).Dot(equalMethod).Call(b())), nil
+	}
+
+	if named, isNamed := t.(*types.Named); isNamed {
+		if c.visiting[named] {
+			return nil, fmt.Errorf("recursive type %s needs an Equal method", named.Obj().Name())
+		}
+
+		c.visiting[named] = true
+		defer delete(c.visiting, named)
+	}
+
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic, *types.Chan:
+		return notEqual(a().Op("!=").Add(b())), nil
+
+	case *types.Interface:
+		return notEqual(jen.Op("!").Qual("reflect", "DeepEqual").Call(a(), b())), nil
+
+	case *types.Signature:
+		return nil, fmt.Errorf("cannot compare function type %s", t)
+
+	case *types.Pointer:
+		var elem []jen.Code
+
+		if c.hasEqual(underlying.Elem()) {
+			elem = notEqual(jen.Op("!").Parens(jen.Op("*").Add(a())).Dot(equalMethod).Call(jen.Op("*").Add(b())))
+		} else if isComparedDirectly(underlying.Elem()) {
+			elem = notEqual(jen.Op("*").Add(a()).Op("!=").Op("*").Add(b()))
+		} else {
+			var err error
+			elem, err = c.compare(
+				func() *jen.Statement { return jen.Parens(jen.Op("*").Add(a())) },
+				func() *jen.Statement { return jen.Parens(jen.Op("*").Add(b())) },
+				underlying.Elem(), depth,
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		stmts := notEqual(jen.Parens(a().Op("==").Nil()).Op("!=").Parens(b().Op("==").Nil()))
+
+		return append(stmts, jen.If(a().Op("!=").Nil()).Block(elem...)), nil
+
+	case *types.Slice, *types.Array:
+		var elemType types.Type
+		if slice, isSlice := underlying.(*types.Slice); isSlice {
+			elemType = slice.Elem()
+		} else {
+			elemType = underlying.(*types.Array).Elem()
+		}
+
+		index := loopVar("i", depth)
+		elem, err := c.compare(
+			func() *jen.Statement { return a().Index(jen.Id(index)) },
+			func() *jen.Statement { return b().Index(jen.Id(index)) },
+			elemType, depth+1,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		var stmts []jen.Code
+		if _, isSlice := underlying.(*types.Slice); isSlice {
+			stmts = notEqual(jen.Len(a()).Op("!=").Len(b()))
+		}
+
+		return append(stmts, jen.For(jen.Id(index).Op(":=").Range().Add(a())).Block(elem...)), nil
+
+	case *types.Map:
+		key, val, otherVal := loopVar("key", depth), loopVar("val", depth), loopVar("otherVal", depth)
+		elem, err := c.compare(
+			func() *jen.Statement { return jen.Id(val) },
+			func() *jen.Statement { return jen.Id(otherVal) },
+			underlying.Elem(), depth+1,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		stmts := notEqual(jen.Len(a()).Op("!=").Len(b()))
+
+		return append(stmts, jen.For(jen.List(jen.Id(key), jen.Id(val)).Op(":=").Range().Add(a())).Block(
+			append([]jen.Code{
+				jen.List(jen.Id(otherVal), jen.Id("ok")).Op(":=").Add(b()).Index(jen.Id(key)),
+				jen.If(jen.Op("!").Id("ok")).Block(jen.Return(jen.False())),
+			}, elem...)...,
+		)), nil
+
+	case *types.Struct:
+		var stmts []jen.Code
+
+		for i := 0; i < underlying.NumFields(); i++ {
+			field := underlying.Field(i)
+
+			if !field.Exported() && field.Pkg() != c.pkg.Types {
+				// we can't get to the fields, but the type might still be comparable
+				if types.Comparable(t) {
+					return notEqual(a().Op("!=").Add(b())), nil
+				}
+
+				return nil, fmt.Errorf("cannot compare unexported field %s of %s", field.Name(), t)
+			}
+
+			fieldStmts, err := c.compare(
+				func() *jen.Statement { return a().Dot(field.Name()) },
+				func() *jen.Statement { return b().Dot(field.Name()) },
+				field.Type(), depth,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			stmts = append(stmts, fieldStmts...)
+		}
+
+		return stmts, nil
+
+	default:
+		return nil, fmt.Errorf("cannot compare type %s", t)
+	}
+}
+
+// isComparedDirectly checks if values of the given type are compared using the != operator.
+func isComparedDirectly(t types.Type) bool {
+	switch t.Underlying().(type) {
+	case *types.Basic, *types.Chan:
+		return true
+	default:
+		return false
+	}
+}
+
+// loopVar returns the name of a loop variable at the given nesting level.
+func loopVar(name string, depth int) string {
+	if depth == 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s%d", name, depth)
+}
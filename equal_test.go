@@ -0,0 +1,123 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package equaled
+
+import "time"
+
+// +equal:generate=true
+type Config struct {
+	Name     string
+	Replicas *int
+	Tags     []string
+	Labels   map[string]string
+	Matrix   [2][]int
+	Started  time.Time
+	Inner    Inner
+	Any      interface{}
+	Done     chan struct{}
+}
+
+type Inner struct {
+	Weights []float64
+}
+`,
+		"types_test.go": `package equaled
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEqual(t *testing.T) {
+	one, otherOne, two := 1, 1, 2
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	done := make(chan struct{})
+
+	base := func() Config {
+		return Config{
+			Name:     "name",
+			Replicas: &one,
+			Tags:     []string{"a", "b"},
+			Labels:   map[string]string{"a": "b"},
+			Matrix:   [2][]int{{1}, {2}},
+			Started:  started,
+			Inner:    Inner{Weights: []float64{0.5}},
+			Any:      []int{1},
+			Done:     done,
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		change func(c *Config)
+		equal  bool
+	}{
+		{name: "same", change: func(c *Config) {}, equal: true},
+		{name: "pointer to an equal value", change: func(c *Config) { c.Replicas = &otherOne }, equal: true},
+		{name: "another location of the instant", change: func(c *Config) { c.Started = started.In(time.FixedZone("CET", 3600)) }, equal: true},
+		{name: "no elements", change: func(c *Config) { c.Tags, c.Labels = nil, nil }},
+		{name: "name", change: func(c *Config) { c.Name = "other" }},
+		{name: "pointed value", change: func(c *Config) { c.Replicas = &two }},
+		{name: "nil pointer", change: func(c *Config) { c.Replicas = nil }},
+		{name: "slice element", change: func(c *Config) { c.Tags = []string{"a", "c"} }},
+		{name: "slice length", change: func(c *Config) { c.Tags = []string{"a"} }},
+		{name: "map value", change: func(c *Config) { c.Labels = map[string]string{"a": "c"} }},
+		{name: "map key", change: func(c *Config) { c.Labels = map[string]string{"b": "b"} }},
+		{name: "array element", change: func(c *Config) { c.Matrix[1] = []int{3} }},
+		{name: "time", change: func(c *Config) { c.Started = started.Add(time.Second) }},
+		{name: "nested struct", change: func(c *Config) { c.Inner.Weights = []float64{1} }},
+		{name: "interface", change: func(c *Config) { c.Any = []int{2} }},
+		{name: "channel", change: func(c *Config) { c.Done = make(chan struct{}) }},
+	} {
+		changed := base()
+		test.change(&changed)
+
+		if got := base().Equal(changed); got != test.equal {
+			t.Errorf("%s: Equal() = %v, want %v", test.name, got, test.equal)
+		}
+		if got := changed.Equal(base()); got != test.equal {
+			t.Errorf("%s: Equal() the other way = %v, want %v", test.name, got, test.equal)
+		}
+	}
+
+	// nil and empty slices and maps are equal
+	if !(Config{Tags: []string{}, Labels: map[string]string{}}).Equal(Config{}) {
+		t.Error("Equal() tells empty slices and maps from nil ones")
+	}
+}
+`,
+	}, "equal").succeeded(t).test(t)
+}
+
+func TestEqualUncomparableField(t *testing.T) {
+	generateTestPackage(t, map[string]string{
+		"types.go": `package equaled
+
+// +equal:generate=true
+type Config struct {
+	Name     string
+	Callback func()
+}
+`,
+	}, "equal").failedWith(t, string(codeUncomparableField)+": Config: field Callback")
+}
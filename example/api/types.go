@@ -0,0 +1,33 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api contains types whose generated code is kept out of the package,
+// in its generated sub-package (see the package option of shallowcopy).
+// +shallowcopy:generate=package
+package api
+
+type Widget struct {
+	Name   string
+	Labels map[string]string
+	Parts  []Part
+}
+
+type Part struct {
+	ID     string
+	Weight float64
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:elements=true
+type Inventory map[string]int
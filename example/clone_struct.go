@@ -0,0 +1,30 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+// Cloner is implemented by values copied by their Clone method.
+type Cloner[T any] interface {
+	Clone() T
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:name=Clone
+// +shallowcopy:generate:into=true
+// +shallowcopy:generate:tests=true
+// +shallowcopy:generate:implements=Cloner[Profile]
+type Profile struct {
+	Name   string
+	Scopes []string
+}
@@ -0,0 +1,42 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+// Cluster is converted to (and from) its older v1alpha1 version by the convert generator.
+type Cluster struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	Spec        ClusterSpec
+	Pools       []NodePool
+	Primary     *NodePool
+	Phase       ClusterPhase
+	Status      string
+}
+
+type ClusterSpec struct {
+	Version  string
+	Replicas int32
+	Timeout  *int32
+	Limits   map[string]int32
+}
+
+type NodePool struct {
+	Name  string
+	Size  int32
+	Zones [2]string
+}
+
+type ClusterPhase string
@@ -0,0 +1,40 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+import "time"
+
+// +deepcopy:generate=true
+// +deepcopy:generate:acyclic=true
+type Node struct {
+	Name     string
+	Labels   map[string]string
+	Children []Node
+	Next     *Node
+	Weight   *int
+	Matrix   [][]int
+	Index    map[string][]*Node
+	Meta     Meta
+}
+
+type Meta struct {
+	Tags     []string
+	Owner    *string
+	Created  time.Time
+	Deadline *time.Time
+}
+
+// +deepcopy:generate=true
+type NodeList []*Node
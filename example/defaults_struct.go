@@ -0,0 +1,45 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+import "time"
+
+// +default:generate=true
+type WorkerConfig struct {
+	// +default="default"
+	Queue string
+	// +default=4
+	Concurrency int
+	// +default=-1
+	Priority int8
+	// +default=0.5
+	Ratio float64
+	// +default=true
+	Enabled *bool
+	// +default="1m30s"
+	Timeout time.Duration
+	// +default=3
+	Retries *uint32
+	Backoff BackoffConfig
+	Limits  *BackoffConfig
+}
+
+// +default:generate=true
+type BackoffConfig struct {
+	// +default="250ms"
+	Initial time.Duration
+	// +default=2
+	Factor float64
+}
@@ -0,0 +1,31 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:into=true
+type Pair[K comparable, V any] struct {
+	Key    K
+	Value  V
+	Values map[K][]V
+	Next   *Pair[K, V]
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:receiver=pointer
+type Box[T any] struct {
+	Item  T
+	Pairs []Pair[string, T]
+}
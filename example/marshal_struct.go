@@ -0,0 +1,55 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+import "time"
+
+// +marshal:generate=true
+type AuditEvent struct {
+	ID        string    `json:"id"`
+	Kind      Protocol  `json:"kind"`
+	Count     int64     `json:"count,string"`
+	Score     float32   `json:"score,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Payload   []byte    `json:"payload"`
+	Source    *Endpoint `json:"source"`
+	Targets   []Endpoint
+	Attempts  map[string]int     `json:"attempts,omitempty"`
+	Window    [2]time.Duration   `json:"window"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Labels    map[string]*string `json:"labels"`
+	secret    string
+	Ignored   bool `json:"-"`
+	AuditMeta
+	*Origin
+}
+
+// +marshal:generate=true
+type Endpoint struct {
+	Host string `json:"host"`
+	Port uint16 `json:"port,omitempty"`
+}
+
+// AuditMeta is embedded into AuditEvent, its fields are promoted.
+type AuditMeta struct {
+	Revision int `json:"revision"`
+	// ID is shadowed by AuditEvent.ID
+	ID string `json:"id"`
+}
+
+// Origin is embedded into AuditEvent through a pointer.
+type Origin struct {
+	Region string `json:"region,omitempty"`
+}
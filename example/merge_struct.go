@@ -0,0 +1,46 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+import "time"
+
+// +merge:generate=true
+type ServerSettings struct {
+	Host  string
+	Port  int
+	Debug bool
+	// +merge:always
+	TLS       bool
+	Timeout   time.Duration
+	StartedAt time.Time
+	Limits    Limits
+	Retry     RetryPolicy
+	Tags      []string
+	// +merge:deref
+	Replicas *int
+	Backup   *Limits
+	Labels   map[string]string
+}
+
+// +merge:generate=true
+type Limits struct {
+	CPU    string
+	Memory string
+}
+
+type RetryPolicy struct {
+	Attempts int
+	Codes    []int
+}
@@ -14,8 +14,97 @@
 
 package example
 
+import "errors"
+
 // +shallowcopy:generate=true
+// +shallowcopy:generate:into=true
 type MyStruct struct {
 	Field1 int
 	Field2 string
 }
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:validate-after=true
+// +shallowcopy:generate:fuzz=true
+// +shallowcopy:generate:tests=true
+// +shallowcopy:generate:into=true
+type ValidatedStruct struct {
+	Name string
+}
+
+func (s ValidatedStruct) Validate() error {
+	if s.Name == "" {
+		return errors.New("name must not be empty")
+	}
+
+	return nil
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:schema-version=true
+// +shallowcopy:generate:fuzz=true
+// +shallowcopy:generate:tests=true
+// +equal:generate=true
+type VersionedStruct struct {
+	ID     int64    `json:"id"`
+	Weight float64  `json:"weight"`
+	Name   Name     `json:"name"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+type Event struct {
+	Name string
+}
+
+// +shallowcopy:generate=true
+type Events chan Event
+
+// ShallowCopy aliases the channel, so that both copies share the same events.
+func (e Events) ShallowCopy() Events {
+	return e
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:into=true
+type Session struct {
+	ID    string
+	Token []byte
+}
+
+// ShallowCopy is implemented manually, so that the token isn't shared with
+// the copy. Only ShallowCopyInto is generated.
+func (s Session) ShallowCopy() Session {
+	return Session{ID: s.ID, Token: append([]byte(nil), s.Token...)}
+}
+
+type Name string
+
+// +shallowcopy:generate=true
+type Tags []string
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:elements=true
+type Annotations map[string]string
+
+type Cache struct {
+	Entries map[string]string
+}
+
+// +shallowcopy:generate=true
+type CachedStruct struct {
+	// +shallowcopy:skip
+	Cache
+	Field1 int
+	// +shallowcopy:ignore
+	lookups map[string]int
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:receiver=pointer
+// +shallowcopy:generate:into=true
+// +shallowcopy:generate:fuzz=true
+// +shallowcopy:generate:tests=true
+type PointerStruct struct {
+	Field1 int
+	Next   *PointerStruct
+}
@@ -0,0 +1,33 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+import "time"
+
+// +options:generate=true
+// +default:generate=true
+type ServerConfig struct {
+	// +default="localhost"
+	Host string
+	// +default=8080
+	Port int
+	TLS  bool
+	// +default="30s"
+	Timeout time.Duration
+	// +default=100
+	MaxConns *int
+	// +default=3
+	retries int
+}
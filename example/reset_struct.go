@@ -0,0 +1,35 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+// +reset:generate=true
+// +pool:generate=true
+type BatchRequest struct {
+	ID      string
+	Retries int
+	Meta
+	// +reset:keepCapacity
+	Items []string
+	// +reset:keepCapacity
+	Index   map[string]int
+	Headers map[string]string
+	buffer  [16]byte
+	done    bool
+}
+
+// +pool:generate=true
+type ScratchBuffer struct {
+	Data []byte
+}
@@ -0,0 +1,43 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:into=true
+// +shallowcopy:generate:tests=true
+type Document struct {
+	Title    string
+	Labels   map[string]string `copy:"deep"`
+	Sections []Section         `copy:"deep"`
+	Owner    *Meta             `copy:"deep"`
+	index    map[string]int    `copy:"-"`
+}
+
+type Section struct {
+	Name  string
+	Lines []string
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:receiver=pointer
+// +shallowcopy:generate:validate-after=true
+// +shallowcopy:generate:tests=true
+type ValidatedDocument struct {
+	Tags []string `copy:"deep"`
+}
+
+func (d *ValidatedDocument) Validate() error {
+	return nil
+}
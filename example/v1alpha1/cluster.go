@@ -0,0 +1,50 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package v1alpha1 contains the older version of the Cluster type of the example package.
+package v1alpha1
+
+// +convert:generate:to=example.Cluster
+// +convert:generate:ignore=Deprecated;Status
+type Cluster struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[AnnotationKey]string
+	Spec        ClusterSpec
+	Pools       []NodePool
+	Primary     *NodePool
+	Phase       Phase
+	Deprecated  bool
+}
+
+// +convert:generate:to=github.com/banzaicloud/go-code-generation-demo/example.ClusterSpec
+type ClusterSpec struct {
+	Version  string
+	Replicas Count
+	Timeout  *Count
+	Limits   map[string]Count
+}
+
+// +convert:generate:to=example.NodePool
+type NodePool struct {
+	Name  string
+	Size  Count
+	Zones [2]string
+}
+
+type AnnotationKey string
+
+type Phase string
+
+type Count int32
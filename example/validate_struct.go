@@ -0,0 +1,42 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+import "time"
+
+// +validate:generate=true
+type Tenant struct {
+	// +validate:required
+	// +validate:maxLen=64
+	// +validate:pattern=`^[a-z][a-z0-9-]*$`
+	Name string
+	// +validate:min=1
+	// +validate:max=10
+	Replicas int
+	// +validate:min=0.1
+	Ratio *float64
+	// +validate:min="1s"
+	Timeout time.Duration
+	// +validate:minLen=1
+	Owners []string
+	// +validate:required
+	Quota *StorageQuota
+}
+
+// +validate:generate=true
+type StorageQuota struct {
+	// +validate:max=1024
+	StorageGiB uint32
+}
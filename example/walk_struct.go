@@ -0,0 +1,32 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example
+
+// +walk:generate=true
+type AppConfig struct {
+	Name      string
+	Listeners []Listener
+	Primary   *Listener
+	Secrets   map[string]string
+	Ports     map[int]Listener
+	Matrix    [][]int
+	Meta
+}
+
+// +walk:generate=true
+type Listener struct {
+	Address string
+	TLS     *bool
+}
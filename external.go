@@ -0,0 +1,145 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+var (
+	externalPkgMarker = markers.Must(markers.MakeDefinition("shallowcopy:external", markers.DescribesPackage, externalType{}))
+)
+
+// externalType is a struct of an imported package to generate a standalone
+// ShallowCopy<Type> function for, as methods can only be declared in the
+// package of the type.
+type externalType struct {
+	// Package is the import path of the package declaring the type.
+	Package string
+	// Type is the name of the type.
+	Type string
+}
+
+// externalCopy is a resolved external type to generate a function for.
+type externalCopy struct {
+	FuncName string
+	Type     *types.Named
+	Fields   []string
+}
+
+// externalCopies resolves the external types requested by the package markers of the given package.
+func externalCopies(col *markers.Collector, pkg *loader.Package) ([]externalCopy, error) {
+	pkgMarkers, err := markers.PackageMarkers(col, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := make(map[string]*types.Package)
+	for _, importedPkg := range pkg.Types.Imports() {
+		imported[importedPkg.Path()] = importedPkg
+	}
+
+	var copies []externalCopy
+	funcs := make(map[string]string)
+
+	for _, value := range pkgMarkers[externalPkgMarker.Name] {
+		external := value.(externalType)
+		typeName := external.Package + "." + external.Type
+
+		if external.Package == pkg.PkgPath {
+			return nil, fmt.Errorf("%s is declared in this package, mark it with %s instead", typeName, enableTypeMarker.Name)
+		}
+
+		importedPkg, isImported := imported[external.Package]
+		if !isImported {
+			return nil, fmt.Errorf("package %s of %s has to be imported by %s", external.Package, typeName, pkg.PkgPath)
+		}
+
+		typeObj, isType := importedPkg.Scope().Lookup(external.Type).(*types.TypeName)
+		if !isType || !typeObj.Exported() {
+			return nil, fmt.Errorf("%s is not an exported type", typeName)
+		}
+
+		named, isNamed := typeObj.Type().(*types.Named)
+		if !isNamed || named.TypeParams().Len() > 0 {
+			return nil, fmt.Errorf("%s is not a named non-generic type", typeName)
+		}
+
+		stype, isStruct := named.Underlying().(*types.Struct)
+		if !isStruct {
+			return nil, fmt.Errorf("%s is not a struct type", typeName)
+		}
+
+		funcName := shallowCopyMethod + external.Type
+		if other, exists := funcs[funcName]; exists {
+			if other == typeName {
+				// repeating the marker is fine
+				continue
+			}
+
+			return nil, fmt.Errorf("%s of %s is already generated for %s", funcName, typeName, other)
+		}
+		funcs[funcName] = typeName
+
+		if pkg.Types.Scope().Lookup(funcName) != nil {
+			return nil, fmt.Errorf("%s of %s collides with an existing declaration", funcName, typeName)
+		}
+
+		fields := make([]string, 0, stype.NumFields())
+		for i := 0; i < stype.NumFields(); i++ {
+			field := stype.Field(i)
+
+			// copying field by field would silently lose these
+			if !field.Exported() {
+				return nil, fmt.Errorf("%s has unexported field %s, it can't be copied outside of its package", typeName, field.Name())
+			}
+
+			fields = append(fields, field.Name())
+		}
+
+		copies = append(copies, externalCopy{
+			FuncName: funcName,
+			Type:     named,
+			Fields:   fields,
+		})
+	}
+
+	sort.Slice(copies, func(i, j int) bool {
+		return copies[i].FuncName < copies[j].FuncName
+	})
+
+	return copies, nil
+}
+
+// generateExternalCopy generates the standalone shallowcopy function of the given external type.
+func generateExternalCopy(code *jen.File, pkg *loader.Package, c externalCopy) {
+	fields := make([]keyValue, 0, len(c.Fields))
+	for _, field := range c.Fields {
+		fields = append(fields, keyValue{Key: field, Value: jen.Id("o").Dot(field)})
+	}
+
+	code.Commentf("%s returns a shallow copy of o.", c.FuncName)
+	code.Func().
+		Id(c.FuncName).
+		Params(jen.Id("o").Add(typeCode(pkg, c.Type))).
+		Params(typeCode(pkg, c.Type)).
+		Block(jen.Return(typeCode(pkg, c.Type).Values(orderedDict(fields)...)))
+}
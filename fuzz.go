@@ -0,0 +1,158 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+// fuzzField is a struct field that can be filled in from a fuzz argument.
+type fuzzField struct {
+	Name string
+	// Param is the type of the fuzz argument.
+	Param jen.Code
+	// Conv is the type the fuzz argument needs to be converted to (or nil).
+	Conv jen.Code
+	// Float indicates that the field is a floating point number (which can be NaN).
+	Float bool
+}
+
+// fuzzFieldFor returns the fuzz argument for a field if its type is supported by the fuzzing engine.
+func fuzzFieldFor(pkg *loader.Package, field *types.Var) (fuzzField, bool) {
+	fuzzed := fuzzField{Name: field.Name()}
+
+	switch underlying := field.Type().Underlying().(type) {
+	case *types.Basic:
+		switch underlying.Kind() {
+		case types.Bool, types.String,
+			types.Int, types.Int8, types.Int16, types.Int32, types.Int64,
+			types.Uint, types.Uint8, types.Uint16, types.Uint32, types.Uint64:
+		case types.Float32, types.Float64:
+			fuzzed.Float = true
+		default:
+			return fuzzField{}, false
+		}
+
+		fuzzed.Param = jen.Id(underlying.Name())
+
+	case *types.Slice:
+		elem, isBasic := underlying.Elem().(*types.Basic)
+		if !isBasic || elem.Kind() != types.Uint8 {
+			return fuzzField{}, false
+		}
+
+		fuzzed.Param = jen.Index().Byte()
+
+	default:
+		return fuzzField{}, false
+	}
+
+	if _, isNamed := field.Type().(*types.Named); isNamed {
+		fuzzed.Conv = typeCode(pkg, field.Type())
+	}
+
+	return fuzzed, true
+}
+
+// generateFuzzTest generates the fuzz test of the given struct.
+func generateFuzzTest(code *jen.File, s copyStructs) {
+	params := []jen.Code{jen.Id("t").Op("*").Qual("testing", "T")}
+	var body []jen.Code
+
+	fields := make([]keyValue, 0, len(s.FuzzFields))
+	for i, field := range s.FuzzFields {
+		arg := jen.Id(fmt.Sprintf("v%d", i))
+		if field.Conv != nil {
+			arg = jen.Add(field.Conv).Call(arg)
+		}
+
+		fields = append(fields, keyValue{Key: field.Name, Value: arg})
+	}
+	value := orderedDict(fields)
+
+	for i, field := range s.FuzzFields {
+		param := fmt.Sprintf("v%d", i)
+		params = append(params, jen.Id(param).Add(field.Param))
+
+		// NaN never equals itself, so it can't be checked for equality
+		if field.Float {
+			body = append(body, jen.If(jen.Qual("math", "IsNaN").Call(jen.Float64().Call(jen.Id(param)))).Block(
+				jen.Id("t").Dot("Skip").Call(),
+			))
+		}
+	}
+
+	if s.Pointer {
+		body = append(body, jen.Id("o").Op(":=").Op("&").Id(s.StructName).Values(value...))
+	} else {
+		body = append(body, jen.Id("o").Op(":=").Id(s.StructName).Values(value...))
+	}
+
+	if s.ValidateAfter {
+		body = append(body,
+			jen.List(jen.Id("c"), jen.Err()).Op(":=").Id("o").Dot(s.CopyMethod).Call(),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				// fuzzed values aren't necessarily valid
+				jen.Id("t").Dot("Skip").Call(),
+			),
+		)
+	} else {
+		body = append(body, jen.Id("c").Op(":=").Id("o").Dot(s.CopyMethod).Call())
+	}
+
+	body = append(body, jen.If(jen.Op("!").Add(fuzzEqual(s, "c", "o"))).Block(
+		jen.Id("t").Dot("Fatalf").Call(jen.Lit(s.CopyMethod+"() = %#v, want %#v"), jen.Id("c"), jen.Id("o")),
+	))
+
+	if s.ValidateAfter {
+		body = append(body,
+			jen.List(jen.Id("cc"), jen.Err()).Op(":=").Id("c").Dot(s.CopyMethod).Call(),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Id("t").Dot("Fatalf").Call(jen.Lit(s.CopyMethod+"() of a valid copy failed: %v"), jen.Err()),
+			),
+		)
+	} else {
+		body = append(body, jen.Id("cc").Op(":=").Id("c").Dot(s.CopyMethod).Call())
+	}
+
+	body = append(body, jen.If(jen.Op("!").Add(fuzzEqual(s, "cc", "c"))).Block(
+		jen.Id("t").Dot("Fatalf").Call(jen.Lit(s.CopyMethod+"() is not idempotent: %#v != %#v"), jen.Id("cc"), jen.Id("c")),
+	))
+
+	code.Func().
+		Id("Fuzz" + s.StructName + "_" + s.CopyMethod).
+		Params(jen.Id("f").Op("*").Qual("testing", "F")).
+		Block(
+			jen.Id("f").Dot("Fuzz").Call(jen.Func().Params(params...).Block(body...)),
+		)
+}
+
+// fuzzEqual returns the expression checking whether the given values of the struct are equal,
+// using its Equal method when it has one.
+func fuzzEqual(s copyStructs, x, y string) jen.Code {
+	if !s.Equal {
+		return jen.Qual("reflect", "DeepEqual").Call(jen.Id(x), jen.Id(y))
+	}
+
+	if s.Pointer {
+		return jen.Id(x).Dot(equalMethod).Call(jen.Op("*").Id(y))
+	}
+
+	return jen.Id(x).Dot(equalMethod).Call(jen.Id(y))
+}
@@ -19,8 +19,15 @@ import (
 	"fmt"
 	"go/ast"
 	"go/format"
+	"go/parser"
+	"go/token"
 	"go/types"
+	"hash/fnv"
 	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/dave/jennifer/jen"
 	"sigs.k8s.io/controller-tools/pkg/genall"
@@ -30,138 +37,1357 @@ import (
 
 //go:generate go run sigs.k8s.io/controller-tools/cmd/helpgen generate:headerFile=./boilerplate.go.txt,year=2019 paths=.
 
+const (
+	// shallowCopyMethod is the name of the generated method, unless configured otherwise.
+	shallowCopyMethod = "ShallowCopy"
+	// intoMethodSuffix is appended to the name of the generated method copying into a destination (e.g. ShallowCopyInto).
+	intoMethodSuffix = "Into"
+	// helperSuffix is appended to the unexported name methods are generated under
+	// for manual implementations to call (e.g. shallowCopyGenerated, see helperTypeMarker).
+	helperSuffix = "Generated"
+
+	// defaultOutputFile is the name of the generated file, unless configured otherwise.
+	defaultOutputFile = "zz_generated.shallowcopy.go"
+	// generatedComment marks the files written by the generators.
+	generatedComment = "// Code generated by shallowcopy. DO NOT EDIT."
+
+	// copyTag is the struct tag key for skipping (copy:"-") or deep copying (copy:"deep") fields.
+	copyTag = "copy"
+)
+
 var (
-	enableTypeMarker = markers.Must(markers.MakeDefinition("shallowcopy:generate", markers.DescribesType, false))
+	enablePkgMarker         = markers.Must(markers.MakeDefinition("shallowcopy:generate", markers.DescribesPackage, ""))
+	enableTypeMarker        = markers.Must(markers.MakeDefinition("shallowcopy:generate", markers.DescribesType, false))
+	validateAfterTypeMarker = markers.Must(markers.MakeDefinition("shallowcopy:generate:validate-after", markers.DescribesType, false))
+	schemaVersionTypeMarker = markers.Must(markers.MakeDefinition("shallowcopy:generate:schema-version", markers.DescribesType, false))
+	fuzzTypeMarker          = markers.Must(markers.MakeDefinition("shallowcopy:generate:fuzz", markers.DescribesType, false))
+	testsTypeMarker         = markers.Must(markers.MakeDefinition("shallowcopy:generate:tests", markers.DescribesType, false))
+	intoTypeMarker          = markers.Must(markers.MakeDefinition("shallowcopy:generate:into", markers.DescribesType, false))
+	elementsTypeMarker      = markers.Must(markers.MakeDefinition("shallowcopy:generate:elements", markers.DescribesType, false))
+	helperTypeMarker        = markers.Must(markers.MakeDefinition("shallowcopy:generate:helper", markers.DescribesType, false))
+	nameTypeMarker          = markers.Must(markers.MakeDefinition("shallowcopy:generate:name", markers.DescribesType, ""))
+	implementsTypeMarker    = markers.Must(markers.MakeDefinition("shallowcopy:generate:implements", markers.DescribesType, ""))
+	receiverTypeMarker      = markers.Must(markers.MakeDefinition("shallowcopy:generate:receiver", markers.DescribesType, ""))
+
+	skipFieldMarker   = markers.Must(markers.MakeDefinition("shallowcopy:skip", markers.DescribesField, struct{}{}))
+	ignoreFieldMarker = markers.Must(markers.MakeDefinition("shallowcopy:ignore", markers.DescribesField, struct{}{}))
 )
 
+func init() {
+	registerGenerator("shallowcopy", Generator{})
+}
+
 type copyStructs struct {
-	StructName string
-	Fields     []string
+	StructName    string
+	Fields        []string
+	ValidateAfter bool
+	SchemaVersion string
+	Fuzz          bool
+	FuzzFields    []fuzzField
+	Tests         bool
+	TestFields    []testField
+	// CopiedFields lists the fields of types copying themselves (named
+	// channels with a ShallowCopy method), copied by calling the method
+	// rather than shared with the copy.
+	CopiedFields map[string]bool
+	// Method is the name the ShallowCopy method is generated under, empty if
+	// it's declared manually (and not to be generated as a helper).
+	Method string
+	// IntoMethod is the name the ShallowCopyInto method is generated under,
+	// empty if it's not generated.
+	IntoMethod string
+	// CopyMethod is the name of the ShallowCopy method called by the generated
+	// tests, whether it's generated or declared manually.
+	CopyMethod string
+	// Implements is the interface the type is asserted to implement (nil if none).
+	Implements jen.Code
+	Pointer    bool
+	Equal      bool
+	// TypeParams lists the names of the type parameters of generic structs.
+	TypeParams []string
+	// SourceFile is the name of the file the struct is declared in.
+	SourceFile string
+	// DeepCopies are the statements deep-copying the fields tagged copy:"deep"
+	// from *in into *out, which already holds the shallow copy.
+	DeepCopies []jen.Code
+	// Underlying is the underlying type of named slice, map and array types
+	// (nil for structs), which are copied as a whole.
+	Underlying types.Type
+	// Elements indicates that the elements of slices and maps are copied into
+	// a new one, instead of sharing them.
+	Elements bool
+}
+
+// +controllertools:marker:generateHelp
+
+// Generator generates code containing ShallowCopy method implementations.
+type Generator struct {
+	// OutputFile specifies the name of the generated file (zz_generated.shallowcopy.go by default).
+	//
+	// Fuzz and unit tests are generated next to it, with a _test suffix.
+	OutputFile string `marker:",optional"`
+	// SplitBySource specifies whether to generate a separate file for the
+	// types of each source file, adding the name of the source file to the
+	// output file name (e.g. zz_generated.shallowcopy.types.go for types.go).
+	SplitBySource bool `marker:",optional"`
+
+	// HeaderFile specifies the header text (e.g. license) to prepend to generated files.
+	HeaderFile string `marker:",optional"`
+	// Year specifies the year to substitute for " YEAR" in the header file.
+	Year string `marker:",optional"`
+
+	// Config specifies a YAML file listing additional types to generate
+	// shallowcopy methods for, as if they were marked with shallowcopy:generate=true
+	// (e.g. for vendored packages that can't be modified).
+	//
+	// The listed packages have to be loaded as well (using the paths option).
+	Config string `marker:",optional"`
+
+	// Package specifies a sub-package (e.g. generated) of each package to generate
+	// standalone ShallowCopy<Type> functions into, instead of methods next to the types.
+	//
+	// The functions can only copy exported fields, and external types are copied
+	// in the sub-package as well.
+	Package string `marker:",optional"`
+
+	// Workers specifies the number of packages to process in parallel (the number of CPUs by default).
+	Workers int `marker:",optional"`
+
+	// Cache specifies a file to store hashes of the inputs of each package in
+	// (its source files, the ones of the packages it imports and the options),
+	// skipping packages that haven't changed since their code was last generated
+	// successfully, unless some of the files generated for them are missing.
+	//
+	// Skipped packages aren't output at all, so the cache is ignored unless the
+	// generated files are written to disk (e.g. it's ignored by dry runs and the
+	// verify output rule). Remove it to regenerate everything.
+	Cache string `marker:",optional"`
+}
+
+func (Generator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enablePkgMarker, enableTypeMarker, validateAfterTypeMarker, schemaVersionTypeMarker, fuzzTypeMarker, testsTypeMarker, intoTypeMarker, elementsTypeMarker, helperTypeMarker, nameTypeMarker, implementsTypeMarker, receiverTypeMarker, skipFieldMarker, ignoreFieldMarker, externalPkgMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enablePkgMarker,
+		markers.SimpleHelp("object", "enables shallowcopy implementation generation for every exported struct in this package when set to \"package\""),
+	)
+	into.AddHelp(
+		externalPkgMarker,
+		markers.SimpleHelp("object", "generates a standalone ShallowCopy<Type> function in this package for the given struct of an imported package"),
+	)
+	into.AddHelp(
+		enableTypeMarker,
+		markers.SimpleHelp("object", "enables or disables shallowcopy implementation generation for this type"),
+	)
+	into.AddHelp(
+		validateAfterTypeMarker,
+		markers.SimpleHelp("object", "makes the generated shallowcopy method fallible, returning the error of calling Validate on the copy"),
+	)
+	into.AddHelp(
+		schemaVersionTypeMarker,
+		markers.SimpleHelp("object", "emits a <Type>SchemaVersion constant derived from the field layout of this type"),
+	)
+	into.AddHelp(
+		fuzzTypeMarker,
+		markers.SimpleHelp("object", "emits a fuzz test checking that shallowcopy is idempotent and equal to the original"),
+	)
+	into.AddHelp(
+		testsTypeMarker,
+		markers.SimpleHelp("object", "emits a table-driven test checking that shallowcopy is equal to the original, and that modifying the fields of either doesn't affect the other"),
+	)
+	into.AddHelp(
+		intoTypeMarker,
+		markers.SimpleHelp("object", "additionally emits a ShallowCopyInto method writing into a caller-provided destination"),
+	)
+	into.AddHelp(
+		elementsTypeMarker,
+		markers.SimpleHelp("object", "copies the elements of named slice and map types into a new one, instead of sharing them"),
+	)
+	into.AddHelp(
+		helperTypeMarker,
+		markers.SimpleHelp("object", "generates the methods implemented manually as shallowCopyGenerated (and shallowCopyIntoGenerated) helpers the manual implementations can call"),
+	)
+	into.AddHelp(
+		nameTypeMarker,
+		markers.SimpleHelp("object", "sets the name of the generated method (e.g. Clone) instead of ShallowCopy, the method copying into a destination is named after it (e.g. CloneInto)"),
+	)
+	into.AddHelp(
+		implementsTypeMarker,
+		markers.SimpleHelp("object", "emits a compile-time assertion that the type implements the given single-method interface (e.g. Cloner, api.Cloner or Cloner[Profile]), named like the generated method"),
+	)
+	into.AddHelp(
+		receiverTypeMarker,
+		markers.SimpleHelp("object", "sets the receiver (and result) of the generated methods to either \"value\" (the default) or \"pointer\""),
+	)
+	into.AddHelp(
+		skipFieldMarker,
+		markers.SimpleHelp("object", "leaves this field zero in the copy (embedded fields are skipped as a whole)"),
+	)
+	into.AddHelp(
+		ignoreFieldMarker,
+		markers.SimpleHelp("object", "leaves this field (e.g. a mutex or a cache) zero in the copy, same as shallowcopy:skip"),
+	)
+
+	return nil
+}
+
+func enabledOnPackage(col *markers.Collector, pkg *loader.Package) (bool, error) {
+	pkgMarkers, err := markers.PackageMarkers(col, pkg)
+	if err != nil {
+		return false, err
+	}
+
+	values := pkgMarkers[enablePkgMarker.Name]
+	for _, value := range values {
+		if value.(string) != "package" {
+			return false, fmt.Errorf("unsupported value %q for package marker %s, expected \"package\"", value, enablePkgMarker.Name)
+		}
+	}
+
+	return len(values) > 0, nil
+}
+
+// typeOptions are the shallowcopy options resolved from the markers of a single type.
+type typeOptions struct {
+	Enabled bool
+	// Explicit indicates that generation is enabled on the type itself,
+	// not just for the whole package.
+	Explicit      bool
+	ValidateAfter bool
+	SchemaVersion bool
+	Fuzz          bool
+	Tests         bool
+	Into          bool
+	Elements      bool
+	Helper        bool
+	Pointer       bool
+	// Method is the name of the generated method.
+	Method string
+	// Implements is the interface the type is asserted to implement.
+	Implements string
+}
+
+// optionsOnType resolves the options of the given type from its markers.
+//
+// The result doesn't depend on the order markers are declared in: repeating
+// a marker with the same value is fine, but conflicting values are an error
+// instead of silently letting the first (or last) one win.
+//
+// Types are enabled when the whole package is (unless they opt out), or when
+// enabled specifically on them.
+func optionsOnType(allTypes bool, info *markers.TypeInfo) (typeOptions, error) {
+	var opts typeOptions
+	var err error
+
+	if opts.Enabled, err = boolMarkerOnType(info, enableTypeMarker); err != nil {
+		return opts, err
+	}
+	if _, isSet := info.Markers[enableTypeMarker.Name]; isSet {
+		opts.Explicit = opts.Enabled
+	} else {
+		opts.Enabled = allTypes
+	}
+	if opts.ValidateAfter, err = boolMarkerOnType(info, validateAfterTypeMarker); err != nil {
+		return opts, err
+	}
+	if opts.SchemaVersion, err = boolMarkerOnType(info, schemaVersionTypeMarker); err != nil {
+		return opts, err
+	}
+	if opts.Fuzz, err = boolMarkerOnType(info, fuzzTypeMarker); err != nil {
+		return opts, err
+	}
+	if opts.Tests, err = boolMarkerOnType(info, testsTypeMarker); err != nil {
+		return opts, err
+	}
+	if opts.Into, err = boolMarkerOnType(info, intoTypeMarker); err != nil {
+		return opts, err
+	}
+	if opts.Elements, err = boolMarkerOnType(info, elementsTypeMarker); err != nil {
+		return opts, err
+	}
+	if opts.Helper, err = boolMarkerOnType(info, helperTypeMarker); err != nil {
+		return opts, err
+	}
+
+	if opts.Method, err = stringMarkerOnType(info, nameTypeMarker); err != nil {
+		return opts, err
+	}
+	if opts.Method == "" {
+		opts.Method = shallowCopyMethod
+	} else if !token.IsIdentifier(opts.Method) || !ast.IsExported(opts.Method) {
+		return opts, fmt.Errorf("invalid method name %q for %s, expected an exported identifier", opts.Method, info.Name)
+	}
+	if opts.Implements, err = stringMarkerOnType(info, implementsTypeMarker); err != nil {
+		return opts, err
+	}
+
+	receiver, err := stringMarkerOnType(info, receiverTypeMarker)
+	if err != nil {
+		return opts, err
+	}
+	switch receiver {
+	case "", "value":
+	case "pointer":
+		opts.Pointer = true
+	default:
+		return opts, fmt.Errorf("unsupported receiver %q for %s, expected \"value\" or \"pointer\"", receiver, info.Name)
+	}
+
+	return opts, nil
+}
+
+// boolMarkerOnType returns the value of a boolean type marker (false if it's not set).
+func boolMarkerOnType(info *markers.TypeInfo, def *markers.Definition) (bool, error) {
+	values := info.Markers[def.Name]
+	if len(values) == 0 {
+		return false, nil
+	}
+
+	value := values[0].(bool)
+	for _, other := range values[1:] {
+		if other.(bool) != value {
+			return false, fmt.Errorf("conflicting values for marker %s on %s", def.Name, info.Name)
+		}
+	}
+
+	return value, nil
+}
+
+// stringMarkerOnType returns the value of a string type marker ("" if it's not set).
+func stringMarkerOnType(info *markers.TypeInfo, def *markers.Definition) (string, error) {
+	values := info.Markers[def.Name]
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	value := values[0].(string)
+	for _, other := range values[1:] {
+		if other.(string) != value {
+			return "", fmt.Errorf("conflicting values for marker %s on %s", def.Name, info.Name)
+		}
+	}
+
+	return value, nil
 }
 
-// +controllertools:marker:generateHelp
+// markerEnabledOnType checks if generation is enabled by the given type
+// marker: boolean markers have to be set to true, string markers (e.g. naming
+// the type to generate code for) to a non-empty value.
+func markerEnabledOnType(info *markers.TypeInfo, def *markers.Definition) (bool, error) {
+	if def.Output.Kind() == reflect.String {
+		value, err := stringMarkerOnType(info, def)
+
+		return value != "", err
+	}
+
+	return boolMarkerOnType(info, def)
+}
+
+// skippedField checks if the field at the given index of the struct is marked to be skipped (or ignored).
+//
+// Embedded fields are a single field of the struct, so skipping one skips the
+// embedded value as a whole, not its promoted fields one by one.
+func skippedField(info *markers.TypeInfo, i int) bool {
+	if i >= len(info.Fields) {
+		return false
+	}
+
+	fieldMarkers := info.Fields[i].Markers
+
+	return fieldMarkers.Get(skipFieldMarker.Name) != nil || fieldMarkers.Get(ignoreFieldMarker.Name) != nil
+}
+
+// fieldCopyTag returns the value of the copy tag of the field at the given index of the struct:
+// "-" to skip the field (like shallowcopy:skip), "deep" to deep copy it, or "" if it's not set.
+func fieldCopyTag(stype *types.Struct, i int) (string, error) {
+	value := reflect.StructTag(stype.Tag(i)).Get(copyTag)
+
+	switch value {
+	case "", "-", "deep":
+		return value, nil
+	default:
+		return "", fmt.Errorf("unsupported %s tag %q on field %s, expected \"-\" or \"deep\"", copyTag, value, stype.Field(i).Name())
+	}
+}
+
+func (g Generator) Generate(ctx *genall.GenerationContext) error {
+	outputFile := g.OutputFile
+	if outputFile == "" {
+		outputFile = defaultOutputFile
+	}
+
+	if filepath.Base(outputFile) != outputFile || filepath.Ext(outputFile) != ".go" || strings.HasSuffix(outputFile, "_test.go") {
+		return fmt.Errorf("invalid output file name %q: must be a non-test Go file name without directories", outputFile)
+	}
+
+	var subPackage string
+	if g.Package != "" {
+		var err error
+		if subPackage, err = checkSubPackage(g.Package); err != nil {
+			return err
+		}
+	}
+
+	var headerText string
+
+	if g.HeaderFile != "" {
+		headerBytes, err := ctx.ReadFile(g.HeaderFile)
+		if err != nil {
+			return err
+		}
+		headerText = string(headerBytes)
+	}
+	headerText = strings.ReplaceAll(headerText, " YEAR", " "+g.Year)
+
+	var configured map[string]map[string]bool
+	if g.Config != "" {
+		var err error
+		if configured, err = loadCopyConfig(ctx, g.Config); err != nil {
+			return err
+		}
+	}
+
+	useCache := g.Cache != "" && keepsOutput(ctx.OutputRule)
+
+	var cached copyCache
+	if useCache {
+		var err error
+		if cached, err = loadCopyCache(ctx, g.Cache); err != nil {
+			return err
+		}
+	}
+
+	// options that don't change the generated code
+	cacheOptions := g
+	cacheOptions.Cache, cacheOptions.Workers = "", 0
+
+	// the configured types of each package are only accessed by the worker processing it
+	configuredByRoot := make(map[*loader.Package]map[string]bool, len(ctx.Roots))
+	hashes := make(map[*loader.Package]string, len(ctx.Roots))
+
+	var roots []*loader.Package
+
+	// the type checker isn't safe for concurrent use, so packages are checked up front
+	for _, root := range ctx.Roots {
+		startPackage(root)
+
+		configuredByRoot[root] = configured[root.PkgPath]
+		delete(configured, root.PkgPath)
+
+		if useCache {
+			hash, err := packageInputHash(ctx.Collector, root,
+				fmt.Sprintf("%+v", cacheOptions),
+				fmt.Sprintf("%#v", ctx.OutputRule),
+				headerText,
+				strings.Join(sortedKeys(configuredByRoot[root]), ","),
+				fmt.Sprint(typeFilter),
+			)
+			if err != nil {
+				root.AddError(err)
+				continue
+			}
+
+			// skip packages whose inputs haven't changed since the last successful generation
+			if cached.upToDate(ctx.OutputRule, root, hash) {
+				skippedPackage(root, "unchanged since the last generation (see cache)")
+
+				continue
+			}
+
+			hashes[root] = hash
+		}
+
+		checkTypes(ctx, root)
+
+		if err := checkImplementedPackages(ctx, root); err != nil {
+			root.AddError(err)
+			continue
+		}
+
+		roots = append(roots, root)
+	}
+
+	rootsCtx := *ctx
+	rootsCtx.Roots = roots
+	if g.Package != "" {
+		rootsCtx.OutputRule = outputWithDirs{ctx.OutputRule}
+	}
+
+	// the files of each package are recorded in the cache, so they can be checked before skipping it
+	output := recordedOutput{OutputRule: rootsCtx.OutputRule, files: make(map[*loader.Package][]string)}
+	if useCache {
+		rootsCtx.OutputRule = output
+	}
+
+	generate := generateFiles
+	if g.Package != "" {
+		generate = func(ctx *genall.GenerationContext, root *loader.Package, structs []copyStructs, externals []externalCopy, fileName, headerText string) {
+			generateSubPackageFiles(ctx, root, g.Package, subPackage, structs, externals, fileName, headerText)
+		}
+	}
+
+	processRoots(&rootsCtx, g.Workers, func(ctx *genall.GenerationContext, root *loader.Package) {
+		allTypes, err := enabledOnPackage(ctx.Collector, root)
+		if err != nil {
+			root.AddError(err)
+			return
+		}
+
+		externals, err := externalCopies(ctx.Collector, root)
+		if err != nil {
+			root.AddError(err)
+			return
+		}
+
+		deepCopied, err := markedTypeNames(ctx.Collector, root, enableDeepCopyTypeMarker)
+		if err != nil {
+			root.AddError(err)
+			return
+		}
+
+		validated, err := markedTypeNames(ctx.Collector, root, enableValidateTypeMarker)
+		if err != nil {
+			root.AddError(err)
+			return
+		}
+
+		var structs []copyStructs
+
+		configuredTypes := configuredByRoot[root]
+
+		if err := markers.EachType(ctx.Collector, root, func(info *markers.TypeInfo) {
+			opts, err := optionsOnType(allTypes, info)
+			if err != nil {
+				report(root, info.RawSpec, newDiagnostic(codeInvalidMarker, nil, "", "%v", err))
+
+				return
+			}
+
+			if configuredTypes[info.Name] {
+				delete(configuredTypes, info.Name)
+
+				if _, isSet := info.Markers[enableTypeMarker.Name]; isSet && !opts.Enabled {
+					report(root, info.RawSpec, newDiagnostic(codeConfig, enableTypeMarker,
+						fmt.Sprintf("remove the marker, or remove %s from %s", info.Name, g.Config),
+						"%s is listed in %s, but disabled by the %s marker", info.Name, g.Config, enableTypeMarker.Name))
+
+					return
+				}
+
+				opts.Enabled, opts.Explicit = true, true
+			}
+
+			// copy when enabled for all types and not disabled, or enabled
+			// specifically on this type
+			if !opts.Enabled {
+				return
+			}
+
+			if !typeSelected(info.Name) {
+				return
+			}
+
+			matchType(root, enableTypeMarker.Name, info.Name)
+
+			// explicitly marked types are expected to be generated
+			if opts.Explicit && !ast.IsExported(info.Name) {
+				warn(root, info.RawSpec, newDiagnostic(codeUnexportedType, enableTypeMarker,
+					"export it, or remove the marker",
+					"%s is unexported, no %s method is generated for it", info.Name, opts.Method))
+
+				return
+			}
+
+			// avoid copying non-exported types, etc
+			if !shouldBeCopied(root, info) {
+				return
+			}
+
+			typeInfo := root.TypesInfo.TypeOf(info.RawSpec.Name)
+			if typeInfo == types.Typ[types.Invalid] {
+				report(root, info.RawSpec, newDiagnostic(codeUnknownType, nil, "fix the type errors of the package first", "unknown type %s", info.Name))
+
+				return
+			}
+
+			method, intoMethod, err := copyMethodNames(root, typeInfo, opts)
+			if err != nil {
+				report(root, info.RawSpec, err.(diagnostic))
+
+				return
+			}
+
+			stype, ok := typeInfo.Underlying().(*types.Struct)
+			if !ok {
+				// non-struct types (e.g. named channels) with a manual ShallowCopy
+				// method are copied by that method, there's nothing to generate
+				if method == "" {
+					return
+				}
+
+				// package-wide generation only covers structs
+				if !opts.Explicit {
+					return
+				}
+
+				data, err := namedCopyFor(root, info, typeInfo, opts)
+				if err != nil {
+					report(root, info.RawSpec, err.(diagnostic))
+
+					return
+				}
+
+				data.Method, data.CopyMethod = method, opts.Method
+				if data.Implements, err = implementedInterface(root, info, typeInfo, opts); err != nil {
+					report(root, info.RawSpec, err.(diagnostic))
+
+					return
+				}
+
+				if g.Package != "" {
+					if err := checkSubPackageCopy(data); err != nil {
+						report(root, info.RawSpec, err.(diagnostic))
+
+						return
+					}
+				}
+
+				structs = append(structs, data)
+
+				return
+			}
+
+			if opts.Elements {
+				report(root, info.RawSpec, newDiagnostic(codeUnsupportedOption, elementsTypeMarker, "remove the marker",
+					"%s of %s only applies to slice and map types", elementsTypeMarker.Name, info.Name))
+
+				return
+			}
+
+			data := copyStructs{
+				StructName: info.Name,
+				Fields:     make([]string, 0, stype.NumFields()),
+				Method:     method,
+				IntoMethod: intoMethod,
+				CopyMethod: opts.Method,
+				Pointer:    opts.Pointer,
+				SourceFile: filepath.Base(root.Fset.Position(info.RawSpec.Pos()).Filename),
+			}
+
+			if named, isNamed := typeInfo.(*types.Named); isNamed && named.TypeParams().Len() > 0 {
+				// fuzz targets (and tests) would need concrete type arguments
+				if opts.Fuzz || opts.Tests {
+					marker := fuzzTypeMarker
+					if opts.Tests {
+						marker = testsTypeMarker
+					}
+
+					report(root, info.RawSpec, newDiagnostic(codeUnsupportedOption, marker, "remove the marker",
+						"tests can't be generated for generic type %s", info.Name))
+
+					return
+				}
+
+				for i := 0; i < named.TypeParams().Len(); i++ {
+					data.TypeParams = append(data.TypeParams, named.TypeParams().At(i).Obj().Name())
+				}
+			}
+
+			if data.Implements, err = implementedInterface(root, info, typeInfo, opts); err != nil {
+				report(root, info.RawSpec, err.(diagnostic))
+
+				return
+			}
+
+			if opts.ValidateAfter {
+				if !validated[info.Name] && !hasValidateMethod(root, typeInfo) {
+					report(root, info.RawSpec, newDiagnostic(codeMissingMethod, validateAfterTypeMarker,
+						fmt.Sprintf("declare a Validate() error method, or mark %s with %s", info.Name, enableValidateTypeMarker.Name),
+						"%s has no Validate() error method to call after copying", info.Name))
+
+					return
+				}
+
+				data.ValidateAfter = true
+			}
+
+			if opts.SchemaVersion {
+				data.SchemaVersion = structureHash(root.Types, stype)
+			}
+
+			for i := 0; i < stype.NumFields(); i++ {
+				field := stype.Field(i)
+
+				// a field and a method can't share a name on the same type
+				if field.Name() == method || (intoMethod != "" && field.Name() == intoMethod) {
+					report(root, fieldNode(info, i), newDiagnostic(codeCollision, nil, "rename the field",
+						"field %s of %s collides with the generated %s method", field.Name(), info.Name, field.Name()))
+
+					return
+				}
+
+				tag, err := fieldCopyTag(stype, i)
+				if err != nil {
+					report(root, fieldNode(info, i), newDiagnostic(codeInvalidTag, nil, "", "%s: %v", info.Name, err))
+
+					return
+				}
+
+				if tag == "-" || skippedField(info, i) {
+					continue
+				}
+
+				// channels are shared with the copy, which can go unnoticed, unless
+				// their type says how to copy them
+				if copiesItself(field.Type()) {
+					if data.CopiedFields == nil {
+						data.CopiedFields = make(map[string]bool)
+					}
+					data.CopiedFields[field.Name()] = true
+				} else if _, isChan := field.Type().Underlying().(*types.Chan); isChan {
+					warn(root, fieldNode(info, i), newDiagnostic(codeSharedField, nil,
+						fmt.Sprintf("add +%s to leave it zero in the copy", ignoreFieldMarker.Name),
+						"field %s of %s is a channel, which the copy shares with the original", field.Name(), info.Name))
+				}
+
+				// embedded fields are named after their unqualified type (e.g. URL for
+				// *url.URL), which is how they're keyed in composite literals as well
+				data.Fields = append(data.Fields, field.Name())
+
+				if tag == "deep" {
+					copier := &deepCopier{pkg: root, generated: deepCopied, visiting: make(map[*types.Named]bool)}
+
+					deepCopy, err := copier.copyField(field)
+					if err != nil {
+						report(root, fieldNode(info, i), newDiagnostic(codeUncopyableField, nil,
+							fmt.Sprintf("remove the %s:\"deep\" tag to copy it shallowly", copyTag),
+							"%s: field %s: %v", info.Name, field.Name(), err))
+
+						return
+					}
+
+					data.DeepCopies = append(data.DeepCopies, deepCopy...)
+				}
+
+				if opts.Fuzz {
+					if fuzzed, ok := fuzzFieldFor(root, field); ok {
+						data.FuzzFields = append(data.FuzzFields, fuzzed)
+					}
+				}
+
+				if opts.Tests {
+					if tested, ok := testFieldFor(root, field); ok {
+						data.TestFields = append(data.TestFields, tested)
+					}
+				}
+			}
+
+			data.Fuzz = opts.Fuzz && len(data.FuzzFields) > 0
+			data.Tests = opts.Tests
+
+			// compare using Equal when it's available (or generated in the same run)
+			if data.Fuzz || data.Tests {
+				equalEnabled, err := boolMarkerOnType(info, enableEqualTypeMarker)
+				data.Equal = hasEqualMethod(typeInfo) || (err == nil && equalEnabled)
+			}
+
+			// the copies made by functions of a sub-package are limited to what's accessible there
+			if g.Package != "" {
+				if err := checkSubPackageCopy(data); err != nil {
+					report(root, info.RawSpec, err.(diagnostic))
+
+					return
+				}
+			}
+
+			structs = append(structs, data)
+		}); err != nil {
+			root.AddError(err)
+			return
+		}
+
+		for _, name := range sortedKeys(configuredTypes) {
+			root.AddError(newDiagnostic(codeConfig, nil, fmt.Sprintf("remove it from %s", g.Config),
+				"type %s listed in %s not found in package %s", name, g.Config, root.PkgPath))
+		}
+
+		// the order of types doesn't depend on how they're spread across files
+		sort.SliceStable(structs, func(i, j int) bool {
+			return structs[i].StructName < structs[j].StructName
+		})
+
+		if !g.SplitBySource {
+			generate(ctx, root, structs, externals, outputFile, headerText)
+
+			return
+		}
+
+		// external types aren't declared in any of the source files
+		generate(ctx, root, nil, externals, outputFile, headerText)
+
+		var sourceFiles []string
+		bySourceFile := make(map[string][]copyStructs)
+
+		for _, s := range structs {
+			if _, seen := bySourceFile[s.SourceFile]; !seen {
+				sourceFiles = append(sourceFiles, s.SourceFile)
+			}
+
+			bySourceFile[s.SourceFile] = append(bySourceFile[s.SourceFile], s)
+		}
+
+		for _, sourceFile := range sourceFiles {
+			fileName := strings.TrimSuffix(outputFile, ".go") + "." + sourceFile
+
+			generate(ctx, root, bySourceFile[sourceFile], nil, fileName, headerText)
+		}
+	})
+
+	if useCache {
+		for _, root := range roots {
+			if len(root.Errors) == 0 {
+				cached.Packages[root.PkgPath] = hashes[root]
+				cached.Files[root.PkgPath] = append([]string{}, output.files[root]...)
+			} else {
+				delete(cached.Packages, root.PkgPath)
+				delete(cached.Files, root.PkgPath)
+			}
+		}
+
+		if err := saveCopyCache(g.Cache, cached); err != nil {
+			return err
+		}
+	}
+
+	if pkgPaths := sortedKeys(configured); len(pkgPaths) > 0 {
+		return fmt.Errorf("packages %s listed in %s aren't loaded, they have to be included in the paths too", strings.Join(pkgPaths, ", "), g.Config)
+	}
+
+	return nil
+}
+
+// copyMethodNames returns the names of the ShallowCopy and ShallowCopyInto (if
+// enabled) methods to generate for the given type, as configured by its options.
+//
+// Methods declared manually aren't generated (so they're empty), unless they're
+// to be generated as helpers for the manual implementations to call. The
+// returned errors are diagnostics.
+func copyMethodNames(pkg *loader.Package, typeInfo types.Type, opts typeOptions) (string, string, error) {
+	name := func(method string) (string, error) {
+		if !declaresMethod(pkg, typeInfo, method) {
+			return method, nil
+		}
+
+		if !opts.Helper {
+			return "", nil
+		}
+
+		helper := helperName(method)
+
+		if obj, ind, _ := types.LookupFieldOrMethod(typeInfo, true, pkg.Types, helper); obj != nil && len(ind) == 1 {
+			return "", newDiagnostic(codeCollision, helperTypeMarker, "rename it",
+				"%s collides with an existing field or method", helper)
+		}
+
+		return helper, nil
+	}
+
+	method, err := name(opts.Method)
+	if err != nil {
+		return "", "", err
+	}
+
+	var intoMethod string
+	if opts.Into {
+		if intoMethod, err = name(opts.Method + intoMethodSuffix); err != nil {
+			return "", "", err
+		}
+	}
+
+	if opts.Helper && method != helperName(opts.Method) && intoMethod != helperName(opts.Method+intoMethodSuffix) {
+		return "", "", newDiagnostic(codeUnsupportedOption, helperTypeMarker,
+			fmt.Sprintf("declare the %s method calling %s, or remove the marker", opts.Method, helperName(opts.Method)),
+			"%s has no manual implementation to generate a helper for", types.TypeString(typeInfo, types.RelativeTo(pkg.Types)))
+	}
+
+	return method, intoMethod, nil
+}
 
-// Generator generates code containing ShallowCopy method implementations.
-type Generator struct{}
+// implementedInterface resolves the interface the given type is asserted to
+// implement by its options, returning how it's referred to (nil if none).
+//
+// The interface is a type expression evaluated where the type is declared
+// (e.g. Cloner, api.Cloner or Cloner[Profile]), which has to have a single
+// method named like the generated one. The returned errors are diagnostics.
+func implementedInterface(pkg *loader.Package, info *markers.TypeInfo, typeInfo types.Type, opts typeOptions) (jen.Code, error) {
+	if opts.Implements == "" {
+		return nil, nil
+	}
 
-func (Generator) RegisterMarkers(into *markers.Registry) error {
-	if err := markers.RegisterAll(into, enableTypeMarker); err != nil {
-		return err
+	if named, isNamed := typeInfo.(*types.Named); isNamed && named.TypeParams().Len() > 0 {
+		return nil, newDiagnostic(codeUnsupportedOption, implementsTypeMarker, "remove the marker",
+			"generic type %s can't be asserted to implement %s", info.Name, opts.Implements)
 	}
 
-	into.AddHelp(
-		enableTypeMarker,
-		markers.SimpleHelp("object", "enables or disables shallowcopy implementation generation for this type"),
-	)
+	iface, err := evalType(pkg, opts.Implements)
+	if err != nil {
+		return nil, newDiagnostic(codeInvalidMarker, implementsTypeMarker, "",
+			"%s is not a type declared in %s or in the packages it imports: %v", opts.Implements, pkg.PkgPath, err)
+	}
 
-	return nil
-}
+	methods, isIface := iface.Underlying().(*types.Interface)
+	if !isIface || methods.NumMethods() != 1 {
+		return nil, newDiagnostic(codeInvalidMarker, implementsTypeMarker, "", "%s is not a single-method interface", opts.Implements)
+	}
 
-func enabledOnType(info *markers.TypeInfo) bool {
-	if typeMarker := info.Markers.Get(enableTypeMarker.Name); typeMarker != nil {
-		return typeMarker.(bool)
+	if method := methods.Method(0).Name(); method != opts.Method {
+		return nil, newDiagnostic(codeInvalidMarker, implementsTypeMarker, fmt.Sprintf("set +%s=%s", nameTypeMarker.Name, method),
+			"the method of %s is %s, not %s", opts.Implements, method, opts.Method)
 	}
 
-	return false
+	return typeCode(pkg, iface), nil
 }
 
-func (Generator) Generate(ctx *genall.GenerationContext) error {
-	for _, root := range ctx.Roots {
-		ctx.Checker.Check(root, func(node ast.Node) bool {
-			// ignore interfaces
-			_, isIface := node.(*ast.InterfaceType)
-			return !isIface
+// checkImplementedPackages type-checks the packages imported by the given
+// one that the interfaces implemented by its types (see implementsTypeMarker)
+// are declared in, since only the packages referenced by type declarations
+// are checked along with it.
+func checkImplementedPackages(ctx *genall.GenerationContext, root *loader.Package) error {
+	return markers.EachType(ctx.Collector, root, func(info *markers.TypeInfo) {
+		implements, err := stringMarkerOnType(info, implementsTypeMarker)
+		if err != nil || implements == "" {
+			return
+		}
+
+		parsed, err := parser.ParseExpr(implements)
+		if err != nil {
+			return
+		}
+
+		ast.Inspect(parsed, func(node ast.Node) bool {
+			if selector, isSelector := node.(*ast.SelectorExpr); isSelector {
+				if pkgName, isIdent := selector.X.(*ast.Ident); isIdent {
+					for _, imported := range root.Imports() {
+						if imported.Name == pkgName.Name {
+							checkTypes(ctx, imported)
+						}
+					}
+				}
+			}
+
+			return true
 		})
+	})
+}
 
-		root.NeedTypesInfo()
+// evalType evaluates the given type expression in the scope of the given
+// package, where the packages it imports are referred to by their names
+// (e.g. api.Cloner[Profile]).
+func evalType(pkg *loader.Package, expr string) (types.Type, error) {
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
 
-		var structs []copyStructs
+	var eval func(expr ast.Expr) (types.Type, error)
 
-		if err := markers.EachType(ctx.Collector, root, func(info *markers.TypeInfo) {
-			// copy when enabled specifically on this type
-			if !enabledOnType(info) {
-				return
-			}
+	instantiate := func(generic ast.Expr, indexes ...ast.Expr) (types.Type, error) {
+		base, err := eval(generic)
+		if err != nil {
+			return nil, err
+		}
 
-			// avoid copying non-exported types, etc
-			if !shouldBeCopied(root, info) {
-				return
+		args := make([]types.Type, 0, len(indexes))
+		for _, index := range indexes {
+			arg, err := eval(index)
+			if err != nil {
+				return nil, err
 			}
 
-			typeInfo := root.TypesInfo.TypeOf(info.RawSpec.Name)
-			if typeInfo == types.Typ[types.Invalid] {
-				root.AddError(loader.ErrFromNode(fmt.Errorf("unknown type %s", info.Name), info.RawSpec))
-			}
+			args = append(args, arg)
+		}
 
-			stype, ok := typeInfo.Underlying().(*types.Struct)
-			if !ok {
-				root.AddError(loader.ErrFromNode(fmt.Errorf("%s is not a struct type", info.Name), info.RawSpec))
+		return types.Instantiate(nil, base, args, true)
+	}
 
-				return
+	eval = func(expr ast.Expr) (types.Type, error) {
+		switch expr := expr.(type) {
+		case *ast.SelectorExpr:
+			pkgName, isIdent := expr.X.(*ast.Ident)
+			if !isIdent {
+				break
 			}
 
-			data := copyStructs{
-				StructName: info.Name,
-				Fields:     make([]string, 0, stype.NumFields()),
+			// only the imported packages checked up front have their types
+			for _, imported := range pkg.Imports() {
+				if imported.Name != pkgName.Name || imported.Types == nil || !imported.Types.Complete() {
+					continue
+				}
+
+				if obj, isType := imported.Types.Scope().Lookup(expr.Sel.Name).(*types.TypeName); isType && obj.Exported() {
+					return obj.Type(), nil
+				}
 			}
 
-			for i := 0; i < stype.NumFields(); i++ {
-				field := stype.Field(i)
+			return nil, fmt.Errorf("undefined: %s", types.ExprString(expr))
 
-				data.Fields = append(data.Fields, field.Name())
+		case *ast.IndexExpr:
+			return instantiate(expr.X, expr.Index)
+
+		case *ast.IndexListExpr:
+			return instantiate(expr.X, expr.Indices...)
+
+		case *ast.StarExpr:
+			elem, err := eval(expr.X)
+			if err != nil {
+				return nil, err
 			}
 
-			structs = append(structs, data)
-		}); err != nil {
-			root.AddError(err)
-			return nil
+			return types.NewPointer(elem), nil
 		}
 
-		if len(structs) > 0 {
-			code := jen.NewFile(root.Name)
+		// anything else is evaluated in the package scope
+		tv, err := types.Eval(pkg.Fset, pkg.Types, token.NoPos, types.ExprString(expr))
+		if err != nil {
+			return nil, err
+		}
+		if !tv.IsType() {
+			return nil, fmt.Errorf("%s is not a type", types.ExprString(expr))
+		}
 
-			for _, s := range structs {
-				code.Func().
-					Params(jen.Id("o").Id(s.StructName)).
-					Id("ShallowCopy").
-					Params().
-					Params(jen.Id(s.StructName)).
-					Block(jen.Return(
-						jen.Id(s.StructName).Values(jen.DictFunc(func(d jen.Dict) {
-							for _, field := range s.Fields {
-								d[jen.Id(field)] = jen.Id("o").Dot(field)
-							}
-						})),
-					))
-			}
+		return tv.Type, nil
+	}
 
-			var b bytes.Buffer
+	return eval(parsed)
+}
 
-			err := code.Render(&b)
-			if err != nil {
-				root.AddError(err)
+// helperName returns the name the given method is generated under for its
+// manual implementation to call.
+func helperName(method string) string {
+	return strings.ToLower(method[:1]) + method[1:] + helperSuffix
+}
 
-				return nil
-			}
+// declaresMethod checks if the given type (or its pointer) declares a method
+// with the given name itself, whatever its signature is.
+func declaresMethod(pkg *loader.Package, typeInfo types.Type, name string) bool {
+	obj, ind, _ := types.LookupFieldOrMethod(typeInfo, true, pkg.Types, name)
+	if len(ind) != 1 {
+		// promoted methods are shadowed by the generated ones
+		return false
+	}
 
-			outContents, err := format.Source(b.Bytes())
-			if err != nil {
-				root.AddError(err)
+	_, isFunc := obj.(*types.Func)
 
-				return nil
-			}
+	return isFunc
+}
+
+// namedCopyFor returns how the given named non-struct type is copied, which
+// is only possible for slices and maps (sharing their elements, unless copying
+// them is requested) and arrays.
+//
+// The returned errors are diagnostics.
+func namedCopyFor(root *loader.Package, info *markers.TypeInfo, typeInfo types.Type, opts typeOptions) (copyStructs, error) {
+	data := copyStructs{
+		StructName: info.Name,
+		SourceFile: filepath.Base(root.Fset.Position(info.RawSpec.Pos()).Filename),
+		Underlying: typeInfo.Underlying(),
+		Elements:   opts.Elements,
+	}
 
-			writeOut(ctx, root, outContents)
+	switch underlying := typeInfo.Underlying().(type) {
+	case *types.Slice, *types.Map:
+	case *types.Array:
+		if opts.Elements {
+			return data, newDiagnostic(codeUnsupportedOption, elementsTypeMarker, "remove the marker",
+				"%s of %s only applies to slice and map types, arrays are always copied with their elements", elementsTypeMarker.Name, info.Name)
 		}
+	default:
+		kind := "a " + types.TypeString(underlying, nil)
+		switch underlying.(type) {
+		case *types.Chan:
+			kind = "a channel"
+		case *types.Signature:
+			kind = "a function"
+		case *types.Interface:
+			kind = "an interface"
+		case *types.Pointer:
+			kind = "a pointer"
+		}
+
+		return data, newDiagnostic(codeUnsupportedType, enableTypeMarker,
+			fmt.Sprintf("declare a %s method to define how it's copied, or remove the marker", opts.Method),
+			"%s is %s type, which can't be copied automatically", info.Name, kind)
 	}
 
-	return nil
+	// the options concerning the fields (and methods) of structs are rejected instead of ignored
+	for _, option := range []struct {
+		marker *markers.Definition
+		set    bool
+	}{
+		{validateAfterTypeMarker, opts.ValidateAfter},
+		{schemaVersionTypeMarker, opts.SchemaVersion},
+		{fuzzTypeMarker, opts.Fuzz},
+		{testsTypeMarker, opts.Tests},
+		{intoTypeMarker, opts.Into},
+		{receiverTypeMarker, opts.Pointer},
+	} {
+		if option.set {
+			return data, newDiagnostic(codeUnsupportedOption, option.marker, "remove the marker",
+				"%s of %s only applies to struct types", option.marker.Name, info.Name)
+		}
+	}
+
+	if named, isNamed := typeInfo.(*types.Named); isNamed {
+		for i := 0; i < named.TypeParams().Len(); i++ {
+			data.TypeParams = append(data.TypeParams, named.TypeParams().At(i).Obj().Name())
+		}
+	}
+
+	return data, nil
+}
+
+// sortedKeys returns the keys of the given map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// generateFiles generates the shallowcopy methods of the given structs (and the functions
+// of the given external types) into the given file, and their tests (if any) into the
+// corresponding test file.
+func generateFiles(ctx *genall.GenerationContext, root *loader.Package, structs []copyStructs, externals []externalCopy, fileName, headerText string) {
+	if len(structs) == 0 && len(externals) == 0 {
+		return
+	}
+
+	code := jen.NewFile(root.Name)
+
+	for _, s := range structs {
+		generateShallowCopy(code, s)
+	}
+	for _, external := range externals {
+		generateExternalCopy(code, root, external)
+	}
+
+	renderOut(ctx, root, code, fileName, headerText)
+
+	if testCode := generateTests(root, structs); testCode != nil {
+		renderOut(ctx, root, testCode, strings.TrimSuffix(fileName, ".go")+"_test.go", headerText)
+	}
+}
+
+// generateShallowCopy generates the shallowcopy methods (and constants) of the given struct.
+func generateShallowCopy(code *jen.File, s copyStructs) {
+	if s.SchemaVersion != "" {
+		code.Const().Id(s.StructName + "SchemaVersion").Op("=").Lit(s.SchemaVersion)
+	}
+
+	// self returns the type of the struct, instantiated with its own type parameters if it's generic
+	self := func() *jen.Statement {
+		if len(s.TypeParams) == 0 {
+			return jen.Id(s.StructName)
+		}
+
+		params := make([]jen.Code, 0, len(s.TypeParams))
+		for _, param := range s.TypeParams {
+			params = append(params, jen.Id(param))
+		}
+
+		return jen.Id(s.StructName).Index(jen.List(params...))
+	}
+
+	if s.Implements != nil {
+		value := self().Values()
+		if s.Pointer {
+			value = jen.Parens(jen.Op("*").Add(self())).Call(jen.Nil())
+		}
+
+		code.Var().Id("_").Add(s.Implements).Op("=").Add(value)
+	}
+
+	if s.Underlying != nil {
+		generateNamedCopy(code, s, self)
+
+		return
+	}
+
+	fields := make([]keyValue, 0, len(s.Fields))
+	for _, field := range s.Fields {
+		fields = append(fields, keyValue{Key: field, Value: fieldValue(s, field)})
+	}
+
+	value := self().Values(orderedDict(fields)...)
+
+	receiver := jen.Id("o").Add(self())
+	result := self()
+	zero := self().Values()
+	var body []jen.Code
+
+	if s.Pointer {
+		receiver = jen.Id("o").Op("*").Add(self())
+		result = jen.Op("*").Add(self())
+		value = jen.Op("&").Add(value)
+		zero = jen.Nil()
+
+		if s.ValidateAfter {
+			body = append(body, jen.If(jen.Id("o").Op("==").Nil()).Block(jen.Return(jen.Nil(), jen.Nil())))
+		} else {
+			body = append(body, jen.If(jen.Id("o").Op("==").Nil()).Block(jen.Return(jen.Nil())))
+		}
+	}
+
+	// in points to the receiver for deep copying fields
+	in := jen.Op("&").Id("o")
+	if s.Pointer {
+		in = jen.Id("o")
+	}
+
+	if len(s.DeepCopies) > 0 {
+		out := jen.Op("&").Id("c")
+		if s.Pointer {
+			out = jen.Id("c")
+		}
+
+		body = append(body,
+			jen.Id("c").Op(":=").Add(value),
+			jen.List(jen.Id("in"), jen.Id("out")).Op(":=").List(in, out),
+		)
+		body = append(body, s.DeepCopies...)
+
+		// the copy is returned (or validated) below
+		value = jen.Id("c")
+	}
+
+	switch {
+	case s.Method == "":
+		// declared manually
+	case !s.ValidateAfter:
+		body = append(body, jen.Return(value))
+
+		code.Func().
+			Params(receiver).
+			Id(s.Method).
+			Params().
+			Params(result).
+			Block(body...)
+	default:
+		if len(s.DeepCopies) == 0 {
+			body = append(body, jen.Id("c").Op(":=").Add(value))
+		}
+
+		body = append(body,
+			jen.If(jen.Err().Op(":=").Id("c").Dot("Validate").Call(), jen.Err().Op("!=").Nil()).Block(
+				jen.Return(zero, jen.Err()),
+			),
+			jen.Return(jen.Id("c"), jen.Nil()),
+		)
+
+		code.Func().
+			Params(receiver).
+			Id(s.Method).
+			Params().
+			Params(result, jen.Error()).
+			Block(body...)
+	}
+
+	if s.IntoMethod == "" {
+		return
+	}
+
+	receiver = jen.Id("o").Add(self())
+	assignments := make([]jen.Code, 0, len(s.DeepCopies)+4)
+
+	if s.Pointer {
+		receiver = jen.Id("o").Op("*").Add(self())
+		assignments = append(assignments, nilIntoGuard(s, self))
+	}
+
+	// the whole destination is assigned, so that skipped fields end up zero like in the result of ShallowCopy
+	assignments = append(assignments, jen.Op("*").Id("out").Op("=").Add(self().Values(orderedDict(fields)...)))
+
+	if len(s.DeepCopies) > 0 {
+		assignments = append(assignments, jen.Id("in").Op(":=").Add(in))
+		assignments = append(assignments, s.DeepCopies...)
+	}
+
+	if !s.ValidateAfter {
+		code.Func().
+			Params(receiver).
+			Id(s.IntoMethod).
+			Params(jen.Id("out").Op("*").Add(self())).
+			Block(assignments...)
+
+		return
+	}
+
+	assignments = append(assignments, jen.Return(jen.Id("out").Dot("Validate").Call()))
+
+	code.Func().
+		Params(receiver).
+		Id(s.IntoMethod).
+		Params(jen.Id("out").Op("*").Add(self())).
+		Params(jen.Error()).
+		Block(assignments...)
+}
+
+// nilIntoGuard returns the statement copying a nil receiver into the
+// destination as the zero value, like ShallowCopy returns nil for it (without
+// validating it).
+func nilIntoGuard(s copyStructs, self func() *jen.Statement) jen.Code {
+	ret := jen.Return()
+	if s.ValidateAfter {
+		ret = jen.Return(jen.Nil())
+	}
+
+	return jen.If(jen.Id("o").Op("==").Nil()).Block(
+		jen.Op("*").Id("out").Op("=").Add(self().Values()),
+		ret,
+	)
+}
+
+// generateNamedCopy generates the ShallowCopy method of a named slice, map or
+// array type, which copies the header (sharing the elements) by default.
+func generateNamedCopy(code *jen.File, s copyStructs, self func() *jen.Statement) {
+	body := []jen.Code{jen.Return(jen.Id("o"))}
+
+	if s.Elements {
+		var fill jen.Code
+		switch s.Underlying.(type) {
+		case *types.Slice:
+			fill = jen.Copy(jen.Id("c"), jen.Id("o"))
+		case *types.Map:
+			fill = jen.For(jen.List(jen.Id("k"), jen.Id("v")).Op(":=").Range().Id("o")).Block(
+				jen.Id("c").Index(jen.Id("k")).Op("=").Id("v"),
+			)
+		}
+
+		body = []jen.Code{
+			jen.If(jen.Id("o").Op("==").Nil()).Block(jen.Return(jen.Nil())),
+			jen.Id("c").Op(":=").Make(self(), jen.Len(jen.Id("o"))),
+			fill,
+			jen.Return(jen.Id("c")),
+		}
+	}
+
+	code.Func().
+		Params(jen.Id("o").Add(self())).
+		Id(s.Method).
+		Params().
+		Params(self()).
+		Block(body...)
 }
 
 // shouldBeCopied checks if we're supposed to make shallowcopy methods on the given type.
 //
 // This is the case if it's exported *and* either:
-// - has a partial manual ShallowCopy implementation (in which case we fill in the rest)
+// - has a partial manual ShallowCopy implementation (in which case we fill in the rest, see copyMethodNames)
 // - aliases to a non-basic type eventually
 // - is a struct
 func shouldBeCopied(pkg *loader.Package, info *markers.TypeInfo) bool {
@@ -171,7 +1397,7 @@ func shouldBeCopied(pkg *loader.Package, info *markers.TypeInfo) bool {
 
 	typeInfo := pkg.TypesInfo.TypeOf(info.RawSpec.Name)
 	if typeInfo == types.Typ[types.Invalid] {
-		pkg.AddError(loader.ErrFromNode(fmt.Errorf("unknown type %s", info.Name), info.RawSpec))
+		report(pkg, info.RawSpec, newDiagnostic(codeUnknownType, nil, "fix the type errors of the package first", "unknown type %s", info.Name))
 		return false
 	}
 
@@ -209,16 +1435,20 @@ func shouldBeCopied(pkg *loader.Package, info *markers.TypeInfo) bool {
 
 // hasShallowCopyMethod checks if this type has a manual ShallowCopy method.
 func hasShallowCopyMethod(pkg *loader.Package, typeInfo types.Type) bool {
-	shallowCopyMethod, ind, _ := types.LookupFieldOrMethod(typeInfo, true /* check pointers too */, pkg.Types, "ShallowCopy")
+	method, ind, _ := types.LookupFieldOrMethod(typeInfo, true /* check pointers too */, pkg.Types, shallowCopyMethod)
 	if len(ind) != 1 {
 		// ignore embedded methods
 		return false
 	}
-	if shallowCopyMethod == nil {
+	if method == nil {
 		return false
 	}
 
-	methodSig := shallowCopyMethod.Type().(*types.Signature)
+	methodSig, isFunc := method.Type().(*types.Signature)
+	if !isFunc {
+		// a field with the same name
+		return false
+	}
 	if methodSig.Params() != nil && methodSig.Params().Len() != 0 {
 		return false
 	}
@@ -229,15 +1459,220 @@ func hasShallowCopyMethod(pkg *loader.Package, typeInfo types.Type) bool {
 	return true
 }
 
+// hasValidateMethod checks if this type has a Validate method returning a single error.
+func hasValidateMethod(pkg *loader.Package, typeInfo types.Type) bool {
+	validateMethod, _, _ := types.LookupFieldOrMethod(typeInfo, true /* check pointers too */, pkg.Types, "Validate")
+	if validateMethod == nil {
+		return false
+	}
+
+	methodSig, isFunc := validateMethod.Type().(*types.Signature)
+	if !isFunc {
+		return false
+	}
+	if methodSig.Params() != nil && methodSig.Params().Len() != 0 {
+		return false
+	}
+	if methodSig.Results() == nil || methodSig.Results().Len() != 1 {
+		return false
+	}
+
+	return types.Identical(methodSig.Results().At(0).Type(), types.Universe.Lookup("error").Type())
+}
+
+// copiesItself checks if the given type is a named channel with a
+// ShallowCopy() T method, which the copies of structs call for their fields of
+// the type instead of sharing the channel.
+func copiesItself(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed {
+		return false
+	}
+	if _, isChan := named.Underlying().(*types.Chan); !isChan {
+		return false
+	}
+
+	method, ind, _ := types.LookupFieldOrMethod(named, false /* the fields aren't necessarily addressable */, named.Obj().Pkg(), shallowCopyMethod)
+	methodFunc, isFunc := method.(*types.Func)
+	if len(ind) != 1 || !isFunc {
+		return false
+	}
+
+	methodSig := methodFunc.Type().(*types.Signature)
+	if methodSig.Params().Len() != 0 || methodSig.Results().Len() != 1 {
+		return false
+	}
+
+	return types.Identical(methodSig.Results().At(0).Type(), named)
+}
+
+// fieldValue returns the value the given field of o is copied with.
+func fieldValue(s copyStructs, field string) jen.Code {
+	if s.CopiedFields[field] {
+		return jen.Id("o").Dot(field).Dot(shallowCopyMethod).Call()
+	}
+
+	return jen.Id("o").Dot(field)
+}
+
+// structureHash computes a hash of the field layout of the given struct.
+//
+// The field names, types, tags and their order are taken into account, and so
+// is the layout of the structs (named or not) the fields contain, so the hash
+// changes if and only if the layout of the struct or of any nested struct
+// changes. Only the exported fields of structs of other packages count.
+func structureHash(pkg *types.Package, stype *types.Struct) string {
+	h := fnv.New64a()
+	writeStructure(h, stype, pkg, make(map[*types.Named]bool))
+
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// writeStructure writes the layout of the given type to w, recursing into the
+// named types it refers to once (so recursive types don't recurse forever).
+//
+// The pkg is the package of the marked struct, the unexported fields of other
+// packages' structs are left out.
+func writeStructure(w io.Writer, t types.Type, pkg *types.Package, visited map[*types.Named]bool) {
+	// the types of the package are unqualified, so moving it keeps the hash
+	qualifier := func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+
+		return other.Path()
+	}
+
+	switch t := t.(type) {
+	case *types.Named:
+		fmt.Fprintf(w, "%s\x00", types.TypeString(t, qualifier))
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+
+		writeStructure(w, t.Underlying(), pkg, visited)
+
+	case *types.Pointer:
+		fmt.Fprint(w, "*")
+		writeStructure(w, t.Elem(), pkg, visited)
+
+	case *types.Slice:
+		fmt.Fprint(w, "[]")
+		writeStructure(w, t.Elem(), pkg, visited)
+
+	case *types.Array:
+		fmt.Fprintf(w, "[%d]", t.Len())
+		writeStructure(w, t.Elem(), pkg, visited)
+
+	case *types.Map:
+		fmt.Fprint(w, "map[")
+		writeStructure(w, t.Key(), pkg, visited)
+		fmt.Fprint(w, "]")
+		writeStructure(w, t.Elem(), pkg, visited)
+
+	case *types.Struct:
+		fmt.Fprint(w, "{")
+		for i := 0; i < t.NumFields(); i++ {
+			field := t.Field(i)
+			if !field.Exported() && field.Pkg() != pkg {
+				continue
+			}
+
+			fmt.Fprintf(w, "%s\x00%t\x00%s\x00", field.Name(), field.Anonymous(), t.Tag(i))
+			writeStructure(w, field.Type(), pkg, visited)
+			fmt.Fprint(w, "\x00")
+		}
+		fmt.Fprint(w, "}")
+
+	default:
+		fmt.Fprintf(w, "%s\x00", types.TypeString(t, qualifier))
+	}
+}
+
+// keyValue is a key/value pair of a composite literal.
+type keyValue struct {
+	Key   string
+	Value jen.Code
+}
+
+// orderedDict returns the elements of a composite literal with the given key/value
+// pairs, one per line in the given order (unlike jen.Dict, which sorts them).
+func orderedDict(pairs []keyValue) []jen.Code {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	elements := make([]jen.Code, 0, len(pairs)+1)
+	for _, pair := range pairs {
+		elements = append(elements, jen.Line().Id(pair.Key).Op(":").Add(pair.Value))
+	}
+
+	// the trailing comma (and line break) keeps gofmt from joining the lines
+	return append(elements, jen.Line())
+}
+
+// renderOut renders and gofmt-s the given code, then writes it to the given file.
+func renderOut(ctx *genall.GenerationContext, root *loader.Package, code *jen.File, fileName, headerText string) {
+	var b bytes.Buffer
+
+	err := code.Render(&b)
+	if err != nil {
+		root.AddError(err)
+
+		return
+	}
+
+	formatOut(ctx, root, b.Bytes(), fileName, headerText)
+}
+
+// formatOut prepends the header to the given source code and gofmt-s it, then
+// writes it to the given file.
+//
+// The loader excludes files with the ignore_autogenerated build tag, so that
+// previously generated methods aren't mistaken for manual implementations.
+func formatOut(ctx *genall.GenerationContext, root *loader.Package, source []byte, fileName, headerText string) {
+	var b bytes.Buffer
+
+	// NB: blank line after build tags to distinguish them from comments
+	b.WriteString("// +build !ignore_autogenerated\n\n")
+	if headerText = strings.TrimSpace(headerText); headerText != "" {
+		b.WriteString(headerText + "\n\n")
+	}
+	b.WriteString(generatedComment + "\n\n")
+	b.Write(source)
+
+	outContents, err := format.Source(b.Bytes())
+	if err != nil {
+		root.AddError(err)
+
+		return
+	}
+
+	writeOut(ctx, root, fileName, outContents)
+}
+
 // writeFormatted outputs the given code, after gofmt-ing it.  If we couldn't gofmt,
 // we write the unformatted code for debugging purposes.
-func writeOut(ctx *genall.GenerationContext, root *loader.Package, outBytes []byte) {
-	outputFile, err := ctx.Open(root, "zz_generated.shallowcopy.go")
+func writeOut(ctx *genall.GenerationContext, root *loader.Package, fileName string, outBytes []byte) {
+	outputFile, err := ctx.Open(root, fileName)
 	if err != nil {
 		root.AddError(err)
 		return
 	}
-	defer outputFile.Close()
+	written := false
+	defer func() {
+		// some output rules (e.g. verify) only report problems on close
+		if err := outputFile.Close(); err != nil {
+			root.AddError(err)
+			return
+		}
+
+		// buffered files are recorded when they're actually output
+		if _, buffered := ctx.OutputRule.(*bufferedOutput); written && !buffered {
+			writtenFile(root, fileName, len(outBytes))
+		}
+	}()
 	n, err := outputFile.Write(outBytes)
 	if err != nil {
 		root.AddError(err)
@@ -245,5 +1680,7 @@ func writeOut(ctx *genall.GenerationContext, root *loader.Package, outBytes []by
 	}
 	if n < len(outBytes) {
 		root.AddError(io.ErrShortWrite)
+		return
 	}
+	written = true
 }
@@ -0,0 +1,975 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// registerTestOptions registers the options of the generators once for all
+// the tests, like main does.
+var registerTestOptions sync.Once
+
+// testPackage is a package generated code for by a test.
+type testPackage struct {
+	// dir is the directory of the package, the code is generated into.
+	dir string
+	// errors are the errors of the run (including diagnostics).
+	errors []string
+	// warnings are the warnings reported by the run.
+	warnings []string
+}
+
+// generateTestPackage writes the given files (by slash-separated path) to a new
+// package under testdata, which is removed when the test finishes, and runs the
+// given generators (e.g. "shallowcopy") on it.
+func generateTestPackage(t *testing.T, files map[string]string, generators ...string) testPackage {
+	t.Helper()
+
+	registerTestOptions.Do(registerOptions)
+
+	if err := os.MkdirAll("testdata", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := os.MkdirTemp("testdata", "pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+		// testdata only holds the packages of the tests
+		os.Remove("testdata")
+	})
+
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return testPackage{dir: dir}.generate(t, generators...)
+}
+
+// generate runs the given generators on the package again (e.g. after
+// changing its files), returning the errors and warnings of the run.
+func (pkg testPackage) generate(t *testing.T, generators ...string) testPackage {
+	t.Helper()
+
+	rt, err := genall.FromOptions(optionsRegistry, append(generators, "paths=./"+filepath.ToSlash(pkg.dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt.Run()
+
+	pkg = testPackage{dir: pkg.dir}
+	for _, d := range takeDiagnostics() {
+		if d.diagnostic.Warning {
+			pkg.warnings = append(pkg.warnings, d.diagnostic.Error())
+		}
+	}
+	for _, root := range rt.Roots {
+		for _, err := range root.Errors {
+			pkg.errors = append(pkg.errors, err.Msg)
+		}
+	}
+
+	return pkg
+}
+
+// succeeded fails the test if generating code for the package failed.
+func (pkg testPackage) succeeded(t *testing.T) testPackage {
+	t.Helper()
+
+	if len(pkg.errors) > 0 {
+		t.Fatalf("generating code failed:\n%s", strings.Join(pkg.errors, "\n"))
+	}
+
+	return pkg
+}
+
+// failedWith fails the test unless generating code for the package failed
+// with an error containing the given text (e.g. a diagnostic code).
+func (pkg testPackage) failedWith(t *testing.T, text string) {
+	t.Helper()
+
+	for _, err := range pkg.errors {
+		if strings.Contains(err, text) {
+			return
+		}
+	}
+
+	t.Errorf("generating code didn't fail with %q, errors:\n%s", text, strings.Join(pkg.errors, "\n"))
+}
+
+// warnedWith reports whether generating code for the package warned with a
+// message containing the given text (e.g. a diagnostic code).
+func (pkg testPackage) warnedWith(text string) bool {
+	for _, warning := range pkg.warnings {
+		if strings.Contains(warning, text) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeFile replaces the given file (by slash-separated path) of the package.
+func (pkg testPackage) writeFile(t *testing.T, name, contents string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(pkg.dir, filepath.FromSlash(name)), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// file returns the contents of the given file of the package.
+func (pkg testPackage) file(t *testing.T, name string) string {
+	t.Helper()
+
+	contents, err := os.ReadFile(filepath.Join(pkg.dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(contents)
+}
+
+// test runs the tests of the package (e.g. the ones calling the generated
+// code) with go test.
+func (pkg testPackage) test(t *testing.T) {
+	t.Helper()
+
+	out, err := exec.Command("go", "test", "-count=1", "./"+filepath.ToSlash(pkg.dir)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("testing the generated code failed: %v\n%s", err, out)
+	}
+}
+
+// skipInShortMode skips tests building the generated code (with go test) in short mode.
+func skipInShortMode(t *testing.T) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("building the generated code is skipped in short mode")
+	}
+}
+
+const validatedTypes = `package validated
+
+import "errors"
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:validate-after=true
+// +shallowcopy:generate:into=true
+type Range struct {
+	Min, Max int
+}
+
+func (r Range) Validate() error {
+	if r.Min > r.Max {
+		return errors.New("min is greater than max")
+	}
+
+	return nil
+}
+`
+
+func TestValidateAfter(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": validatedTypes,
+		"types_test.go": `package validated
+
+import "testing"
+
+func TestValidCopy(t *testing.T) {
+	r := Range{Min: 1, Max: 2}
+
+	c, err := r.ShallowCopy()
+	if err != nil {
+		t.Fatalf("ShallowCopy() failed: %v", err)
+	}
+	if c != r {
+		t.Errorf("ShallowCopy() = %v, want %v", c, r)
+	}
+
+	var out Range
+	if err := r.ShallowCopyInto(&out); err != nil {
+		t.Fatalf("ShallowCopyInto() failed: %v", err)
+	}
+	if out != r {
+		t.Errorf("ShallowCopyInto() copied %v, want %v", out, r)
+	}
+}
+
+func TestInvalidCopy(t *testing.T) {
+	r := Range{Min: 2, Max: 1}
+
+	if _, err := r.ShallowCopy(); err == nil {
+		t.Error("ShallowCopy() of an invalid value succeeded")
+	}
+
+	var out Range
+	if err := r.ShallowCopyInto(&out); err == nil {
+		t.Error("ShallowCopyInto() of an invalid value succeeded")
+	}
+}
+`,
+	}, "shallowcopy").succeeded(t).test(t)
+}
+
+func TestValidateAfterWithoutValidate(t *testing.T) {
+	generateTestPackage(t, map[string]string{
+		"types.go": `package validated
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:validate-after=true
+type Range struct {
+	Min, Max int
+}
+`,
+	}, "shallowcopy").failedWith(t, string(codeMissingMethod))
+}
+
+func TestShallowCopyInto(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package into
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:into=true
+type Value struct {
+	Name string
+	// +shallowcopy:skip
+	Cache []int
+	Tags  []string ` + "`copy:\"-\"`" + `
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:into=true
+// +shallowcopy:generate:receiver=pointer
+type Pointer struct {
+	Name string
+	// +shallowcopy:skip
+	Cache []int
+}
+`,
+		"types_test.go": `package into
+
+import "testing"
+
+func TestIntoZeroesSkippedFields(t *testing.T) {
+	out := Value{Name: "old", Cache: []int{1}, Tags: []string{"old"}}
+
+	Value{Name: "new", Cache: []int{2}, Tags: []string{"new"}}.ShallowCopyInto(&out)
+
+	if out.Name != "new" || out.Cache != nil || out.Tags != nil {
+		t.Errorf("ShallowCopyInto() copied %+v, want only the name copied", out)
+	}
+}
+
+func TestIntoFromNilPointer(t *testing.T) {
+	out := Pointer{Name: "old", Cache: []int{1}}
+
+	var o *Pointer
+	o.ShallowCopyInto(&out)
+
+	if out.Name != "" || out.Cache != nil {
+		t.Errorf("ShallowCopyInto() from nil copied %+v, want the zero value", out)
+	}
+}
+`,
+	}, "shallowcopy").succeeded(t).test(t)
+}
+
+// typeWithMarkers returns the info of a type named T with the given marker values.
+func typeWithMarkers(values map[*markers.Definition][]interface{}) *markers.TypeInfo {
+	info := &markers.TypeInfo{Name: "T", Markers: make(markers.MarkerValues, len(values))}
+	for def, defValues := range values {
+		info.Markers[def.Name] = defValues
+	}
+
+	return info
+}
+
+func TestBoolMarkerOnType(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		values []interface{}
+		want   bool
+		fails  bool
+	}{
+		{name: "unset", values: nil, want: false},
+		{name: "set", values: []interface{}{true}, want: true},
+		{name: "repeated", values: []interface{}{true, true}, want: true},
+		{name: "conflicting", values: []interface{}{true, false}, fails: true},
+		{name: "conflicting the other way", values: []interface{}{false, true}, fails: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := boolMarkerOnType(typeWithMarkers(map[*markers.Definition][]interface{}{intoTypeMarker: test.values}), intoTypeMarker)
+
+			switch {
+			case test.fails && err == nil:
+				t.Errorf("boolMarkerOnType() = %v, want an error", got)
+			case test.fails && !strings.Contains(err.Error(), "conflicting values for marker "+intoTypeMarker.Name+" on T"):
+				t.Errorf("boolMarkerOnType() failed with %q, want it to report the conflicting values", err)
+			case !test.fails && err != nil:
+				t.Errorf("boolMarkerOnType() failed: %v", err)
+			case !test.fails && got != test.want:
+				t.Errorf("boolMarkerOnType() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStringMarkerOnType(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		values []interface{}
+		want   string
+		fails  bool
+	}{
+		{name: "unset", values: nil, want: ""},
+		{name: "set", values: []interface{}{"Clone"}, want: "Clone"},
+		{name: "repeated", values: []interface{}{"Clone", "Clone"}, want: "Clone"},
+		{name: "conflicting", values: []interface{}{"Clone", "Copy"}, fails: true},
+		{name: "conflicting the other way", values: []interface{}{"Copy", "Clone"}, fails: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := stringMarkerOnType(typeWithMarkers(map[*markers.Definition][]interface{}{nameTypeMarker: test.values}), nameTypeMarker)
+
+			switch {
+			case test.fails && err == nil:
+				t.Errorf("stringMarkerOnType() = %q, want an error", got)
+			case test.fails && !strings.Contains(err.Error(), "conflicting values for marker "+nameTypeMarker.Name+" on T"):
+				t.Errorf("stringMarkerOnType() failed with %q, want it to report the conflicting values", err)
+			case !test.fails && err != nil:
+				t.Errorf("stringMarkerOnType() failed: %v", err)
+			case !test.fails && got != test.want:
+				t.Errorf("stringMarkerOnType() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOptionsOnTypeMethodName(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		values []interface{}
+		want   string
+		fails  bool
+	}{
+		{name: "default", values: nil, want: shallowCopyMethod},
+		{name: "renamed", values: []interface{}{"Clone"}, want: "Clone"},
+		{name: "unexported", values: []interface{}{"clone"}, fails: true},
+		{name: "not an identifier", values: []interface{}{"Clone()"}, fails: true},
+		{name: "conflicting", values: []interface{}{"Clone", "Copy"}, fails: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := optionsOnType(true, typeWithMarkers(map[*markers.Definition][]interface{}{nameTypeMarker: test.values}))
+
+			switch {
+			case test.fails && err == nil:
+				t.Errorf("optionsOnType() resolved the method name %q, want an error", opts.Method)
+			case !test.fails && err != nil:
+				t.Errorf("optionsOnType() failed: %v", err)
+			case !test.fails && opts.Method != test.want:
+				t.Errorf("optionsOnType() resolved the method name %q, want %q", opts.Method, test.want)
+			}
+		})
+	}
+}
+
+func TestFieldMethodCollision(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		markers string
+		field   string
+	}{
+		{name: "renamed method", markers: "// +shallowcopy:generate:name=Clone\n", field: "Clone"},
+		{name: "into method", markers: "// +shallowcopy:generate:into=true\n", field: "ShallowCopyInto"},
+		{name: "renamed into method", markers: "// +shallowcopy:generate:name=Clone\n// +shallowcopy:generate:into=true\n", field: "CloneInto"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			generateTestPackage(t, map[string]string{
+				"types.go": "package colliding\n\n// +shallowcopy:generate=true\n" + test.markers + "type Config struct {\n\tName string\n\t" + test.field + " bool\n}\n",
+			}, "shallowcopy").failedWith(t, string(codeCollision)+": field "+test.field+" of Config collides with the generated "+test.field+" method")
+		})
+	}
+}
+
+func TestConflictingMarkers(t *testing.T) {
+	generateTestPackage(t, map[string]string{
+		"types.go": `package conflicting
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:into=true
+// +shallowcopy:generate:into=false
+type Config struct {
+	Name string
+}
+`,
+	}, "shallowcopy").failedWith(t, string(codeInvalidMarker)+": conflicting values for marker "+intoTypeMarker.Name+" on Config")
+}
+
+func TestMarkerOrder(t *testing.T) {
+	// the same markers in a different order, on the same type
+	orders := [][]string{
+		{"generate=true", "generate:into=true", "generate:name=Clone", "generate:receiver=pointer", "generate:fuzz=true", "generate:validate-after=true"},
+		{"generate:validate-after=true", "generate:fuzz=true", "generate:receiver=pointer", "generate:name=Clone", "generate:into=true", "generate=true"},
+	}
+
+	var generated []testPackage
+	for _, order := range orders {
+		var types strings.Builder
+		types.WriteString("package ordered\n\nimport \"errors\"\n\n")
+		for _, marker := range order {
+			types.WriteString("// +shallowcopy:" + marker + "\n")
+		}
+		types.WriteString(`type Config struct {
+	Name    string
+	Retries int
+	// +shallowcopy:skip
+	Cache []byte
+}
+
+func (c Config) Validate() error {
+	if c.Retries < 0 {
+		return errors.New("negative retries")
+	}
+
+	return nil
+}
+`)
+
+		generated = append(generated, generateTestPackage(t, map[string]string{"types.go": types.String()}, "shallowcopy").succeeded(t))
+	}
+
+	for _, file := range []string{"zz_generated.shallowcopy.go", "zz_generated.shallowcopy_test.go"} {
+		first, second := generated[0].file(t, file), generated[1].file(t, file)
+		if first != second {
+			t.Errorf("%s depends on the order of the markers:\n%s\nvs\n%s", file, first, second)
+		}
+	}
+
+	if copied := generated[0].file(t, "zz_generated.shallowcopy.go"); !strings.Contains(copied, "func (o *Config) Clone() (*Config, error)") || !strings.Contains(copied, "func (o *Config) CloneInto(out *Config) error") {
+		t.Errorf("the renamed methods aren't generated:\n%s", copied)
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	skipInShortMode(t)
+
+	pkg := generateTestPackage(t, map[string]string{
+		"types.go": `package fuzzed
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:fuzz=true
+// +equal:generate=true
+type Config struct {
+	Name    string
+	Retries int
+	Ratio   float64
+	Data    []byte
+	Labels  map[string]string
+	// +shallowcopy:skip
+	Token string
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:fuzz=true
+type Opaque struct {
+	Labels map[string]string
+}
+`,
+		// the seed corpus runs the fuzz target without fuzzing
+		"testdata/fuzz/FuzzConfig_ShallowCopy/seed": "go test fuzz v1\nstring(\"name\")\nint(3)\nfloat64(0.5)\n[]byte(\"data\")\n",
+	}, "shallowcopy", "equal").succeeded(t)
+
+	fuzz := pkg.file(t, "zz_generated.shallowcopy_test.go")
+
+	if !strings.Contains(fuzz, "func FuzzConfig_ShallowCopy(f *testing.F)") {
+		t.Errorf("the fuzz target of Config isn't generated:\n%s", fuzz)
+	}
+	if !strings.Contains(fuzz, "c.Equal(o)") {
+		t.Errorf("the fuzz target of Config doesn't compare the copy with the generated Equal method:\n%s", fuzz)
+	}
+	if strings.Contains(fuzz, "Token:") {
+		t.Errorf("the fuzz target of Config fills in the skipped Token field, which isn't copied:\n%s", fuzz)
+	}
+	if strings.Contains(fuzz, "FuzzOpaque") {
+		t.Errorf("a fuzz target is generated for Opaque, which has no fuzzable fields:\n%s", fuzz)
+	}
+
+	pkg.test(t)
+}
+
+func TestSchemaVersion(t *testing.T) {
+	const inner = `
+type Inner struct {
+	Host string
+	Port int
+}
+`
+	schemaVersion := regexp.MustCompile(`OuterSchemaVersion = "([0-9a-f]+)"`)
+
+	versionOf := func(types string) string {
+		t.Helper()
+
+		copied := generateTestPackage(t, map[string]string{
+			"types.go": `package versioned
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:schema-version=true
+type Outer struct {
+	Name string
+	Inner
+	Backends []*Backend
+}
+
+type Backend struct {
+	Address Inner
+	Next    *Backend
+}
+` + types,
+		}, "shallowcopy").succeeded(t).file(t, "zz_generated.shallowcopy.go")
+
+		match := schemaVersion.FindStringSubmatch(copied)
+		if match == nil {
+			t.Fatalf("the schema version of Outer isn't emitted:\n%s", copied)
+		}
+
+		return match[1]
+	}
+
+	version := versionOf(inner)
+
+	if changed := versionOf(strings.Replace(inner, "Port int", "Port int64", 1)); changed == version {
+		t.Errorf("the schema version doesn't change with the layout of a nested struct")
+	}
+	if changed := versionOf(strings.Replace(inner, "Port int", "Port int\n\tTLS  bool", 1)); changed == version {
+		t.Errorf("the schema version doesn't change with the fields of a nested struct")
+	}
+
+	unrelated := inner + `
+// Addr returns the address of the host.
+func (i Inner) Addr() string {
+	return i.Host
+}
+
+type Unrelated struct {
+	Inner Inner
+}
+`
+	if unchanged := versionOf(unrelated); unchanged != version {
+		t.Errorf("the schema version changes with unrelated edits: %s, was %s", unchanged, version)
+	}
+}
+
+func TestNamedChannelCopy(t *testing.T) {
+	skipInShortMode(t)
+
+	pkg := generateTestPackage(t, map[string]string{
+		"types.go": `package channels
+
+// +shallowcopy:generate=true
+type Events chan string
+
+// ShallowCopy returns a new channel with the same capacity.
+func (e Events) ShallowCopy() Events {
+	return make(Events, cap(e))
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:into=true
+type Worker struct {
+	Name   string
+	Events Events
+	Done   chan struct{}
+}
+`,
+		"types_test.go": `package channels
+
+import "testing"
+
+func TestCopiesTheNamedChannel(t *testing.T) {
+	w := Worker{Name: "worker", Events: make(Events, 2), Done: make(chan struct{})}
+
+	for _, c := range []Worker{w.ShallowCopy(), func() (out Worker) { w.ShallowCopyInto(&out); return }()} {
+		if c.Name != w.Name || c.Done != w.Done {
+			t.Errorf("the copy %+v doesn't share the other fields of %+v", c, w)
+		}
+		if c.Events == w.Events || cap(c.Events) != 2 {
+			t.Errorf("the copy shares the events channel, want a copy made by Events.ShallowCopy")
+		}
+	}
+}
+`,
+	}, "shallowcopy").succeeded(t)
+
+	if pkg.warnedWith("field Events of Worker") {
+		t.Errorf("the Events field is warned about, though its type copies itself:\n%s", strings.Join(pkg.warnings, "\n"))
+	}
+	if !pkg.warnedWith(string(codeSharedField) + ": field Done of Worker is a channel") {
+		t.Errorf("the Done field isn't warned about, warnings:\n%s", strings.Join(pkg.warnings, "\n"))
+	}
+	if copied := pkg.file(t, "zz_generated.shallowcopy.go"); strings.Contains(copied, "func (o Events)") {
+		t.Errorf("a copy method is generated for Events, which declares its own:\n%s", copied)
+	}
+
+	pkg.test(t)
+}
+
+func TestSkippedEmbeddedField(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package embedded
+
+type Inner struct {
+	Secret string
+}
+
+// +shallowcopy:generate=true
+// +shallowcopy:generate:into=true
+type Outer struct {
+	Name string
+	// +shallowcopy:skip
+	Inner
+	Tags []string
+}
+`,
+		"types_test.go": `package embedded
+
+import "testing"
+
+func TestSkipsTheEmbeddedField(t *testing.T) {
+	o := Outer{Name: "outer", Inner: Inner{Secret: "secret"}, Tags: []string{"a"}}
+
+	out := Outer{Inner: Inner{Secret: "old"}}
+	o.ShallowCopyInto(&out)
+
+	for method, c := range map[string]Outer{"ShallowCopy": o.ShallowCopy(), "ShallowCopyInto": out} {
+		if c.Inner != (Inner{}) {
+			t.Errorf("%s() copied the skipped embedded field: %+v", method, c.Inner)
+		}
+		if c.Name != o.Name || len(c.Tags) != 1 || &c.Tags[0] != &o.Tags[0] {
+			t.Errorf("%s() copied %+v, want the other fields of %+v", method, c, o)
+		}
+	}
+}
+`,
+	}, "shallowcopy").succeeded(t).test(t)
+}
+
+func TestRecursiveDeepCopy(t *testing.T) {
+	skipInShortMode(t)
+
+	pkg := generateTestPackage(t, map[string]string{
+		"types.go": `package recursive
+
+// +deepcopy:generate=true
+type Node struct {
+	Name     string
+	Parent   *Node
+	Children []*Node
+}
+
+// +deepcopy:generate=true
+type Owner struct {
+	Name string
+	Pets []Pet
+}
+
+// +deepcopy:generate=true
+type Pet struct {
+	Name  string
+	Owner *Owner
+}
+`,
+		"types_test.go": `package recursive
+
+import "testing"
+
+func TestParentAndChildren(t *testing.T) {
+	root := &Node{Name: "root"}
+	for _, name := range []string{"a", "b"} {
+		root.Children = append(root.Children, &Node{Name: name, Parent: root})
+	}
+
+	var into Node
+	root.DeepCopyInto(&into)
+
+	for method, c := range map[string]*Node{"DeepCopy": root.DeepCopy(), "DeepCopyInto": &into} {
+		if c == root || len(c.Children) != 2 {
+			t.Fatalf("%s() copied %+v, want a copy of %+v", method, c, root)
+		}
+
+		for i, child := range c.Children {
+			if child == root.Children[i] || child.Name != root.Children[i].Name {
+				t.Errorf("%s() copied child %d to %+v, want a copy of %+v", method, i, child, root.Children[i])
+			}
+			if child.Parent != c {
+				t.Errorf("%s() copied child %d pointing to %p, want it to point to the copied parent %p", method, i, child.Parent, c)
+			}
+		}
+
+		c.Children[0].Name = "changed"
+		if root.Children[0].Name != "a" {
+			t.Errorf("changing the copy of %s() changed the original", method)
+		}
+	}
+}
+
+func TestMutuallyRecursive(t *testing.T) {
+	owner := &Owner{Name: "owner"}
+	owner.Pets = []Pet{{Name: "cat", Owner: owner}, {Name: "dog", Owner: owner}}
+
+	c := owner.DeepCopy()
+
+	for i, pet := range c.Pets {
+		if pet.Owner != c {
+			t.Errorf("the copy of pet %d points to %p, want the copied owner %p", i, pet.Owner, c)
+		}
+	}
+
+	c.Pets[0].Name = "changed"
+	if owner.Pets[0].Name != "cat" {
+		t.Error("changing the copy changed the original")
+	}
+
+	// the pets are copied on their own too
+	pet := owner.Pets[1].DeepCopy()
+	if pet.Owner == owner || pet.Owner.Pets[1].Owner != pet.Owner {
+		t.Errorf("the copied pet refers to %p, want a copy of its owner referring to itself", pet.Owner)
+	}
+}
+`,
+	}, "deepcopy").succeeded(t)
+
+	if copied := pkg.file(t, "zz_generated.deepcopy.go"); !strings.Contains(copied, "func (in *Node) "+trackedDeepCopyMethod+"(out *Node, copied map[interface{}]interface{})") {
+		t.Errorf("the copies of Node don't keep track of the copied values:\n%s", copied)
+	}
+
+	pkg.test(t)
+}
+
+func TestAcyclicDeepCopy(t *testing.T) {
+	copied := generateTestPackage(t, map[string]string{
+		"types.go": `package acyclic
+
+// +deepcopy:generate=true
+// +deepcopy:generate:acyclic=true
+type Tree struct {
+	Name     string
+	Children []*Tree
+}
+`,
+	}, "deepcopy").succeeded(t).file(t, "zz_generated.deepcopy.go")
+
+	if strings.Contains(copied, trackedDeepCopyMethod) {
+		t.Errorf("the copies of the acyclic Tree keep track of the copied values:\n%s", copied)
+	}
+}
+
+func TestDeepCopyOfGenericPointee(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package generic
+
+type Box[T any] struct {
+	Items  []T
+	Copied bool
+}
+
+// DeepCopy copies the box, marking the copy.
+func (b *Box[T]) DeepCopy() *Box[T] {
+	return &Box[T]{Items: append([]T(nil), b.Items...), Copied: true}
+}
+
+type Bag[T any] struct {
+	Items []T
+}
+
+// +deepcopy:generate=true
+type Holder struct {
+	Box   *Box[int]
+	Boxes []*Box[string]
+	Bag   *Bag[int]
+}
+`,
+		"types_test.go": `package generic
+
+import "testing"
+
+func TestCopiesTheBoxes(t *testing.T) {
+	h := &Holder{
+		Box:   &Box[int]{Items: []int{1, 2}},
+		Boxes: []*Box[string]{{Items: []string{"a"}}},
+		Bag:   &Bag[int]{Items: []int{3}},
+	}
+
+	c := h.DeepCopy()
+
+	if c.Box == h.Box || !c.Box.Copied || len(c.Box.Items) != 2 || c.Box.Items[1] != 2 {
+		t.Errorf("the box is copied to %+v, want a copy of %+v made by its DeepCopy method", c.Box, h.Box)
+	}
+	if c.Boxes[0] == h.Boxes[0] || !c.Boxes[0].Copied || c.Boxes[0].Items[0] != "a" {
+		t.Errorf("the boxes are copied to %+v, want copies made by their DeepCopy method", c.Boxes[0])
+	}
+	if c.Bag == h.Bag || len(c.Bag.Items) != 1 || c.Bag.Items[0] != 3 {
+		t.Errorf("the bag is copied to %+v, want a copy of %+v", c.Bag, h.Bag)
+	}
+
+	c.Box.Items[0], c.Boxes[0].Items[0], c.Bag.Items[0] = 0, "", 0
+	if h.Box.Items[0] != 1 || h.Boxes[0].Items[0] != "a" || h.Bag.Items[0] != 3 {
+		t.Errorf("changing the copy changed the original: %+v", h)
+	}
+}
+`,
+	}, "deepcopy").succeeded(t).test(t)
+}
+
+func TestVerifyStaleFiles(t *testing.T) {
+	pkg := generateTestPackage(t, map[string]string{
+		"types.go": `package stale
+
+// +shallowcopy:generate=true
+type Config struct {
+	Name string
+}
+
+// +equal:generate=true
+type Other struct {
+	Name string
+}
+`,
+	}, "shallowcopy", "equal").succeeded(t)
+
+	verify := func() []string {
+		t.Helper()
+
+		rt, err := genall.FromOptions(optionsRegistry, []string{"shallowcopy", "equal", "output:verify", "paths=./" + filepath.ToSlash(pkg.dir)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rt.Run()
+		reportStaleFiles(rt, io.Discard)
+		takeDiagnostics()
+
+		var errs []string
+		for _, root := range rt.Roots {
+			for _, err := range root.Errors {
+				errs = append(errs, err.Error())
+			}
+		}
+
+		return errs
+	}
+
+	if errs := verify(); len(errs) > 0 {
+		t.Fatalf("verifying the generated files failed:\n%s", strings.Join(errs, "\n"))
+	}
+
+	// Other isn't generated for anymore
+	pkg.writeFile(t, "types.go", strings.Replace(pkg.file(t, "types.go"), "// +equal:generate=true\n", "", 1))
+
+	errs := verify()
+	if len(errs) != 1 || !strings.Contains(errs[0], "zz_generated.equal.go is stale") {
+		t.Errorf("verifying the generated files failed with:\n%s\nwant only zz_generated.equal.go reported as stale", strings.Join(errs, "\n"))
+	}
+}
+
+func TestCache(t *testing.T) {
+	const dep = `package dep
+
+type Inner struct {
+	Items []int
+}
+`
+	pkg := generateTestPackage(t, map[string]string{
+		"types.go": `package cached
+
+// +shallowcopy:generate=true
+type Config struct {
+	Name string
+}
+`,
+		"dep/dep.go": dep,
+	}, "shallowcopy")
+
+	cache := "shallowcopy:cache=" + filepath.ToSlash(filepath.Join(pkg.dir, "cache.yaml"))
+
+	pkg.writeFile(t, "types.go", `package cached
+
+import "github.com/banzaicloud/go-code-generation-demo/`+filepath.ToSlash(pkg.dir)+`/dep"
+
+// +shallowcopy:generate=true
+type Config struct {
+	Name  string
+	Inner dep.Inner `+"`copy:\"deep\"`"+`
+	Node  Node      `+"`copy:\"deep\"`"+`
+}
+
+// +deepcopy:generate=true
+type Node struct {
+	Labels map[string]string
+}
+`)
+	pkg.generate(t, cache, "deepcopy").succeeded(t)
+
+	t.Run("deleted output", func(t *testing.T) {
+		if err := os.Remove(filepath.Join(pkg.dir, "zz_generated.shallowcopy.go")); err != nil {
+			t.Fatal(err)
+		}
+
+		pkg.generate(t, cache, "deepcopy").succeeded(t).file(t, "zz_generated.shallowcopy.go")
+	})
+
+	t.Run("changed import", func(t *testing.T) {
+		pkg.writeFile(t, "dep/dep.go", strings.Replace(dep, "Items []int", "Items []int\n\tTags  []string", 1))
+
+		if copied := pkg.generate(t, cache, "deepcopy").succeeded(t).file(t, "zz_generated.shallowcopy.go"); !strings.Contains(copied, "Tags") {
+			t.Errorf("the deep copy of the changed Inner field isn't generated again:\n%s", copied)
+		}
+	})
+
+	t.Run("other generators", func(t *testing.T) {
+		// without the deepcopy generator, Node has no DeepCopyInto method to call
+		if copied := pkg.generate(t, cache).succeeded(t).file(t, "zz_generated.shallowcopy.go"); strings.Contains(copied, "DeepCopyInto") {
+			t.Errorf("the copy isn't generated again without the deepcopy generator:\n%s", copied)
+		}
+	})
+}
@@ -1,9 +1,25 @@
 module github.com/banzaicloud/go-code-generation-demo
 
-go 1.14
+go 1.22.0
 
 require (
 	github.com/dave/jennifer v1.4.0
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/spf13/cobra v0.0.5
+	golang.org/x/tools v0.30.0
 	sigs.k8s.io/controller-tools v0.2.8
+	sigs.k8s.io/yaml v1.1.0
+)
+
+require (
+	github.com/fatih/color v1.7.0 // indirect
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/mattn/go-colorable v0.1.2 // indirect
+	github.com/mattn/go-isatty v0.0.8 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/mod v0.23.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	gopkg.in/yaml.v2 v2.2.4 // indirect
 )
@@ -0,0 +1,321 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// hashMethod is the name of the generated method.
+const hashMethod = "Hash"
+
+var (
+	enableHashTypeMarker = markers.Must(markers.MakeDefinition("hash:generate", markers.DescribesType, false))
+	skipHashFieldMarker  = markers.Must(markers.MakeDefinition("hash:skip", markers.DescribesField, struct{}{}))
+)
+
+func init() {
+	registerGenerator("hash", HashGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// HashGenerator generates code containing Hash method implementations,
+// returning the FNV-1a hash of the fields in the order of declaration.
+//
+// The hashes only depend on the values (not on the process or the platform),
+// so they can be used as cache keys. Values equal according to the generated
+// Equal methods have equal hashes: nil and empty slices and maps are hashed
+// equally, pointers are hashed by the values they point to, and time.Time
+// values by their instant. Types having a Hash method themselves (or
+// generated in the same run) are hashed using it.
+type HashGenerator struct{}
+
+func (HashGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableHashTypeMarker, skipHashFieldMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableHashTypeMarker,
+		markers.SimpleHelp("object", "enables or disables Hash implementation generation for this type"),
+	)
+	into.AddHelp(
+		skipHashFieldMarker,
+		markers.SimpleHelp("object", "leaves this field (e.g. a volatile one) out of the hash"),
+	)
+
+	return nil
+}
+
+func (HashGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableHashTypeMarker, "zz_generated.hash.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		hasher := &fieldHasher{
+			pkg:       root,
+			generated: make(map[string]bool, len(structs)),
+			visiting:  make(map[*types.Named]bool),
+		}
+		for _, s := range structs {
+			hasher.generated[s.Info.Name] = true
+		}
+
+		for _, s := range structs {
+			if err := generateHash(code, hasher, s); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+	})
+}
+
+// generateHash generates the Hash method of the given struct. The returned
+// errors are diagnostics.
+func generateHash(code *jen.File, hasher *fieldHasher, s markedStruct) error {
+	if _, ind, _ := types.LookupFieldOrMethod(s.Type, true, hasher.pkg.Types, hashMethod); len(ind) == 1 {
+		return newDiagnostic(codeCollision, enableHashTypeMarker, "rename it", "%s collides with an existing field or method", hashMethod)
+	}
+
+	body := []jen.Code{jen.Id("b").Op(":=").Make(jen.Index().Byte(), jen.Lit(0), jen.Lit(64))}
+
+	for i := 0; i < s.Struct.NumFields(); i++ {
+		field := s.Struct.Field(i)
+
+		if field.Name() == "_" {
+			continue
+		}
+
+		if i < len(s.Info.Fields) && s.Info.Fields[i].Markers.Get(skipHashFieldMarker.Name) != nil {
+			continue
+		}
+
+		fieldBody, err := hasher.hash("b", func() *jen.Statement { return jen.Id("o").Dot(field.Name()) }, field.Type(), 0)
+		if err != nil {
+			return newDiagnostic(codeUnsupportedType, nil, fmt.Sprintf("skip it with +%s", skipHashFieldMarker.Name), "field %s: %v", field.Name(), err)
+		}
+
+		body = append(body, fieldBody...)
+	}
+
+	body = append(body,
+		jen.Id("h").Op(":=").Qual("hash/fnv", "New64a").Call(),
+		jen.Id("h").Dot("Write").Call(jen.Id("b")),
+		jen.Return(jen.Id("h").Dot("Sum64").Call()),
+	)
+
+	code.Commentf("%s returns the hash of the fields of o, which only depends on their values.", hashMethod)
+	code.Func().
+		Params(jen.Id("o").Id(s.Info.Name)).
+		Id(hashMethod).
+		Params().
+		Params(jen.Uint64()).
+		Block(body...)
+
+	return nil
+}
+
+// fieldHasher emits the statements appending an unambiguous encoding of
+// values of a given type to a byte slice, which is then hashed.
+type fieldHasher struct {
+	pkg *loader.Package
+	// generated lists the types Hash methods are generated for in this package.
+	generated map[string]bool
+	// visiting guards against recursing forever into named types without Hash methods.
+	visiting map[*types.Named]bool
+}
+
+// hasHash checks if the given type has (or will have) a Hash method.
+func (h *fieldHasher) hasHash(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed {
+		return false
+	}
+
+	if named.Obj().Pkg() == h.pkg.Types && h.generated[named.Obj().Name()] {
+		return true
+	}
+
+	return hasHashMethod(named)
+}
+
+// hasHashMethod checks if the given type has a Hash() uint64 method.
+func hasHashMethod(named *types.Named) bool {
+	method, ind, _ := types.LookupFieldOrMethod(named, true /* check pointers too */, named.Obj().Pkg(), hashMethod)
+	if len(ind) != 1 {
+		// ignore embedded methods, they only hash the embedded value
+		return false
+	}
+
+	methodFunc, isFunc := method.(*types.Func)
+	if !isFunc {
+		return false
+	}
+
+	methodSig := methodFunc.Type().(*types.Signature)
+
+	return methodSig.Params().Len() == 0 && methodSig.Results().Len() == 1 &&
+		types.Identical(methodSig.Results().At(0).Type(), types.Typ[types.Uint64])
+}
+
+// hash returns the statements appending the encoding of the given value (of
+// the given type) to the byte slice named buf.
+//
+// The depth is the loop nesting level, used for naming loop variables.
+func (h *fieldHasher) hash(buf string, value func() *jen.Statement, t types.Type, depth int) ([]jen.Code, error) {
+	appendUint64 := func(v jen.Code) jen.Code {
+		return jen.Id(buf).Op("=").Qual("encoding/binary", "LittleEndian").Dot("AppendUint64").Call(jen.Id(buf), v)
+	}
+	appendByte := func(v int) jen.Code {
+		return jen.Id(buf).Op("=").Append(jen.Id(buf), jen.Lit(v))
+	}
+
+	if h.hasHash(t) {
+		return []jen.Code{appendUint64(value().Dot(hashMethod).Call())}, nil
+	}
+
+	if named, isNamed := t.(*types.Named); isNamed {
+		if obj := named.Obj(); obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Time" {
+			// equal instants in different locations are hashed equally, like Equal compares them
+			return []jen.Code{
+				appendUint64(jen.Uint64().Call(value().Dot("Unix").Call())),
+				appendUint64(jen.Uint64().Call(value().Dot("Nanosecond").Call())),
+			}, nil
+		}
+
+		if h.visiting[named] {
+			return nil, fmt.Errorf("recursive type %s needs a Hash method", named.Obj().Name())
+		}
+
+		h.visiting[named] = true
+		defer delete(h.visiting, named)
+	}
+
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic:
+		switch info := underlying.Info(); {
+		case info&types.IsBoolean != 0:
+			return []jen.Code{jen.If(value()).Block(appendByte(1)).Else().Block(appendByte(0))}, nil
+		case info&types.IsString != 0:
+			// strings are prefixed by their length, so that consecutive ones are unambiguous
+			return []jen.Code{
+				appendUint64(jen.Uint64().Call(jen.Len(value()))),
+				jen.Id(buf).Op("=").Append(jen.Id(buf), value().Op("...")),
+			}, nil
+		case info&types.IsFloat != 0:
+			// adding zero turns -0 into 0, so that equal values are hashed equally
+			return []jen.Code{appendUint64(jen.Qual("math", "Float64bits").Call(convertTo(value(), t, types.Float64).Op("+").Lit(0)))}, nil
+		case info&types.IsInteger != 0:
+			return []jen.Code{appendUint64(convertTo(value(), t, types.Uint64))}, nil
+		default:
+			return nil, fmt.Errorf("cannot hash type %s", t)
+		}
+
+	case *types.Pointer:
+		elemValue := func() *jen.Statement { return jen.Parens(jen.Op("*").Add(value())) }
+		if _, isBasic := underlying.Elem().Underlying().(*types.Basic); isBasic {
+			// basic values are only used as operands
+			elemValue = func() *jen.Statement { return jen.Op("*").Add(value()) }
+		}
+
+		elem, err := h.hash(buf, elemValue, underlying.Elem(), depth)
+		if err != nil {
+			return nil, err
+		}
+
+		return []jen.Code{jen.If(value().Op("==").Nil()).Block(appendByte(0)).Else().Block(append([]jen.Code{appendByte(1)}, elem...)...)}, nil
+
+	case *types.Slice, *types.Array:
+		var elemType types.Type
+		var stmts []jen.Code
+
+		if slice, isSlice := underlying.(*types.Slice); isSlice {
+			elemType = slice.Elem()
+			stmts = append(stmts, appendUint64(jen.Uint64().Call(jen.Len(value()))))
+		} else {
+			elemType = underlying.(*types.Array).Elem()
+		}
+
+		index := loopVar("i", depth)
+		elem, err := h.hash(buf, func() *jen.Statement { return value().Index(jen.Id(index)) }, elemType, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(stmts, jen.For(jen.Id(index).Op(":=").Range().Add(value())).Block(elem...)), nil
+
+	case *types.Map:
+		key, val, entry, entryHash, sum := loopVar("key", depth), loopVar("val", depth), loopVar("entry", depth), loopVar("entryHash", depth), loopVar("sum", depth)
+
+		keyStmts, err := h.hash(entry, func() *jen.Statement { return jen.Id(key) }, underlying.Key(), depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		valStmts, err := h.hash(entry, func() *jen.Statement { return jen.Id(val) }, underlying.Elem(), depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// the entries are hashed separately, and their hashes are summed
+		// up, so that the order of iteration doesn't matter
+		loopBody := append([]jen.Code{jen.Id(entry).Op("=").Id(entry).Index(jen.Empty(), jen.Lit(0))}, keyStmts...)
+		loopBody = append(loopBody, valStmts...)
+		loopBody = append(loopBody,
+			jen.Id(entryHash).Dot("Reset").Call(),
+			jen.Id(entryHash).Dot("Write").Call(jen.Id(entry)),
+			jen.Id(sum).Op("+=").Id(entryHash).Dot("Sum64").Call(),
+		)
+
+		return []jen.Code{
+			appendUint64(jen.Uint64().Call(jen.Len(value()))),
+			jen.Var().Id(sum).Uint64(),
+			jen.Var().Id(entry).Index().Byte(),
+			jen.Id(entryHash).Op(":=").Qual("hash/fnv", "New64a").Call(),
+			jen.For(jen.List(jen.Id(key), jen.Id(val)).Op(":=").Range().Add(value())).Block(loopBody...),
+			appendUint64(jen.Id(sum)),
+		}, nil
+
+	case *types.Struct:
+		var stmts []jen.Code
+
+		for i := 0; i < underlying.NumFields(); i++ {
+			field := underlying.Field(i)
+
+			if field.Name() == "_" {
+				continue
+			}
+
+			if !field.Exported() && field.Pkg() != h.pkg.Types {
+				return nil, fmt.Errorf("cannot hash unexported field %s of %s", field.Name(), t)
+			}
+
+			fieldStmts, err := h.hash(buf, func() *jen.Statement { return value().Dot(field.Name()) }, field.Type(), depth)
+			if err != nil {
+				return nil, err
+			}
+
+			stmts = append(stmts, fieldStmts...)
+		}
+
+		return stmts, nil
+
+	default:
+		return nil, fmt.Errorf("cannot hash type %s", t)
+	}
+}
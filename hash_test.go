@@ -0,0 +1,114 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestHash(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package hashed
+
+import "time"
+
+// +hash:generate=true
+// +equal:generate=true
+type Key struct {
+	Table   string
+	Columns []string
+	Offset  *uint
+	Ratio   float64
+	Since   time.Time
+	Filters map[string]Filter
+	Flags   [2]bool
+	// +hash:skip
+	TraceID string
+}
+
+// +hash:generate=true
+// +equal:generate=true
+type Filter struct {
+	Op     string
+	Values []string
+}
+`,
+		"types_test.go": `package hashed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHash(t *testing.T) {
+	ten, otherTen, eleven := uint(10), uint(10), uint(11)
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	base := func() Key {
+		return Key{
+			Table:   "users",
+			Columns: []string{"id", "name"},
+			Offset:  &ten,
+			Ratio:   0.5,
+			Since:   since,
+			Filters: map[string]Filter{"a": {Op: "=", Values: []string{"1"}}, "b": {Op: "<"}},
+			Flags:   [2]bool{true, false},
+			TraceID: "trace",
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		change func(k *Key)
+		equal  bool
+	}{
+		{name: "same", change: func(k *Key) {}, equal: true},
+		{name: "skipped field", change: func(k *Key) { k.TraceID = "other" }, equal: true},
+		{name: "pointer to an equal value", change: func(k *Key) { k.Offset = &otherTen }, equal: true},
+		{name: "another location of the instant", change: func(k *Key) { k.Since = since.In(time.FixedZone("CET", 3600)) }, equal: true},
+		{name: "map built in another order", change: func(k *Key) {
+			k.Filters = make(map[string]Filter)
+			k.Filters["b"] = Filter{Op: "<"}
+			k.Filters["a"] = Filter{Op: "=", Values: []string{"1"}}
+		}, equal: true},
+		{name: "table", change: func(k *Key) { k.Table = "groups" }},
+		{name: "column order", change: func(k *Key) { k.Columns = []string{"name", "id"} }},
+		{name: "columns split differently", change: func(k *Key) { k.Columns = []string{"idname"} }},
+		{name: "pointed value", change: func(k *Key) { k.Offset = &eleven }},
+		{name: "nil pointer", change: func(k *Key) { k.Offset = nil }},
+		{name: "ratio", change: func(k *Key) { k.Ratio = 0.25 }},
+		{name: "since", change: func(k *Key) { k.Since = since.Add(time.Nanosecond) }},
+		{name: "filter", change: func(k *Key) { k.Filters["b"] = Filter{Op: ">"} }},
+		{name: "flags", change: func(k *Key) { k.Flags = [2]bool{false, true} }},
+	} {
+		changed := base()
+		test.change(&changed)
+
+		if equal := base().Hash() == changed.Hash(); equal != test.equal {
+			t.Errorf("%s: equal hashes = %v, want %v", test.name, equal, test.equal)
+		}
+		if test.equal && !base().Equal(changed) && test.name != "skipped field" {
+			t.Errorf("%s: values with equal hashes aren't Equal", test.name)
+		}
+	}
+
+	// nil and empty slices and maps are hashed equally, like they're Equal
+	if (Key{Columns: []string{}, Filters: map[string]Filter{}}).Hash() != (Key{}).Hash() {
+		t.Error("Hash() tells empty slices and maps from nil ones")
+	}
+}
+`,
+	}, "hash", "equal").succeeded(t).test(t)
+}
@@ -0,0 +1,263 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+const (
+	// immutableMethod returns the immutable wrapper of a value.
+	immutableMethod = "Immutable"
+	// mutableMethod returns a mutable copy of the wrapped value.
+	mutableMethod = "Mutable"
+)
+
+var (
+	enableImmutableTypeMarker = markers.Must(markers.MakeDefinition("immutable:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("immutable", ImmutableGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// ImmutableGenerator generates read-only Immutable<Type> wrappers of structs,
+// returned by their Immutable methods.
+//
+// The wrappers have a getter named after each exported field, and With<Field>
+// methods returning a modified copy (made by ShallowCopy, which has to be
+// generated in the same run or declared). Slices and maps are copied when
+// passed to or returned by them, so the wrapped values can't be modified
+// through them, but the values they (and pointers) refer to are shared.
+type ImmutableGenerator struct{}
+
+func (ImmutableGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableImmutableTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableImmutableTypeMarker,
+		markers.SimpleHelp("object", "enables or disables immutable wrapper generation for this type"),
+	)
+
+	return nil
+}
+
+func (ImmutableGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableImmutableTypeMarker, "zz_generated.immutable.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		// copy using ShallowCopy methods generated in the same run as well
+		allTypes, err := enabledOnPackage(ctx.Collector, root)
+		if err != nil {
+			root.AddError(err)
+
+			return
+		}
+
+		for _, s := range structs {
+			if err := generateImmutable(code, root, allTypes, s); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+	})
+}
+
+// generateImmutable generates the immutable wrapper of the given struct, and
+// its Immutable method. The returned errors are diagnostics.
+func generateImmutable(code *jen.File, pkg *loader.Package, allTypes bool, s markedStruct) error {
+	wrapper := immutableMethod + s.Info.Name
+
+	if pkg.Types.Scope().Lookup(wrapper) != nil {
+		return newDiagnostic(codeCollision, enableImmutableTypeMarker, "rename it", "%s collides with an existing declaration in package %s", wrapper, pkg.PkgPath)
+	}
+
+	if _, ind, _ := types.LookupFieldOrMethod(s.Type, true, pkg.Types, immutableMethod); len(ind) == 1 {
+		return newDiagnostic(codeCollision, enableImmutableTypeMarker, "rename it", "%s collides with an existing field or method", immutableMethod)
+	}
+
+	copied, err := shallowCopyCall(pkg, allTypes, s)
+	if err != nil {
+		return err
+	}
+
+	var fields []*types.Var
+	methods := map[string]bool{mutableMethod: true}
+
+	for i := 0; i < s.Struct.NumFields(); i++ {
+		field := s.Struct.Field(i)
+		if !field.Exported() {
+			continue
+		}
+
+		for _, method := range []string{field.Name(), "With" + field.Name()} {
+			if methods[method] {
+				return newDiagnostic(codeCollision, enableImmutableTypeMarker, "rename one of the fields", "the %s method of %s would be declared twice", method, wrapper)
+			}
+			methods[method] = true
+		}
+
+		fields = append(fields, field)
+	}
+
+	// slices and maps are copied when entering and leaving the wrapper, so they're only shared between wrappers
+	cloned := func(value *jen.Statement) []jen.Code {
+		body := []jen.Code{jen.Id("c").Op(":=").Add(copied(value))}
+		for i := 0; i < s.Struct.NumFields(); i++ {
+			field := s.Struct.Field(i)
+			if field.Name() == "_" {
+				continue
+			}
+
+			if clone := immutableValue(jen.Id("c").Dot(field.Name()), field.Type()); clone != nil {
+				body = append(body, jen.Id("c").Dot(field.Name()).Op("=").Add(clone))
+			}
+		}
+
+		return body
+	}
+
+	code.ImportName("maps", "maps")
+	code.ImportName("slices", "slices")
+
+	code.Commentf("%s is a read-only %s, returned by its %s method.", wrapper, s.Info.Name, immutableMethod)
+	code.Type().Id(wrapper).Struct(jen.Id("o").Id(s.Info.Name))
+
+	code.Commentf("%s returns a read-only copy of o.", immutableMethod)
+	code.Func().
+		Params(jen.Id("o").Id(s.Info.Name)).
+		Id(immutableMethod).
+		Params().
+		Id(wrapper).
+		Block(append(cloned(jen.Id("o")),
+			jen.Line(),
+			jen.Return(jen.Id(wrapper).Values(jen.Dict{jen.Id("o"): jen.Id("c")})),
+		)...)
+
+	code.Commentf("%s returns a copy of the wrapped %s, which can be modified.", mutableMethod, s.Info.Name)
+	code.Func().
+		Params(jen.Id("i").Id(wrapper)).
+		Id(mutableMethod).
+		Params().
+		Id(s.Info.Name).
+		Block(append(cloned(jen.Id("i").Dot("o")),
+			jen.Line(),
+			jen.Return(jen.Id("c")),
+		)...)
+
+	for _, field := range fields {
+		code.Commentf("%s returns the %s field of the wrapped %s.", field.Name(), field.Name(), s.Info.Name)
+		code.Func().
+			Params(jen.Id("i").Id(wrapper)).
+			Id(field.Name()).
+			Params().
+			Add(typeCode(pkg, field.Type())).
+			Block(jen.Return(immutableOrValue(jen.Id("i").Dot("o").Dot(field.Name()), field.Type())))
+
+		code.Commentf("With%s returns a copy of i with the %s field set to the given value.", field.Name(), field.Name())
+		code.Func().
+			Params(jen.Id("i").Id(wrapper)).
+			Id("With"+field.Name()).
+			Params(jen.Id("value").Add(typeCode(pkg, field.Type()))).
+			Id(wrapper).
+			Block(
+				jen.Id("o").Op(":=").Add(copied(jen.Id("i").Dot("o"))),
+				jen.Id("o").Dot(field.Name()).Op("=").Add(immutableOrValue(jen.Id("value"), field.Type())),
+				jen.Line(),
+				jen.Return(jen.Id(wrapper).Values(jen.Dict{jen.Id("o"): jen.Id("o")})),
+			)
+	}
+
+	return nil
+}
+
+// shallowCopyCall returns how the given struct is copied using its ShallowCopy
+// method, which is either generated in the same run or declared already. The
+// returned errors are diagnostics.
+func shallowCopyCall(pkg *loader.Package, allTypes bool, s markedStruct) (func(value jen.Code) *jen.Statement, error) {
+	opts, err := optionsOnType(allTypes, s.Info)
+	if err != nil {
+		return nil, newDiagnostic(codeInvalidMarker, nil, "", "%v", err)
+	}
+
+	var pointer bool
+
+	// the method may be named otherwise, and declared methods aren't generated, even if enabled
+	methodName := shallowCopyMethod
+	if opts.Enabled {
+		methodName = opts.Method
+	}
+
+	if opts.Enabled && !declaresMethod(pkg, s.Type, methodName) {
+		if opts.ValidateAfter {
+			return nil, newDiagnostic(codeUnsupportedOption, validateAfterTypeMarker, "remove the marker",
+				"%s can't return an error (validating the copy) to be used by the immutable wrapper", methodName)
+		}
+
+		pointer = opts.Pointer
+	} else {
+		method, _, _ := types.LookupFieldOrMethod(s.Type, true, pkg.Types, methodName)
+		fn, isFunc := method.(*types.Func)
+		if !isFunc {
+			return nil, newDiagnostic(codeMissingMethod, nil, fmt.Sprintf("mark the type with +%s, and generate it in the same run", enableTypeMarker.Name),
+				"%s has to be generated in the same run (or declared) to be used by the immutable wrapper", methodName)
+		}
+
+		sig := fn.Type().(*types.Signature)
+		switch {
+		case sig.Params().Len() == 0 && sig.Results().Len() == 1 && types.Identical(sig.Results().At(0).Type(), s.Type):
+		case sig.Params().Len() == 0 && sig.Results().Len() == 1 && types.Identical(sig.Results().At(0).Type(), types.NewPointer(s.Type)):
+			pointer = true
+		default:
+			return nil, newDiagnostic(codeMissingMethod, nil, "", "%s has to return just the copy to be used by the immutable wrapper", methodName)
+		}
+	}
+
+	return func(value jen.Code) *jen.Statement {
+		if pointer {
+			return jen.Op("*").Add(value).Dot(methodName).Call()
+		}
+
+		return jen.Add(value).Dot(methodName).Call()
+	}, nil
+}
+
+// immutableValue returns a copy of the given slice or map, so it isn't shared with the wrapped value (nil for other types).
+func immutableValue(value *jen.Statement, t types.Type) *jen.Statement {
+	switch t.Underlying().(type) {
+	case *types.Slice:
+		return jen.Qual("slices", "Clone").Call(value)
+	case *types.Map:
+		return jen.Qual("maps", "Clone").Call(value)
+	default:
+		return nil
+	}
+}
+
+// immutableOrValue returns a copy of the given slice or map, or the value itself for other types.
+func immutableOrValue(value *jen.Statement, t types.Type) *jen.Statement {
+	if clone := immutableValue(value.Clone(), t); clone != nil {
+		return clone
+	}
+
+	return value
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -30,6 +31,13 @@ import (
 )
 
 var (
+	// allGenerators maintains the list of all known generators, giving
+	// them names for use on the command line.
+	// each turns into a command line option,
+	// and has options for output forms.
+	// Generators add themselves using registerGenerator.
+	allGenerators = map[string]genall.Generator{}
+
 	// allOutputRules defines the list of all known output rules, giving
 	// them names for use on the command line.
 	// Each output rule turns into two command line options:
@@ -40,36 +48,40 @@ var (
 		"none":      genall.OutputToNothing,
 		"stdout":    genall.OutputToStdout,
 		"artifacts": genall.OutputArtifacts{},
+		"verify":    OutputVerify{},
+		"base":      OutputToBase(""),
 	}
 
 	// optionsRegistry contains all the marker definitions used to process command line options
 	optionsRegistry = &markers.Registry{}
 )
 
-func init() {
-	genName := "shallowcopy"
-	var gen genall.Generator = Generator{}
-
-	// make the generator options marker itself
-	defn := markers.Must(markers.MakeDefinition(genName, markers.DescribesPackage, gen))
-	if err := optionsRegistry.Register(defn); err != nil {
-		panic(err)
-	}
-	if helpGiver, hasHelp := gen.(genall.HasHelp); hasHelp {
-		if help := helpGiver.Help(); help != nil {
-			optionsRegistry.AddHelp(defn, help)
-		}
-	}
-
-	// make per-generation output rule markers
-	for ruleName, rule := range allOutputRules {
-		ruleMarker := markers.Must(markers.MakeDefinition(fmt.Sprintf("output:%s:%s", genName, ruleName), markers.DescribesPackage, rule))
-		if err := optionsRegistry.Register(ruleMarker); err != nil {
+// registerOptions registers the options of all the generators and output rules.
+//
+// It runs from main instead of init, after all the generators have registered themselves.
+func registerOptions() {
+	for genName, gen := range allGenerators {
+		// make the generator options marker itself
+		defn := markers.Must(markers.MakeDefinition(genName, markers.DescribesPackage, gen))
+		if err := optionsRegistry.Register(defn); err != nil {
 			panic(err)
 		}
-		if helpGiver, hasHelp := rule.(genall.HasHelp); hasHelp {
+		if helpGiver, hasHelp := gen.(genall.HasHelp); hasHelp {
 			if help := helpGiver.Help(); help != nil {
-				optionsRegistry.AddHelp(ruleMarker, help)
+				optionsRegistry.AddHelp(defn, help)
+			}
+		}
+
+		// make per-generation output rule markers
+		for ruleName, rule := range allOutputRules {
+			ruleMarker := markers.Must(markers.MakeDefinition(fmt.Sprintf("output:%s:%s", genName, ruleName), markers.DescribesPackage, rule))
+			if err := optionsRegistry.Register(ruleMarker); err != nil {
+				panic(err)
+			}
+			if helpGiver, hasHelp := rule.(genall.HasHelp); hasHelp {
+				if help := helpGiver.Help(); help != nil {
+					optionsRegistry.AddHelp(ruleMarker, help)
+				}
 			}
 		}
 	}
@@ -99,9 +111,18 @@ func init() {
 type noUsageError struct{ error }
 
 func main() {
+	registerOptions()
+
 	helpLevel := 0
 	whichLevel := 0
 	showVersion := false
+	var paths []string
+	outputBase := ""
+	typeFilterExpr := ""
+	dryRun := false
+	watch := false
+	strict := false
+	var report reportOptions
 
 	cmd := &cobra.Command{
 		Use:   "shallowcopy",
@@ -136,16 +157,65 @@ func main() {
 				return printMarkerDocs(c, rawOpts, whichLevel)
 			}
 
+			// the flags are shorthands for the corresponding options
+			for _, path := range paths {
+				rawOpts = append(rawOpts, "paths="+path)
+			}
+			if outputBase != "" {
+				rawOpts = append(rawOpts, "output:base="+outputBase)
+			}
+
+			strictDiagnostics = strict
+
+			if report.Format != "" && report.Format != jsonReport {
+				return fmt.Errorf("unsupported report format %q: only %s is supported", report.Format, jsonReport)
+			}
+			report.Stdout = c.OutOrStdout()
+
+			if typeFilterExpr != "" {
+				var err error
+				if typeFilter, err = regexp.Compile(typeFilterExpr); err != nil {
+					return fmt.Errorf("invalid type filter: %w", err)
+				}
+			}
+
 			// otherwise, set up the runtime for actually running the generators
-			rt, err := genall.FromOptions(optionsRegistry, rawOpts)
+			newRuntime := func() (*genall.Runtime, error) {
+				rt, err := genall.FromOptions(optionsRegistry, rawOpts)
+				if err != nil {
+					return nil, err
+				}
+				if dryRun {
+					// the listing would make the report printed on stdout unparseable
+					listing := c.OutOrStdout()
+					if report.Format != "" && report.File == "" {
+						listing = c.OutOrStderr()
+					}
+					rt.OutputRules = genall.OutputRules{Default: outputDryRun{out: listing}}
+				}
+				if len(rt.Generators) == 0 {
+					return nil, fmt.Errorf("no generators specified")
+				}
+
+				return rt, nil
+			}
+
+			run := func(rt *genall.Runtime) bool {
+				return runAndReport(rt, c.OutOrStderr(), report)
+			}
+
+			if watch {
+				return watchAndRun(c.OutOrStderr(), newRuntime, run)
+			}
+
+			rt, err := newRuntime()
 			if err != nil {
 				return err
 			}
-			if len(rt.Generators) == 0 {
-				return fmt.Errorf("no generators specified")
-			}
 
-			if hadErrs := rt.Run(); hadErrs {
+			hadErrs := run(rt)
+
+			if hadErrs {
 				// don't obscure the actual error with a bunch of usage
 				return noUsageError{fmt.Errorf("not all generators ran successfully")}
 			}
@@ -156,6 +226,14 @@ func main() {
 	cmd.Flags().CountVarP(&whichLevel, "which-markers", "w", "print out all markers available with the requested generators\n(up to -www for the most detailed output, or -wwww for json output)")
 	cmd.Flags().CountVarP(&helpLevel, "detailed-help", "h", "print out more detailed help\n(up to -hhh for the most detailed output, or -hhhh for json output)")
 	cmd.Flags().BoolVar(&showVersion, "version", false, "show version")
+	cmd.Flags().StringSliceVar(&paths, "paths", nil, "paths and go-style path patterns of the packages to generate code for\n(same as the paths option)")
+	cmd.Flags().StringVar(&outputBase, "output-base", "", "write generated code to the directory of each package's import path under this directory\n(same as the output:base option)")
+	cmd.Flags().StringVar(&typeFilterExpr, "type-filter", "", "only generate code for types with names matching this regular expression")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the files that would be generated without writing them\n(overrides all output rules)")
+	cmd.Flags().BoolVar(&watch, "watch", false, "run the generators again whenever the source files of the packages change")
+	cmd.Flags().BoolVar(&strict, "strict", false, "fail the run on warnings too (e.g. about marked types that are skipped)")
+	cmd.Flags().StringVar(&report.Format, "report", "", "write a summary of the run in the given format (json): packages scanned, types matched per marker,\nfiles written or skipped, durations per package and all diagnostics")
+	cmd.Flags().StringVar(&report.File, "report-file", "", "write the report to this file instead of stdout")
 	cmd.Flags().Bool("help", false, "print out usage and a summary of options")
 	oldUsage := cmd.UsageFunc()
 	cmd.SetUsageFunc(func(c *cobra.Command) error {
@@ -0,0 +1,1002 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+const (
+	marshalJSONMethod   = "MarshalJSON"
+	unmarshalJSONMethod = "UnmarshalJSON"
+	// appendJSONMethod and decodeJSONMethod do the actual work, so that fields
+	// of generated types can be encoded and decoded in place.
+	appendJSONMethod = "appendJSON"
+	decodeJSONMethod = "decodeJSON"
+)
+
+var (
+	enableMarshalTypeMarker = markers.Must(markers.MakeDefinition("marshal:generate", markers.DescribesType, false))
+)
+
+var (
+	errorType     = types.Universe.Lookup("error").Type()
+	byteSliceType = types.NewSlice(types.Typ[types.Byte])
+
+	jsonMarshalerInterface   = methodInterface("MarshalJSON", nil, []types.Type{byteSliceType, errorType})
+	jsonUnmarshalerInterface = methodInterface("UnmarshalJSON", []types.Type{byteSliceType}, []types.Type{errorType})
+	textMarshalerInterface   = methodInterface("MarshalText", nil, []types.Type{byteSliceType, errorType})
+	textUnmarshalerInterface = methodInterface("UnmarshalText", []types.Type{byteSliceType}, []types.Type{errorType})
+)
+
+func init() {
+	registerGenerator("marshal", MarshalGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// MarshalGenerator generates code containing MarshalJSON and UnmarshalJSON
+// method implementations, encoding and decoding structs without reflection,
+// like encoding/json does (honoring json tags, omitempty and the fields of
+// embedded structs).
+//
+// Fields have to be of basic, pointer, slice, array or string keyed map types,
+// of types implementing the json or encoding marshaler interfaces, or of types
+// generated in the same run (by marshal, or enum for the text interfaces).
+// The code reading JSON is written once per package, into a separate file.
+type MarshalGenerator struct{}
+
+func (MarshalGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableMarshalTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableMarshalTypeMarker,
+		markers.SimpleHelp("object", "enables or disables MarshalJSON and UnmarshalJSON implementation generation for this type"),
+	)
+
+	return nil
+}
+
+func (MarshalGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableMarshalTypeMarker, "zz_generated.marshal.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		for _, decl := range jsonSupportDecls {
+			if root.Types.Scope().Lookup(decl) != nil {
+				report(root, structs[0].Info.RawSpec, newDiagnostic(codeCollision, enableMarshalTypeMarker, "rename it",
+					"%s collides with an existing declaration in package %s", decl, root.PkgPath))
+
+				return
+			}
+		}
+
+		// enums generated in the same run are text marshalers
+		enums, err := markedTypeNames(ctx.Collector, root, enableEnumTypeMarker)
+		if err != nil {
+			root.AddError(err)
+
+			return
+		}
+
+		coder := &jsonCoder{
+			pkg:       root,
+			generated: make(map[string]bool, len(structs)),
+			enums:     enums,
+		}
+		for _, s := range structs {
+			coder.generated[s.Info.Name] = true
+		}
+
+		for _, s := range structs {
+			if err := coder.generate(code, s); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+
+		formatOut(ctx, root, []byte("package "+root.Name+"\n"+jsonSupportSource), "zz_generated.marshal_support.go", "")
+	})
+}
+
+// jsonField is a field encoded by encoding/json (possibly promoted from embedded structs).
+type jsonField struct {
+	// name is the key of the field.
+	name string
+	// path is the field itself, preceded by the embedded fields it's promoted from.
+	path []*types.Var
+	// index is the index of each field of path in its struct.
+	index     []int
+	tagged    bool
+	omitEmpty bool
+	quoted    bool
+}
+
+// jsonFields returns the fields of the given struct encoded by encoding/json,
+// in the same order, resolving the names promoted from embedded structs by the
+// same rules.
+func jsonFields(pkg *loader.Package, stype *types.Struct) ([]jsonField, error) {
+	type embedded struct {
+		stype *types.Struct
+		field jsonField
+	}
+
+	var fields []jsonField
+
+	next := []embedded{{stype: stype}}
+	visited := make(map[*types.Struct]bool)
+
+	// fields of embedded structs are visited breadth first, struct types are
+	// only visited once (at the lowest depth)
+	for len(next) > 0 {
+		current := next
+		next = nil
+
+		for _, e := range current {
+			if visited[e.stype] {
+				continue
+			}
+			visited[e.stype] = true
+
+			for i := 0; i < e.stype.NumFields(); i++ {
+				field := e.stype.Field(i)
+
+				tag := reflect.StructTag(e.stype.Tag(i)).Get("json")
+				if tag == "-" {
+					continue
+				}
+
+				name, options, _ := strings.Cut(tag, ",")
+
+				f := jsonField{
+					name:   name,
+					path:   append(e.field.path[:len(e.field.path):len(e.field.path)], field),
+					index:  append(e.field.index[:len(e.field.index):len(e.field.index)], i),
+					tagged: name != "",
+				}
+
+				for _, option := range strings.Split(options, ",") {
+					switch option {
+					case "omitempty":
+						f.omitEmpty = true
+					case "string":
+						f.quoted = true
+					}
+				}
+
+				if field.Anonymous() {
+					t := field.Type()
+
+					pointer, isPointer := t.(*types.Pointer)
+					if isPointer {
+						t = pointer.Elem()
+					}
+
+					embeddedStruct, isStruct := t.Underlying().(*types.Struct)
+
+					// unexported embedded structs are only visited if they don't
+					// need to be allocated, like encoding/json does
+					if !field.Exported() && (isPointer || !isStruct) {
+						continue
+					}
+
+					if name == "" && isStruct {
+						next = append(next, embedded{stype: embeddedStruct, field: f})
+
+						continue
+					}
+				} else if !field.Exported() {
+					continue
+				}
+
+				for _, step := range f.path {
+					if !step.Exported() && step.Pkg() != pkg.Types {
+						return nil, fmt.Errorf("field %s is promoted from an unexported field of another package", field.Name())
+					}
+				}
+
+				if f.name == "" {
+					f.name = field.Name()
+				}
+
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	// the shallowest field of a name wins, if there's only one (or one with a tag)
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].name != fields[j].name {
+			return fields[i].name < fields[j].name
+		}
+
+		if len(fields[i].path) != len(fields[j].path) {
+			return len(fields[i].path) < len(fields[j].path)
+		}
+
+		return fields[i].tagged && !fields[j].tagged
+	})
+
+	dominant := fields[:0]
+
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+
+		candidates := fields[i:j]
+		depth := len(candidates[0].path)
+
+		switch {
+		case len(candidates) == 1 || len(candidates[1].path) > depth:
+			dominant = append(dominant, candidates[0])
+		case candidates[0].tagged && !candidates[1].tagged:
+			dominant = append(dominant, candidates[0])
+		}
+
+		i = j
+	}
+
+	sort.Slice(dominant, func(i, j int) bool {
+		a, b := dominant[i].index, dominant[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+
+		return len(a) < len(b)
+	})
+
+	return dominant, nil
+}
+
+// jsonOperand is a value encoded or decoded by the generated code.
+type jsonOperand struct {
+	// value is the value itself (always addressable).
+	value func() *jen.Statement
+	// pointer is the pointer the value is dereferenced from, if any.
+	pointer func() *jen.Statement
+}
+
+// elem returns the value the operand (of a pointer type) points to.
+func (o jsonOperand) elem() jsonOperand {
+	return jsonOperand{
+		value:   func() *jen.Statement { return jen.Op("*").Add(o.value()) },
+		pointer: o.value,
+	}
+}
+
+// address returns a pointer to the value.
+func (o jsonOperand) address() *jen.Statement {
+	if o.pointer != nil {
+		return o.pointer()
+	}
+
+	return jen.Op("&").Add(o.value())
+}
+
+// receiver returns the value to call methods on (or the pointer it's dereferenced from).
+func (o jsonOperand) receiver() *jen.Statement {
+	if o.pointer != nil {
+		return o.pointer()
+	}
+
+	return o.value()
+}
+
+// operand returns the value to be used as an operand of other expressions.
+func (o jsonOperand) operand() *jen.Statement {
+	if o.pointer != nil {
+		return jen.Parens(o.value())
+	}
+
+	return o.value()
+}
+
+// jsonCoder generates the code encoding and decoding the values of a package.
+type jsonCoder struct {
+	pkg *loader.Package
+	// generated contains the structs generated in the same run.
+	generated map[string]bool
+	// enums contains the enums generated in the same run.
+	enums map[string]bool
+	// usesErr is set when the encoding code uses the err variable.
+	usesErr bool
+}
+
+// generate generates the MarshalJSON and UnmarshalJSON methods of the given
+// struct. The returned errors are diagnostics.
+func (c *jsonCoder) generate(code *jen.File, s markedStruct) error {
+	for _, method := range []string{marshalJSONMethod, unmarshalJSONMethod, appendJSONMethod, decodeJSONMethod} {
+		if _, ind, _ := types.LookupFieldOrMethod(s.Type, true, c.pkg.Types, method); len(ind) == 1 {
+			return newDiagnostic(codeCollision, enableMarshalTypeMarker, "rename it", "%s collides with an existing field or method", method)
+		}
+	}
+
+	fields, err := jsonFields(c.pkg, s.Struct)
+	if err != nil {
+		return newDiagnostic(codeUnsupportedType, nil, `leave it out with a json:"-" tag`, "%v", err)
+	}
+
+	c.usesErr = false
+
+	var encode, names, cases []jen.Code
+
+	for _, field := range fields {
+		if field.quoted && !quotable(field.path[len(field.path)-1].Type()) {
+			return newDiagnostic(codeInvalidTag, nil, "remove the string option",
+				"field %s: the string option is only supported on numeric and bool fields", field.path[len(field.path)-1].Name())
+		}
+
+		path := field.path
+		selector := func(path []*types.Var) func() *jen.Statement {
+			return func() *jen.Statement {
+				value := jen.Id("o")
+				for _, step := range path {
+					value = value.Dot(step.Name())
+				}
+
+				return value
+			}
+		}
+		value := jsonOperand{value: selector(path)}
+		t := path[len(path)-1].Type()
+
+		encodeValue, err := c.encode(value, t, field.quoted, 0)
+		if err != nil {
+			return newDiagnostic(codeUnsupportedType, nil, `leave it out with a json:"-" tag`, "field %s: %v", path[len(path)-1].Name(), err)
+		}
+
+		decodeValue, err := c.decode(value, t, field.quoted, 0)
+		if err != nil {
+			return newDiagnostic(codeUnsupportedType, nil, `leave it out with a json:"-" tag`, "field %s: %v", path[len(path)-1].Name(), err)
+		}
+
+		key, err := json.Marshal(field.name)
+		if err != nil {
+			return newDiagnostic(codeInvalidTag, nil, "", "field %s: %v", path[len(path)-1].Name(), err)
+		}
+
+		// the comma before the first field is replaced by the opening brace
+		encodeField := append([]jen.Code{appendBytes(jen.Lit("," + string(key) + ":").Op("..."))}, encodeValue...)
+
+		var conditions []jen.Code
+		var allocations []jen.Code
+
+		// fields promoted from embedded pointers are only there when they aren't nil
+		for i, step := range path[:len(path)-1] {
+			if pointer, isPointer := step.Type().(*types.Pointer); isPointer {
+				embeddedValue := selector(path[:i+1])
+
+				conditions = append(conditions, embeddedValue().Op("!=").Nil())
+				allocations = append(allocations, jen.If(embeddedValue().Op("==").Nil()).Block(
+					embeddedValue().Op("=").New(typeCode(c.pkg, pointer.Elem())),
+				))
+			}
+		}
+
+		if field.omitEmpty {
+			conditions = append(conditions, nonEmptyCheck(value.value(), t))
+		}
+
+		if len(conditions) > 0 {
+			condition := jen.Add(conditions[0])
+			for _, next := range conditions[1:] {
+				condition = condition.Op("&&").Add(next)
+			}
+
+			encode = append(encode, jen.If(condition).Block(encodeField...))
+		} else {
+			encode = append(encode, encodeField...)
+		}
+
+		names = append(names, jen.Lit(field.name))
+		cases = append(cases, jen.Case(jen.Lit(field.name)).Block(append(allocations, decodeValue...)...))
+	}
+
+	body := []jen.Code{jen.Id("start").Op(":=").Len(jen.Id("b"))}
+	if c.usesErr {
+		body = append([]jen.Code{jen.Var().Err().Error()}, body...)
+	}
+	body = append(body, encode...)
+	body = append(body,
+		jen.If(jen.Len(jen.Id("b")).Op("==").Id("start")).Block(
+			appendBytes(jen.LitRune('{')),
+		).Else().Block(
+			jen.Id("b").Index(jen.Id("start")).Op("=").LitRune('{'),
+		),
+		jen.Return(jen.Append(jen.Id("b"), jen.LitRune('}')), jen.Nil()),
+	)
+
+	code.Commentf("%s implements json.Marshaler.", marshalJSONMethod)
+	code.Func().
+		Params(jen.Id("o").Id(s.Info.Name)).
+		Id(marshalJSONMethod).
+		Params().
+		Params(jen.Index().Byte(), jen.Error()).
+		Block(jen.Return(jen.Id("o").Dot(appendJSONMethod).Call(jen.Nil())))
+
+	code.Commentf("%s appends the JSON encoding of o to b.", appendJSONMethod)
+	code.Func().
+		Params(jen.Id("o").Id(s.Info.Name)).
+		Id(appendJSONMethod).
+		Params(jen.Id("b").Index().Byte()).
+		Params(jen.Index().Byte(), jen.Error()).
+		Block(body...)
+
+	code.Commentf("%s implements json.Unmarshaler.", unmarshalJSONMethod)
+	code.Func().
+		Params(jen.Id("o").Op("*").Id(s.Info.Name)).
+		Id(unmarshalJSONMethod).
+		Params(jen.Id("data").Index().Byte()).
+		Params(jen.Error()).
+		Block(
+			jen.Id("r").Op(":=").Id("jsonReader").Values(jen.Dict{jen.Id("data"): jen.Id("data")}),
+			jen.If(jen.Err().Op(":=").Id("o").Dot(decodeJSONMethod).Call(jen.Op("&").Id("r")), jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Err()),
+			),
+			jen.Return(jen.Id("r").Dot("end").Call()),
+		)
+
+	decodeField := []jen.Code{jen.List(jen.Id("_"), jen.Err()).Op(":=").Id("r").Dot("readRaw").Call(), jen.Return(jen.Err())}
+
+	var decodeFields []jen.Code
+	if len(cases) > 0 {
+		// unknown fields are skipped
+		decodeFields = []jen.Code{
+			jen.Comment("keys are matched case insensitively (preferring exact matches), like encoding/json does"),
+			jen.Switch(jen.Id("key")).Block(
+				jen.Case(names...),
+				jen.Default().Block(
+					jen.For(jen.List(jen.Id("_"), jen.Id("name")).Op(":=").Range().Index().String().Values(names...)).Block(
+						jen.If(jen.Qual("strings", "EqualFold").Call(jen.Id("key"), jen.Id("name"))).Block(
+							jen.Id("key").Op("=").Id("name"),
+							jen.Break(),
+						),
+					),
+				),
+			),
+			jen.Switch(jen.Id("key")).Block(append(cases, jen.Default().Block(decodeField...))...),
+			jen.Return(jen.Nil()),
+		}
+	} else {
+		decodeFields = decodeField
+	}
+
+	code.Commentf("%s decodes the JSON object read by r into o (ignoring null).", decodeJSONMethod)
+	code.Func().
+		Params(jen.Id("o").Op("*").Id(s.Info.Name)).
+		Id(decodeJSONMethod).
+		Params(jen.Id("r").Op("*").Id("jsonReader")).
+		Params(jen.Error()).
+		Block(
+			jen.If(jen.Id("r").Dot("readNull").Call()).Block(jen.Return(jen.Nil())),
+			jen.Return(jen.Id("r").Dot("readObject").Call(
+				jen.Func().Params(jen.Id("key").String()).Error().Block(decodeFields...),
+			)),
+		)
+
+	return nil
+}
+
+// assignBytes returns the statement assigning the given call (appending to b) to b.
+func assignBytes(call jen.Code) jen.Code {
+	return jen.Id("b").Op("=").Add(call)
+}
+
+// appendBytes returns the statement appending the given values to b.
+func appendBytes(values ...jen.Code) jen.Code {
+	return jen.Id("b").Op("=").Append(append([]jen.Code{jen.Id("b")}, values...)...)
+}
+
+// encode returns the code appending the JSON encoding of the given value to b.
+func (c *jsonCoder) encode(value jsonOperand, t types.Type, quoted bool, depth int) ([]jen.Code, error) {
+	withErr := func(call jen.Code) []jen.Code {
+		c.usesErr = true
+
+		return []jen.Code{
+			jen.List(jen.Id("b"), jen.Err()).Op("=").Add(call),
+			jen.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Nil(), jen.Err())),
+		}
+	}
+
+	if c.isGenerated(t) {
+		return withErr(value.receiver().Dot(appendJSONMethod).Call(jen.Id("b"))), nil
+	}
+
+	if byValue, byPointer := c.implements(t, jsonMarshalerInterface); byValue || byPointer {
+		if byValue {
+			return withErr(jen.Id("appendJSONMarshaler").Call(jen.Id("b"), value.value())), nil
+		}
+
+		return withErr(jen.Id("appendJSONMarshaler").Call(jen.Id("b"), value.address())), nil
+	}
+
+	if byValue, byPointer := c.implements(t, textMarshalerInterface); byValue || byPointer {
+		if byValue {
+			return withErr(jen.Id("appendJSONTextMarshaler").Call(jen.Id("b"), value.value())), nil
+		}
+
+		return withErr(jen.Id("appendJSONTextMarshaler").Call(jen.Id("b"), value.address())), nil
+	}
+
+	appendNull := appendBytes(jen.Lit("null").Op("..."))
+
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic:
+		var encoded []jen.Code
+
+		switch info := underlying.Info(); {
+		case info&types.IsBoolean != 0:
+			encoded = []jen.Code{assignBytes(jen.Qual("strconv", "AppendBool").Call(jen.Id("b"), convertTo(value.value(), t, types.Bool)))}
+		case info&types.IsString != 0:
+			encoded = []jen.Code{assignBytes(jen.Id("appendJSONString").Call(jen.Id("b"), convertTo(value.value(), t, types.String)))}
+		case info&types.IsUnsigned != 0:
+			encoded = []jen.Code{assignBytes(jen.Qual("strconv", "AppendUint").Call(jen.Id("b"), convertTo(value.value(), t, types.Uint64), jen.Lit(10)))}
+		case info&types.IsInteger != 0:
+			encoded = []jen.Code{assignBytes(jen.Qual("strconv", "AppendInt").Call(jen.Id("b"), convertTo(value.value(), t, types.Int64), jen.Lit(10)))}
+		case info&types.IsFloat != 0:
+			encoded = withErr(jen.Id("appendJSONFloat").Call(jen.Id("b"), convertTo(value.value(), t, types.Float64), jen.Lit(floatBits(underlying))))
+		default:
+			return nil, fmt.Errorf("%s values can't be encoded", underlying)
+		}
+
+		if quoted {
+			encoded = append(append([]jen.Code{appendBytes(jen.LitRune('"'))}, encoded...), appendBytes(jen.LitRune('"')))
+		}
+
+		return encoded, nil
+
+	case *types.Pointer:
+		encoded, err := c.encode(value.elem(), underlying.Elem(), quoted, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		return []jen.Code{jen.If(value.value().Op("==").Nil()).Block(appendNull).Else().Block(encoded...)}, nil
+
+	case *types.Slice:
+		if c.isBytes(underlying) {
+			// like encoding/json, byte slices are base64 encoded
+			return []jen.Code{jen.If(value.value().Op("==").Nil()).Block(appendNull).Else().Block(
+				appendBytes(jen.LitRune('"')),
+				jen.Id("b").Op("=").Qual("encoding/base64", "StdEncoding").Dot("AppendEncode").Call(jen.Id("b"), convertTo(value.value(), t, types.Invalid)),
+				appendBytes(jen.LitRune('"')),
+			)}, nil
+		}
+
+		encoded, err := c.encodeElems(value, underlying.Elem(), depth)
+		if err != nil {
+			return nil, err
+		}
+
+		return []jen.Code{jen.If(value.value().Op("==").Nil()).Block(appendNull).Else().Block(encoded...)}, nil
+
+	case *types.Array:
+		return c.encodeElems(value, underlying.Elem(), depth)
+
+	case *types.Map:
+		if !isStringType(underlying.Key()) {
+			return nil, fmt.Errorf("only maps with string keys can be encoded")
+		}
+
+		keys, key, elem, index := loopVar("keys", depth), loopVar("k", depth), loopVar("elem", depth), loopVar("i", depth)
+
+		encoded, err := c.encode(jsonOperand{value: func() *jen.Statement { return jen.Id(elem) }}, underlying.Elem(), false, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// keys are sorted, like encoding/json does
+		return []jen.Code{jen.If(value.value().Op("==").Nil()).Block(appendNull).Else().Block(
+			jen.Id(keys).Op(":=").Make(jen.Index().String(), jen.Lit(0), jen.Len(value.value())),
+			jen.For(jen.Id(key).Op(":=").Range().Add(value.value())).Block(
+				jen.Id(keys).Op("=").Append(jen.Id(keys), convertTo(jen.Id(key), underlying.Key(), types.String)),
+			),
+			jen.Qual("sort", "Strings").Call(jen.Id(keys)),
+			appendBytes(jen.LitRune('{')),
+			jen.For(jen.List(jen.Id(index), jen.Id(key)).Op(":=").Range().Id(keys)).Block(append([]jen.Code{
+				jen.If(jen.Id(index).Op(">").Lit(0)).Block(appendBytes(jen.LitRune(','))),
+				assignBytes(jen.Id("appendJSONString").Call(jen.Id("b"), jen.Id(key))),
+				appendBytes(jen.LitRune(':')),
+				jen.Id(elem).Op(":=").Add(value.operand()).Index(convertFrom(jen.Id(key), c.pkg, underlying.Key(), types.String)),
+			}, encoded...)...),
+			appendBytes(jen.LitRune('}')),
+		)}, nil
+
+	case *types.Struct:
+		return nil, fmt.Errorf("%s values can't be encoded without reflection, unless generated in the same run", types.TypeString(t, types.RelativeTo(c.pkg.Types)))
+
+	default:
+		return nil, fmt.Errorf("%s values can't be encoded without reflection", types.TypeString(t, types.RelativeTo(c.pkg.Types)))
+	}
+}
+
+// encodeElems returns the code appending the given slice or array to b as a JSON array.
+func (c *jsonCoder) encodeElems(value jsonOperand, elemType types.Type, depth int) ([]jen.Code, error) {
+	index := loopVar("i", depth)
+
+	encoded, err := c.encode(jsonOperand{value: func() *jen.Statement { return value.operand().Index(jen.Id(index)) }}, elemType, false, depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	return []jen.Code{
+		appendBytes(jen.LitRune('[')),
+		jen.For(jen.Id(index).Op(":=").Range().Add(value.value())).Block(append([]jen.Code{
+			jen.If(jen.Id(index).Op(">").Lit(0)).Block(appendBytes(jen.LitRune(','))),
+		}, encoded...)...),
+		appendBytes(jen.LitRune(']')),
+	}, nil
+}
+
+// decode returns the code decoding the JSON value read by r into the given value.
+//
+// The code is run by a function returning an error.
+func (c *jsonCoder) decode(value jsonOperand, t types.Type, quoted bool, depth int) ([]jen.Code, error) {
+	returnErr := func(call jen.Code) []jen.Code {
+		return []jen.Code{jen.If(jen.Err().Op(":=").Add(call), jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Err()))}
+	}
+
+	if c.isGenerated(t) {
+		return returnErr(value.receiver().Dot(decodeJSONMethod).Call(jen.Id("r"))), nil
+	}
+
+	if _, byPointer := c.implements(t, jsonUnmarshalerInterface); byPointer {
+		return returnErr(jen.Id("r").Dot("readUnmarshaler").Call(value.address())), nil
+	}
+
+	if _, byPointer := c.implements(t, textUnmarshalerInterface); byPointer {
+		return returnErr(jen.Id("r").Dot("readTextUnmarshaler").Call(value.address())), nil
+	}
+
+	ifNull := func() *jen.Statement { return jen.If(jen.Id("r").Dot("readNull").Call()) }
+
+	readString := func(read string) []jen.Code {
+		return []jen.Code{
+			jen.List(jen.Id("s"), jen.Err()).Op(":=").Id("r").Dot(read).Call(),
+			jen.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Err())),
+		}
+	}
+
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic:
+		// numbers (and quoted values) are read as strings, then parsed into v
+		read := "readNumber"
+		if quoted {
+			read = "readString"
+		}
+
+		var parse jen.Code
+		var parsed *jen.Statement
+
+		switch info := underlying.Info(); {
+		case info&types.IsBoolean != 0:
+			if quoted {
+				parse = jen.Qual("strconv", "ParseBool").Call(jen.Id("s"))
+			}
+			parsed = convertFrom(jen.Id("v"), c.pkg, t, types.Bool)
+		case info&types.IsString != 0:
+			read, parsed = "readString", convertFrom(jen.Id("s"), c.pkg, t, types.String)
+		case info&types.IsUnsigned != 0:
+			parse = jen.Qual("strconv", "ParseUint").Call(jen.Id("s"), jen.Lit(10), jen.Lit(intBits(underlying)))
+			parsed = convertFrom(jen.Id("v"), c.pkg, t, types.Uint64)
+		case info&types.IsInteger != 0:
+			parse = jen.Qual("strconv", "ParseInt").Call(jen.Id("s"), jen.Lit(10), jen.Lit(intBits(underlying)))
+			parsed = convertFrom(jen.Id("v"), c.pkg, t, types.Int64)
+		case info&types.IsFloat != 0:
+			parse = jen.Qual("strconv", "ParseFloat").Call(jen.Id("s"), jen.Lit(floatBits(underlying)))
+			parsed = convertFrom(jen.Id("v"), c.pkg, t, types.Float64)
+		default:
+			return nil, fmt.Errorf("%s values can't be decoded", underlying)
+		}
+
+		var body []jen.Code
+
+		switch {
+		case parse != nil:
+			body = append(readString(read),
+				jen.List(jen.Id("v"), jen.Err()).Op(":=").Add(parse),
+				jen.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Err())),
+			)
+		case underlying.Info()&types.IsBoolean != 0:
+			body = []jen.Code{
+				jen.List(jen.Id("v"), jen.Err()).Op(":=").Id("r").Dot("readBool").Call(),
+				jen.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Err())),
+			}
+		default:
+			body = readString(read)
+		}
+
+		body = append(body, value.value().Op("=").Add(parsed))
+
+		// null is ignored, like encoding/json does
+		return []jen.Code{jen.If(jen.Op("!").Id("r").Dot("readNull").Call()).Block(body...)}, nil
+
+	case *types.Pointer:
+		decoded, err := c.decode(value.elem(), underlying.Elem(), quoted, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// existing values are decoded into, like encoding/json does
+		return []jen.Code{ifNull().Block(value.value().Op("=").Nil()).Else().Block(append([]jen.Code{
+			jen.If(value.value().Op("==").Nil()).Block(value.value().Op("=").New(typeCode(c.pkg, underlying.Elem()))),
+		}, decoded...)...)}, nil
+
+	case *types.Slice:
+		if c.isBytes(underlying) {
+			return []jen.Code{ifNull().Block(value.value().Op("=").Nil()).Else().Block(append(readString("readString"),
+				jen.List(jen.Id("decoded"), jen.Err()).Op(":=").Qual("encoding/base64", "StdEncoding").Dot("DecodeString").Call(jen.Id("s")),
+				jen.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Err())),
+				value.value().Op("=").Add(convertFrom(jen.Id("decoded"), c.pkg, t, types.Invalid)),
+			)...)}, nil
+		}
+
+		elem := loopVar("elem", depth)
+
+		decoded, err := c.decode(jsonOperand{value: func() *jen.Statement { return jen.Id(elem) }}, underlying.Elem(), false, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		elemFunc := jen.Func().Params().Error().Block(append(append([]jen.Code{
+			jen.Var().Id(elem).Add(typeCode(c.pkg, underlying.Elem())),
+		}, decoded...),
+			value.value().Op("=").Append(value.value(), jen.Id(elem)),
+			jen.Return(jen.Nil()),
+		)...)
+
+		// empty arrays are decoded as empty (but not nil) slices
+		return []jen.Code{ifNull().Block(value.value().Op("=").Nil()).Else().Block(append([]jen.Code{
+			value.value().Op("=").Add(typeCode(c.pkg, t)).Values(),
+		}, returnErr(jen.Id("r").Dot("readArray").Call(elemFunc))...)...)}, nil
+
+	case *types.Array:
+		index := loopVar("i", depth)
+
+		decoded, err := c.decode(jsonOperand{value: func() *jen.Statement { return value.operand().Index(jen.Id(index)) }}, underlying.Elem(), false, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// extra values are skipped, and missing ones are zeroed, like encoding/json does
+		elemFunc := jen.Func().Params().Error().Block(append(append([]jen.Code{
+			jen.If(jen.Id(index).Op(">=").Len(value.value())).Block(
+				jen.List(jen.Id("_"), jen.Err()).Op(":=").Id("r").Dot("readRaw").Call(),
+				jen.Return(jen.Err()),
+			),
+		}, decoded...),
+			jen.Id(index).Op("++"),
+			jen.Return(jen.Nil()),
+		)...)
+
+		zeroRest := jen.For(jen.Op(";").Id(index).Op("<").Len(value.value()).Op(";").Id(index).Op("++")).Block(
+			jen.Var().Id("zero").Add(typeCode(c.pkg, underlying.Elem())),
+			value.operand().Index(jen.Id(index)).Op("=").Id("zero"),
+		)
+
+		return []jen.Code{jen.If(jen.Op("!").Id("r").Dot("readNull").Call()).Block(append(append([]jen.Code{
+			jen.Id(index).Op(":=").Lit(0),
+		}, returnErr(jen.Id("r").Dot("readArray").Call(elemFunc))...), zeroRest)...)}, nil
+
+	case *types.Map:
+		if !isStringType(underlying.Key()) {
+			return nil, fmt.Errorf("only maps with string keys can be decoded")
+		}
+
+		elem := loopVar("elem", depth)
+
+		decoded, err := c.decode(jsonOperand{value: func() *jen.Statement { return jen.Id(elem) }}, underlying.Elem(), false, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		key := loopVar("key", depth)
+
+		keyFunc := jen.Func().Params(jen.Id(key).String()).Error().Block(append(append([]jen.Code{
+			jen.Var().Id(elem).Add(typeCode(c.pkg, underlying.Elem())),
+		}, decoded...),
+			value.operand().Index(convertFrom(jen.Id(key), c.pkg, underlying.Key(), types.String)).Op("=").Id(elem),
+			jen.Return(jen.Nil()),
+		)...)
+
+		// existing maps are decoded into, like encoding/json does
+		return []jen.Code{ifNull().Block(value.value().Op("=").Nil()).Else().Block(append([]jen.Code{
+			jen.If(value.value().Op("==").Nil()).Block(value.value().Op("=").Make(typeCode(c.pkg, t))),
+		}, returnErr(jen.Id("r").Dot("readObject").Call(keyFunc))...)...)}, nil
+
+	case *types.Struct:
+		return nil, fmt.Errorf("%s values can't be decoded without reflection, unless generated in the same run", types.TypeString(t, types.RelativeTo(c.pkg.Types)))
+
+	default:
+		return nil, fmt.Errorf("%s values can't be decoded without reflection", types.TypeString(t, types.RelativeTo(c.pkg.Types)))
+	}
+}
+
+// isGenerated checks if the given type is a struct generated in the same run.
+func (c *jsonCoder) isGenerated(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+
+	return isNamed && named.Obj().Pkg() == c.pkg.Types && c.generated[named.Obj().Name()]
+}
+
+// implements checks if the given type (or a pointer to it) implements the
+// given interface, counting enums generated in the same run as text
+// marshalers (and pointers to them as text unmarshalers).
+func (c *jsonCoder) implements(t types.Type, iface *types.Interface) (byValue, byPointer bool) {
+	if named, isNamed := t.(*types.Named); isNamed && named.Obj().Pkg() == c.pkg.Types && c.enums[named.Obj().Name()] {
+		switch iface {
+		case textMarshalerInterface:
+			return true, true
+		case textUnmarshalerInterface:
+			return false, true
+		}
+	}
+
+	if _, isInterface := t.Underlying().(*types.Interface); isInterface {
+		return false, false
+	}
+
+	return types.Implements(t, iface), types.Implements(types.NewPointer(t), iface)
+}
+
+// isBytes checks if the given slice is encoded as a base64 string, like []byte.
+func (c *jsonCoder) isBytes(slice *types.Slice) bool {
+	basic, isBasic := slice.Elem().Underlying().(*types.Basic)
+	if !isBasic || basic.Kind() != types.Uint8 {
+		return false
+	}
+
+	for _, iface := range []*types.Interface{jsonMarshalerInterface, textMarshalerInterface} {
+		if _, byPointer := c.implements(slice.Elem(), iface); byPointer {
+			return false
+		}
+	}
+
+	return true
+}
+
+// methodInterface returns an interface with a single method of the given signature.
+func methodInterface(name string, params, results []types.Type) *types.Interface {
+	tuple := func(ts []types.Type) *types.Tuple {
+		vars := make([]*types.Var, 0, len(ts))
+		for _, t := range ts {
+			vars = append(vars, types.NewParam(token.NoPos, nil, "", t))
+		}
+
+		return types.NewTuple(vars...)
+	}
+
+	signature := types.NewSignatureType(nil, nil, nil, tuple(params), tuple(results), false)
+
+	return types.NewInterfaceType([]*types.Func{types.NewFunc(token.NoPos, nil, name, signature)}, nil).Complete()
+}
+
+// nonEmptyCheck returns the condition checking that the given value isn't empty,
+// as defined by the omitempty option of encoding/json.
+func nonEmptyCheck(value *jen.Statement, t types.Type) jen.Code {
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case underlying.Info()&types.IsBoolean != 0:
+			return value
+		case underlying.Info()&types.IsString != 0:
+			return value.Op("!=").Lit("")
+		default:
+			return value.Op("!=").Lit(0)
+		}
+
+	case *types.Pointer, *types.Interface:
+		return value.Op("!=").Nil()
+
+	case *types.Slice, *types.Map, *types.Array:
+		return jen.Len(value).Op("!=").Lit(0)
+
+	default:
+		// structs are never empty
+		return jen.True()
+	}
+}
+
+// quotable checks if the string option of encoding/json can be used on fields
+// of the given type.
+func quotable(t types.Type) bool {
+	if pointer, isPointer := t.(*types.Pointer); isPointer {
+		t = pointer.Elem()
+	}
+
+	basic, isBasic := t.Underlying().(*types.Basic)
+
+	return isBasic && basic.Info()&(types.IsBoolean|types.IsNumeric) != 0 && basic.Info()&types.IsComplex == 0
+}
+
+// isStringType checks if the underlying type of the given type is string.
+func isStringType(t types.Type) bool {
+	basic, isBasic := t.Underlying().(*types.Basic)
+
+	return isBasic && basic.Info()&types.IsString != 0
+}
+
+// convertTo converts the given value (of the given type) to the given basic
+// type, unless it's already of that type (Invalid stands for the underlying type).
+func convertTo(value *jen.Statement, t types.Type, kind types.BasicKind) *jen.Statement {
+	target := t.Underlying()
+	if kind != types.Invalid {
+		target = types.Typ[kind]
+	}
+
+	if types.Identical(t, target) {
+		return value
+	}
+
+	if kind == types.Invalid {
+		return jen.Index().Byte().Call(value)
+	}
+
+	return jen.Id(types.Typ[kind].Name()).Call(value)
+}
+
+// convertFrom converts the given value of the given basic type to the given
+// type, unless it's already of that type (Invalid stands for []byte).
+func convertFrom(value *jen.Statement, pkg *loader.Package, t types.Type, kind types.BasicKind) *jen.Statement {
+	var from types.Type = byteSliceType
+	if kind != types.Invalid {
+		from = types.Typ[kind]
+	}
+
+	if types.Identical(t, from) {
+		return value
+	}
+
+	return typeCode(pkg, t).Call(value)
+}
+
+// intBits returns the bit size of the given integer type for strconv.
+func intBits(basic *types.Basic) int {
+	switch basic.Kind() {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32:
+		return 32
+	case types.Int64, types.Uint64:
+		return 64
+	default:
+		// int, uint and uintptr
+		return 0
+	}
+}
+
+// floatBits returns the bit size of the given float type for strconv.
+func floatBits(basic *types.Basic) int {
+	if basic.Kind() == types.Float32 {
+		return 32
+	}
+
+	return 64
+}
@@ -0,0 +1,544 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// jsonSupportDecls are the declarations of jsonSupportSource.
+var jsonSupportDecls = []string{
+	"appendJSONString",
+	"appendJSONFloat",
+	"appendJSONMarshaler",
+	"appendJSONTextMarshaler",
+	"jsonReader",
+}
+
+// jsonSupportSource is the code (after the package clause) used by the
+// generated MarshalJSON and UnmarshalJSON methods, written once per package.
+//
+// Strings and numbers are written like encoding/json does, and JSON is read
+// by jsonReader, as the Token method of json.Decoder relies on reflection.
+const jsonSupportSource = `
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// appendJSONString appends s to b as a JSON string, escaped like encoding/json does.
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	b = append(b, '"')
+
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+
+				continue
+			}
+
+			b = append(b, s[start:i]...)
+
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				// other control characters, and <, > and & for embedding in HTML
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+
+			i++
+			start = i
+
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case r == utf8.RuneError && size == 1:
+			// invalid UTF-8 is replaced with U+FFFD, which isn't escaped (since Go 1.22)
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+		case r == '\u2028' || r == '\u2029':
+			// line and paragraph separators aren't valid in JavaScript strings
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xf])
+		default:
+			i += size
+
+			continue
+		}
+
+		i += size
+		start = i
+	}
+
+	b = append(b, s[start:]...)
+
+	return append(b, '"')
+}
+
+// appendJSONFloat appends f to b as a JSON number, formatted like encoding/json does.
+func appendJSONFloat(b []byte, f float64, bits int) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("json: unsupported value: %s", strconv.FormatFloat(f, 'g', -1, bits))
+	}
+
+	// exponents are only used for very small and large numbers, like in ES6
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+
+	if format == 'e' {
+		// e-09 is written as e-9
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+
+	return b, nil
+}
+
+// appendJSONMarshaler appends the JSON encoding of m to b, compacted like encoding/json does.
+func appendJSONMarshaler(b []byte, m json.Marshaler) ([]byte, error) {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(b)
+	if err := json.Compact(out, data); err != nil {
+		return nil, fmt.Errorf("json: invalid output of MarshalJSON: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// appendJSONTextMarshaler appends the text encoding of m to b as a JSON string.
+func appendJSONTextMarshaler(b []byte, m encoding.TextMarshaler) ([]byte, error) {
+	text, err := m.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	return appendJSONString(b, string(text)), nil
+}
+
+// jsonReader reads JSON values from data.
+type jsonReader struct {
+	data []byte
+	pos  int
+}
+
+// errorf returns an error about the data at the current position.
+func (r *jsonReader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("json: %s at offset %d", fmt.Sprintf(format, args...), r.pos)
+}
+
+// peek skips whitespace, then returns the next byte (0 at the end of the data).
+func (r *jsonReader) peek() byte {
+	for r.pos < len(r.data) {
+		switch c := r.data[r.pos]; c {
+		case ' ', '\t', '\n', '\r':
+			r.pos++
+		default:
+			return c
+		}
+	}
+
+	return 0
+}
+
+// consume reads the given byte, after whitespace.
+func (r *jsonReader) consume(c byte) error {
+	if r.peek() != c {
+		return r.errorf("expected %q", c)
+	}
+
+	r.pos++
+
+	return nil
+}
+
+// end checks that there's nothing but whitespace after the values read.
+func (r *jsonReader) end() error {
+	if r.peek(); r.pos < len(r.data) {
+		return r.errorf("unexpected data after the value")
+	}
+
+	return nil
+}
+
+// readLiteral reads the given literal (e.g. null), if it comes next.
+func (r *jsonReader) readLiteral(literal string) bool {
+	r.peek()
+
+	if !bytes.HasPrefix(r.data[r.pos:], []byte(literal)) {
+		return false
+	}
+
+	r.pos += len(literal)
+
+	return true
+}
+
+// readNull reads null, if it comes next.
+func (r *jsonReader) readNull() bool {
+	return r.readLiteral("null")
+}
+
+// readBool reads true or false.
+func (r *jsonReader) readBool() (bool, error) {
+	switch {
+	case r.readLiteral("true"):
+		return true, nil
+	case r.readLiteral("false"):
+		return false, nil
+	default:
+		return false, r.errorf("expected a boolean")
+	}
+}
+
+// readNumber reads a number, returning it as written.
+func (r *jsonReader) readNumber() (string, error) {
+	r.peek()
+	start := r.pos
+
+	if r.pos < len(r.data) && r.data[r.pos] == '-' {
+		r.pos++
+	}
+
+	switch {
+	case r.pos < len(r.data) && r.data[r.pos] == '0':
+		r.pos++
+	case !r.skipDigits():
+		r.pos = start
+
+		return "", r.errorf("expected a number")
+	}
+
+	if r.pos < len(r.data) && r.data[r.pos] == '.' {
+		r.pos++
+
+		if !r.skipDigits() {
+			return "", r.errorf("expected a digit")
+		}
+	}
+
+	if r.pos < len(r.data) && (r.data[r.pos] == 'e' || r.data[r.pos] == 'E') {
+		r.pos++
+
+		if r.pos < len(r.data) && (r.data[r.pos] == '+' || r.data[r.pos] == '-') {
+			r.pos++
+		}
+
+		if !r.skipDigits() {
+			return "", r.errorf("expected a digit")
+		}
+	}
+
+	return string(r.data[start:r.pos]), nil
+}
+
+// skipDigits skips decimal digits, reporting if there were any.
+func (r *jsonReader) skipDigits() bool {
+	start := r.pos
+
+	for r.pos < len(r.data) && r.data[r.pos] >= '0' && r.data[r.pos] <= '9' {
+		r.pos++
+	}
+
+	return r.pos > start
+}
+
+// readString reads a string, replacing invalid UTF-8 like encoding/json does.
+func (r *jsonReader) readString() (string, error) {
+	if err := r.consume('"'); err != nil {
+		return "", err
+	}
+
+	// strings without escapes (the most common ones) are simply copied
+	start := r.pos
+	for r.pos < len(r.data) {
+		c := r.data[r.pos]
+		if c == '"' {
+			r.pos++
+
+			return string(r.data[start : r.pos-1]), nil
+		}
+
+		if c == '\\' || c < 0x20 || c >= utf8.RuneSelf {
+			break
+		}
+
+		r.pos++
+	}
+
+	s := append([]byte(nil), r.data[start:r.pos]...)
+
+	for r.pos < len(r.data) {
+		switch c := r.data[r.pos]; {
+		case c == '"':
+			r.pos++
+
+			return string(s), nil
+
+		case c < 0x20:
+			return "", r.errorf("invalid character %q in string", c)
+
+		case c == '\\':
+			r.pos++
+			if r.pos == len(r.data) {
+				return "", r.errorf("unexpected end of string")
+			}
+
+			switch e := r.data[r.pos]; e {
+			case '"', '\\', '/':
+				s = append(s, e)
+			case 'b':
+				s = append(s, '\b')
+			case 'f':
+				s = append(s, '\f')
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'u':
+				char, ok := r.readHex()
+				if !ok {
+					return "", r.errorf("invalid \\u escape in string")
+				}
+
+				if utf16.IsSurrogate(char) {
+					// surrogate pairs are escaped separately
+					pair := unicode.ReplacementChar
+
+					if next := r.pos; bytes.HasPrefix(r.data[r.pos+1:], []byte("\\u")) {
+						r.pos += 2
+
+						if low, ok := r.readHex(); ok {
+							pair = utf16.DecodeRune(char, low)
+						}
+
+						if pair == unicode.ReplacementChar {
+							r.pos = next
+						}
+					}
+
+					char = pair
+				}
+
+				s = utf8.AppendRune(s, char)
+			default:
+				return "", r.errorf("invalid escape %q in string", e)
+			}
+
+			r.pos++
+
+		case c < utf8.RuneSelf:
+			s = append(s, c)
+			r.pos++
+
+		default:
+			char, size := utf8.DecodeRune(r.data[r.pos:])
+			if char == utf8.RuneError && size == 1 {
+				s = utf8.AppendRune(s, utf8.RuneError)
+			} else {
+				s = append(s, r.data[r.pos:r.pos+size]...)
+			}
+
+			r.pos += size
+		}
+	}
+
+	return "", r.errorf("unexpected end of string")
+}
+
+// readHex reads the 4 hexadecimal digits of the \u escape at the current
+// position, leaving it at the last digit.
+func (r *jsonReader) readHex() (rune, bool) {
+	if len(r.data)-r.pos < 5 {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(string(r.data[r.pos+1:r.pos+5]), 16, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	r.pos += 4
+
+	return rune(n), true
+}
+
+// readObject reads an object, calling field for each key, with the value to be
+// read next.
+func (r *jsonReader) readObject(field func(key string) error) error {
+	if err := r.consume('{'); err != nil {
+		return err
+	}
+
+	if r.peek() == '}' {
+		r.pos++
+
+		return nil
+	}
+
+	for {
+		key, err := r.readString()
+		if err != nil {
+			return err
+		}
+
+		if err := r.consume(':'); err != nil {
+			return err
+		}
+
+		if err := field(key); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		switch r.peek() {
+		case ',':
+			r.pos++
+		case '}':
+			r.pos++
+
+			return nil
+		default:
+			return r.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+// readArray reads an array, calling elem for each value to be read next.
+func (r *jsonReader) readArray(elem func() error) error {
+	if err := r.consume('['); err != nil {
+		return err
+	}
+
+	if r.peek() == ']' {
+		r.pos++
+
+		return nil
+	}
+
+	for i := 0; ; i++ {
+		if err := elem(); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+
+		switch r.peek() {
+		case ',':
+			r.pos++
+		case ']':
+			r.pos++
+
+			return nil
+		default:
+			return r.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+// readRaw reads a value of any kind, returning it as written.
+func (r *jsonReader) readRaw() ([]byte, error) {
+	var err error
+
+	c := r.peek()
+	start := r.pos
+
+	switch c {
+	case '{':
+		err = r.readObject(func(string) error {
+			_, err := r.readRaw()
+
+			return err
+		})
+	case '[':
+		err = r.readArray(func() error {
+			_, err := r.readRaw()
+
+			return err
+		})
+	case '"':
+		_, err = r.readString()
+	case 't', 'f':
+		_, err = r.readBool()
+	case 'n':
+		if !r.readNull() {
+			err = r.errorf("expected null")
+		}
+	default:
+		_, err = r.readNumber()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.data[start:r.pos], nil
+}
+
+// readUnmarshaler reads a value of any kind, and decodes it using u.
+func (r *jsonReader) readUnmarshaler(u json.Unmarshaler) error {
+	raw, err := r.readRaw()
+	if err != nil {
+		return err
+	}
+
+	return u.UnmarshalJSON(raw)
+}
+
+// readTextUnmarshaler reads a string (or null, which is ignored), and decodes it using u.
+func (r *jsonReader) readTextUnmarshaler(u encoding.TextUnmarshaler) error {
+	if r.readNull() {
+		return nil
+	}
+
+	s, err := r.readString()
+	if err != nil {
+		return err
+	}
+
+	return u.UnmarshalText([]byte(s))
+}
+`
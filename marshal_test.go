@@ -0,0 +1,231 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestMarshalLikeEncodingJSON(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package marshaled
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Embedded struct {
+	ID    string ` + "`json:\"id\"`" + `
+	Count int
+}
+
+// +marshal:generate=true
+type Value struct {
+	Embedded
+	String   string            ` + "`json:\"string\"`" + `
+	Empty    string            ` + "`json:\"empty,omitempty\"`" + `
+	Int      int               ` + "`json:\"int\"`" + `
+	Int8     int8
+	Uint64   uint64
+	Float32  float32
+	Float64  float64
+	Quoted   int               ` + "`json:\"quoted,string\"`" + `
+	Bool     bool              ` + "`json:\"bool,omitempty\"`" + `
+	Pointer  *int              ` + "`json:\"pointer\"`" + `
+	Bytes    []byte
+	Strings  []string          ` + "`json:\",omitempty\"`" + `
+	Array    [2]int
+	Map      map[string]float64
+	Nested   *Value            ` + "`json:\"nested,omitempty\"`" + `
+	Time     time.Time
+	Duration time.Duration
+	Raw      json.RawMessage   ` + "`json:\"raw,omitempty\"`" + `
+	Skipped  int               ` + "`json:\"-\"`" + `
+	internal int
+}
+`,
+		"types_test.go": `package marshaled
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// reference has the fields of Value, without the generated methods.
+type reference Value
+
+func referenceJSON(t *testing.T, v Value) string {
+	t.Helper()
+
+	data, err := json.Marshal(reference(v))
+	if err != nil {
+		t.Fatalf("json.Marshal(%+v) failed: %v", v, err)
+	}
+
+	return string(data)
+}
+
+func TestMarshal(t *testing.T) {
+	one := 1
+
+	for _, v := range []Value{
+		{},
+		{Embedded: Embedded{ID: "id", Count: 2}, String: "plain", Empty: "set", Int: -1, Int8: math.MinInt8, Uint64: math.MaxUint64, Quoted: 42, Bool: true, Pointer: &one},
+		{String: "quotes \" and \\ backslashes, <html> & entities"},
+		{String: "control \x00\x01\x1f\b\f\n\r\t characters"},
+		{String: "separators \u2028 and \u2029, emoji 😀, replacement \ufffd"},
+		{String: "invalid \xff\xfe UTF-8 \xed\xa0\x80 and a truncated \xe2\x82"},
+		{Float32: math.MaxFloat32, Float64: math.SmallestNonzeroFloat64},
+		{Float32: 1e-7, Float64: 1e21},
+		{Float32: 0.1, Float64: -123456789.125},
+		{Float64: math.Copysign(0, -1)},
+		{Bytes: []byte{}, Strings: []string{}, Map: map[string]float64{}},
+		{Bytes: []byte("bytes\x00\xff"), Strings: []string{"a", "", "c"}, Array: [2]int{1, 2}, Map: map[string]float64{"b": 2, "a": 1, "<&>": 0.5}},
+		{Nested: &Value{String: "nested", Nested: &Value{}}},
+		{Time: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC), Duration: time.Second},
+		{Raw: json.RawMessage(" { \"a\" : [ 1 , 2 ] } ")},
+		{Skipped: 1, internal: 2},
+	} {
+		data, err := v.MarshalJSON()
+		if err != nil {
+			t.Errorf("MarshalJSON() of %+v failed: %v", v, err)
+
+			continue
+		}
+
+		if want := referenceJSON(t, v); string(data) != want {
+			t.Errorf("MarshalJSON() of %+v = %s, want %s", v, data, want)
+		}
+	}
+}
+
+func TestMarshalUnsupportedValues(t *testing.T) {
+	for _, v := range []Value{
+		{Float64: math.NaN()},
+		{Float32: float32(math.Inf(1))},
+		{Raw: json.RawMessage("{")},
+	} {
+		if data, err := v.MarshalJSON(); err == nil {
+			t.Errorf("MarshalJSON() of %+v = %s, want an error", v, data)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	for _, data := range []string{
+		// valid inputs
+		"{}",
+		"null",
+		" { \"string\" : \"a\" } ",
+		"{\"id\":\"id\",\"Count\":2,\"string\":\"s\",\"int\":-1,\"Int8\":127,\"Uint64\":18446744073709551615}",
+		"{\"STRING\":\"case insensitive\",\"count\":3}",
+		"{\"string\":\"escapes \\\" \\\\ \\/ \\b \\f \\n \\r \\t \\u00e9 \\ud83d\\ude00\"}",
+		"{\"string\":\"lone surrogates \\ud800 \\udc00 and \\ud800\\u0041\"}",
+		"{\"string\":\"invalid \xff UTF-8\"}",
+		"{\"Float32\":1e-7,\"Float64\":-1.5E+300}",
+		"{\"quoted\":\"42\",\"bool\":true,\"pointer\":1}",
+		"{\"pointer\":null,\"Bytes\":null,\"Strings\":null,\"Map\":null,\"nested\":null}",
+		"{\"Bytes\":\"Ynl0ZXM=\",\"Strings\":[\"a\",\"b\"],\"Array\":[1],\"Map\":{\"a\":1,\"b\":2.5}}",
+		"{\"Array\":[1,2,3]}",
+		"{\"nested\":{\"string\":\"nested\",\"nested\":{}}}",
+		"{\"Time\":\"2020-01-02T03:04:05.000000006Z\",\"Duration\":1000000000}",
+		"{\"raw\":[1, {\"a\": null}]}",
+		"{\"unknown\":{\"a\":[1,2,{\"b\":null}]},\"Skipped\":1,\"internal\":2,\"-\":3}",
+		"{\"string\":\"first\",\"string\":\"last\"}",
+
+		// malformed inputs
+		"",
+		"{",
+		"{\"string\"}",
+		"{\"string\":}",
+		"{\"string\":\"a\",}",
+		"{\"string\":\"a\"} {}",
+		"{\"string\":\"unterminated}",
+		"{\"string\":\"bad escape \\x\"}",
+		"{\"string\":\"bad unicode \\u12\"}",
+		"{\"string\":\"control \x01 character\"}",
+		"{\"int\":1.5}",
+		"{\"int\":01}",
+		"{\"int\":-}",
+		"{\"Int8\":128}",
+		"{\"Uint64\":-1}",
+		"{\"Float32\":1e39}",
+		"{\"quoted\":42}",
+		"{\"bool\":\"true\"}",
+		"{\"Bytes\":\"not base64!\"}",
+		"{\"Strings\":[\"a\",]}",
+		"{\"Map\":{\"a\":1,}}",
+		"{\"Map\":{1:1}}",
+		"{\"Time\":\"yesterday\"}",
+		"{\"unknown\":[1,}",
+		"[]",
+		"\"string\"",
+		"nul",
+		"tru",
+	} {
+		var got Value
+		gotErr := got.UnmarshalJSON([]byte(data))
+
+		var want reference
+		wantErr := json.Unmarshal([]byte(data), &want)
+
+		switch {
+		case gotErr != nil && wantErr == nil:
+			t.Errorf("UnmarshalJSON(%q) failed: %v, want %+v", data, gotErr, want)
+		case gotErr == nil && wantErr != nil:
+			t.Errorf("UnmarshalJSON(%q) = %+v, want an error like %v", data, got, wantErr)
+		case gotErr == nil && !reflect.DeepEqual(got, Value(want)):
+			t.Errorf("UnmarshalJSON(%q) = %+v, want %+v", data, got, want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	one := 1
+	v := Value{
+		Embedded: Embedded{ID: "id", Count: 2},
+		String:   "invalid \xff and \ufffd",
+		Pointer:  &one,
+		Bytes:    []byte("bytes"),
+		Map:      map[string]float64{"a": 0.1},
+		Nested:   &Value{Strings: []string{"nested"}},
+		Time:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	data, err := v.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON() failed: %v", err)
+	}
+
+	var got Value
+	if err := got.UnmarshalJSON(data); err != nil {
+		t.Fatalf("UnmarshalJSON(%s) failed: %v", data, err)
+	}
+
+	var want reference
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, Value(want)) {
+		t.Errorf("UnmarshalJSON(%s) = %+v, want %+v", data, got, want)
+	}
+}
+`,
+	}, "marshal").succeeded(t).test(t)
+}
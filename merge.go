@@ -0,0 +1,270 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// mergeMethod is the name of the generated method.
+const mergeMethod = "Merge"
+
+var (
+	enableMergeTypeMarker = markers.Must(markers.MakeDefinition("merge:generate", markers.DescribesType, false))
+
+	alwaysMergeFieldMarker = markers.Must(markers.MakeDefinition("merge:always", markers.DescribesField, struct{}{}))
+	derefMergeFieldMarker  = markers.Must(markers.MakeDefinition("merge:deref", markers.DescribesField, struct{}{}))
+)
+
+func init() {
+	registerGenerator("merge", MergeGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// MergeGenerator generates code containing Merge method implementations,
+// overlaying the non-zero fields of another value onto the receiver.
+//
+// Pointers, slices and maps are zero when they're nil, and fields of types
+// having a Merge method themselves (or generated in the same run) are merged
+// using it.
+type MergeGenerator struct{}
+
+func (MergeGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableMergeTypeMarker, alwaysMergeFieldMarker, derefMergeFieldMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableMergeTypeMarker,
+		markers.SimpleHelp("object", "enables or disables Merge implementation generation for this type"),
+	)
+	into.AddHelp(
+		alwaysMergeFieldMarker,
+		markers.SimpleHelp("object", "always overrides this field with the one of other, even when it's zero (e.g. for meaningful false values)"),
+	)
+	into.AddHelp(
+		derefMergeFieldMarker,
+		markers.SimpleHelp("object", "only overrides this pointer field when the one of other points to a non-zero value"),
+	)
+
+	return nil
+}
+
+func (MergeGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableMergeTypeMarker, "zz_generated.merge.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		generated := make(map[string]bool, len(structs))
+		for _, s := range structs {
+			generated[s.Info.Name] = true
+		}
+
+		for _, s := range structs {
+			if err := generateMerge(code, root, generated, s); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+	})
+}
+
+// generateMerge generates the Merge method of the given struct. The returned
+// errors are diagnostics.
+func generateMerge(code *jen.File, pkg *loader.Package, generated map[string]bool, s markedStruct) error {
+	if _, ind, _ := types.LookupFieldOrMethod(s.Type, true, pkg.Types, mergeMethod); len(ind) == 1 {
+		return newDiagnostic(codeCollision, enableMergeTypeMarker, "rename it", "%s collides with an existing field or method", mergeMethod)
+	}
+
+	var body []jen.Code
+
+	for i := 0; i < s.Struct.NumFields(); i++ {
+		field := s.Struct.Field(i)
+
+		if field.Name() == "_" {
+			continue
+		}
+
+		ours := func() *jen.Statement { return jen.Id("o").Dot(field.Name()) }
+		theirs := func() *jen.Statement { return jen.Id("other").Dot(field.Name()) }
+
+		var fieldMarkers markers.MarkerValues
+		if i < len(s.Info.Fields) {
+			fieldMarkers = s.Info.Fields[i].Markers
+		}
+
+		always := fieldMarkers.Get(alwaysMergeFieldMarker.Name) != nil
+		deref := fieldMarkers.Get(derefMergeFieldMarker.Name) != nil
+
+		switch {
+		case always && deref:
+			return newDiagnostic(codeInvalidMarker, derefMergeFieldMarker, "remove one of the markers",
+				"field %s can't be marked with both %s and %s", field.Name(), alwaysMergeFieldMarker.Name, derefMergeFieldMarker.Name)
+
+		case always:
+			body = append(body, ours().Op("=").Add(theirs()))
+
+		case deref:
+			pointer, isPointer := field.Type().Underlying().(*types.Pointer)
+			if !isPointer {
+				return newDiagnostic(codeUnsupportedOption, derefMergeFieldMarker, "remove the marker",
+					"field %s is marked with %s, but it isn't a pointer", field.Name(), derefMergeFieldMarker.Name)
+			}
+
+			elemSet := zeroCheck(pkg, jen.Op("*").Add(theirs()), pointer.Elem(), false)
+
+			body = append(body, jen.If(theirs().Op("!=").Nil().Op("&&").Add(elemSet)).Block(ours().Op("=").Add(theirs())))
+
+		case hasMerge(pkg, generated, field.Type()):
+			body = append(body, ours().Op("=").Add(ours()).Dot(mergeMethod).Call(theirs()))
+
+		default:
+			body = append(body, jen.If(zeroCheck(pkg, theirs(), field.Type(), false)).Block(ours().Op("=").Add(theirs())))
+		}
+	}
+
+	code.Commentf("%s returns o with the non-zero fields of other overlaid onto it.", mergeMethod)
+	code.Func().
+		Params(jen.Id("o").Id(s.Info.Name)).
+		Id(mergeMethod).
+		Params(jen.Id("other").Id(s.Info.Name)).
+		Params(jen.Id(s.Info.Name)).
+		Block(append(body, jen.Return(jen.Id("o")))...)
+
+	return nil
+}
+
+// hasMerge checks if the given type has (or will have) a Merge(T) T method.
+func hasMerge(pkg *loader.Package, generated map[string]bool, t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed {
+		return false
+	}
+
+	if named.Obj().Pkg() == pkg.Types && generated[named.Obj().Name()] {
+		return true
+	}
+
+	method, ind, _ := types.LookupFieldOrMethod(named, true /* check pointers too */, named.Obj().Pkg(), mergeMethod)
+	if len(ind) != 1 {
+		// ignore embedded methods, they only merge the embedded value
+		return false
+	}
+
+	methodFunc, isFunc := method.(*types.Func)
+	if !isFunc {
+		return false
+	}
+
+	methodSig := methodFunc.Type().(*types.Signature)
+	if methodSig.Params().Len() != 1 || methodSig.Results().Len() != 1 {
+		return false
+	}
+
+	return types.Identical(methodSig.Params().At(0).Type(), named) &&
+		types.Identical(methodSig.Results().At(0).Type(), named)
+}
+
+// zeroCheck returns the condition checking that the given value (of the given
+// type) is zero, or isn't zero if zero is false.
+func zeroCheck(pkg *loader.Package, value *jen.Statement, t types.Type, zero bool) jen.Code {
+	op, not := "!=", jen.Op("!")
+	if zero {
+		op, not = "==", jen.Null()
+	}
+
+	if hasIsZeroMethod(t) {
+		return jen.Add(not).Add(value).Dot("IsZero").Call()
+	}
+
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case underlying.Info()&types.IsBoolean != 0:
+			if zero {
+				return jen.Op("!").Add(value)
+			}
+
+			return value
+		case underlying.Info()&types.IsString != 0:
+			return value.Op(op).Lit("")
+		case underlying.Kind() == types.UnsafePointer:
+			return value.Op(op).Nil()
+		default:
+			return value.Op(op).Lit(0)
+		}
+
+	case *types.Pointer, *types.Slice, *types.Map, *types.Chan, *types.Signature, *types.Interface:
+		return value.Op(op).Nil()
+
+	default:
+		if comparesSafely(t) {
+			return value.Op(op).Parens(typeCode(pkg, t).Values())
+		}
+
+		return jen.Add(not).Qual("reflect", "ValueOf").Call(value).Dot("IsZero").Call()
+	}
+}
+
+// hasIsZeroMethod checks if the given type has an IsZero() bool method (like time.Time).
+func hasIsZeroMethod(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed {
+		return false
+	}
+
+	method, ind, _ := types.LookupFieldOrMethod(named, true /* check pointers too */, named.Obj().Pkg(), "IsZero")
+	if len(ind) != 1 {
+		// ignore embedded methods, they only check the embedded value
+		return false
+	}
+
+	methodFunc, isFunc := method.(*types.Func)
+	if !isFunc {
+		return false
+	}
+
+	methodSig := methodFunc.Type().(*types.Signature)
+
+	return methodSig.Params().Len() == 0 && methodSig.Results().Len() == 1 &&
+		types.Identical(methodSig.Results().At(0).Type(), types.Typ[types.Bool])
+}
+
+// comparesSafely checks if values of the given type can be compared using ==
+// without panicking, which isn't the case for interfaces holding values of
+// incomparable types.
+func comparesSafely(t types.Type) bool {
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic, *types.Pointer, *types.Chan:
+		return true
+
+	case *types.Array:
+		return comparesSafely(underlying.Elem())
+
+	case *types.Struct:
+		for i := 0; i < underlying.NumFields(); i++ {
+			if !comparesSafely(underlying.Field(i).Type()) {
+				return false
+			}
+		}
+
+		return true
+
+	default:
+		return false
+	}
+}
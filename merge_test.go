@@ -0,0 +1,128 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestMerge(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package merged
+
+import "time"
+
+// +merge:generate=true
+type Settings struct {
+	Host  string
+	Port  int
+	Debug bool
+	// +merge:always
+	TLS     bool
+	Timeout time.Duration
+	Started time.Time
+	Limits  Limits
+	Retry   Retry
+	Tags    []string
+	// +merge:deref
+	Replicas *int
+	Backup   *Limits
+	Labels   map[string]string
+}
+
+// +merge:generate=true
+type Limits struct {
+	CPU    string
+	Memory string
+}
+
+type Retry struct {
+	Attempts int
+	Codes    []int
+}
+`,
+		"types_test.go": `package merged
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	three, zero := 3, 0
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	base := Settings{
+		Host:     "localhost",
+		Port:     8080,
+		Debug:    true,
+		TLS:      true,
+		Timeout:  time.Second,
+		Limits:   Limits{CPU: "1", Memory: "1Gi"},
+		Retry:    Retry{Attempts: 1},
+		Tags:     []string{"a"},
+		Replicas: &three,
+		Labels:   map[string]string{"a": "b"},
+	}
+
+	// zero fields don't override anything, except for the ones merged always
+	merged := base.Merge(Settings{})
+	want := base
+	want.TLS = false
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("Merge() of the zero value = %+v, want %+v", merged, want)
+	}
+
+	backup := &Limits{CPU: "2"}
+	merged = base.Merge(Settings{
+		Port:     9090,
+		TLS:      true,
+		Started:  started,
+		Limits:   Limits{Memory: "2Gi"},
+		Retry:    Retry{Codes: []int{500}},
+		Tags:     []string{},
+		Replicas: &zero,
+		Backup:   backup,
+	})
+	want = Settings{
+		Host:     "localhost",
+		Port:     9090,
+		Debug:    true,
+		TLS:      true,
+		Timeout:  time.Second,
+		Started:  started,
+		Limits:   Limits{CPU: "1", Memory: "2Gi"},
+		Retry:    Retry{Codes: []int{500}},
+		Tags:     []string{},
+		Replicas: &three,
+		Backup:   backup,
+		Labels:   map[string]string{"a": "b"},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("Merge() = %+v, want %+v", merged, want)
+	}
+
+	// a non-nil pointer to a zero value only overrides fields merged by their pointer
+	if merged.Replicas != base.Replicas || *base.Replicas != 3 {
+		t.Errorf("Merge() overrode the dereferenced Replicas with a pointer to zero")
+	}
+	if merged.Backup != backup {
+		t.Errorf("Merge() didn't take the Backup pointer of the other value")
+	}
+}
+`,
+	}, "merge").succeeded(t).test(t)
+}
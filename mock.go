@@ -0,0 +1,360 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+var (
+	enableMockTypeMarker = markers.Must(markers.MakeDefinition("mock:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("mock", MockGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// MockGenerator generates fake implementations of interfaces for tests, named
+// <Interface>Mock, recording the calls of their methods.
+//
+// Each <Method> of the mock calls its <Method>Func field if it's set, and
+// returns the values set by Set<Method>Returns otherwise (zero values by
+// default). The recorded calls are returned by <Method>Calls, with the
+// arguments of each call in a <Interface>Mock<Method>Call struct.
+type MockGenerator struct{}
+
+func (MockGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableMockTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableMockTypeMarker,
+		markers.SimpleHelp("object", "enables or disables mock generation for this interface"),
+	)
+
+	return nil
+}
+
+func (MockGenerator) Generate(ctx *genall.GenerationContext) error {
+	for _, root := range ctx.Roots {
+		infos, err := markedTypes(ctx, root, enableMockTypeMarker)
+		if err != nil {
+			root.AddError(err)
+			return nil
+		}
+
+		if len(infos) == 0 {
+			continue
+		}
+
+		code := jen.NewFile(root.Name)
+
+		for _, info := range infos {
+			typeInfo := root.TypesInfo.TypeOf(info.RawSpec.Name)
+			if typeInfo == types.Typ[types.Invalid] {
+				report(root, info.RawSpec, newDiagnostic(codeUnknownType, nil, "fix the type errors of the package first", "unknown type %s", info.Name))
+
+				continue
+			}
+
+			if err := generateMock(code, root, info.Name, typeInfo); err != nil {
+				reportOnType(root, info, err)
+			}
+		}
+
+		renderOut(ctx, root, code, "zz_generated.mock.go", "")
+	}
+
+	return nil
+}
+
+// mockMethod is a method of a mocked interface, with the names of what's generated for it.
+type mockMethod struct {
+	*types.Func
+	Signature *types.Signature
+	// CallType is the struct recording the arguments of a call.
+	CallType string
+	// CallFields are the fields of CallType, for each parameter.
+	CallFields []string
+	// FuncField is the field overriding the implementation of the method.
+	FuncField string
+	// CallsMethod returns the recorded calls.
+	CallsMethod string
+	// ReturnsMethod sets the values returned by default (if there are results).
+	ReturnsMethod string
+	// calls and returns are the unexported fields storing the recorded calls and the values returned by default.
+	calls, returns string
+}
+
+// generateMock generates the mock implementation of the given interface type.
+// The returned errors are diagnostics.
+func generateMock(code *jen.File, pkg *loader.Package, name string, t types.Type) error {
+	if named, isNamed := t.(*types.Named); isNamed && named.TypeParams().Len() > 0 {
+		return newDiagnostic(codeUnsupportedType, enableMockTypeMarker, "remove the marker", "generic interfaces can't be mocked")
+	}
+
+	iface, isIface := t.Underlying().(*types.Interface)
+	if !isIface {
+		return newDiagnostic(codeUnsupportedType, enableMockTypeMarker, "remove the marker", "only interfaces can be mocked")
+	}
+
+	if !iface.IsMethodSet() {
+		return newDiagnostic(codeUnsupportedType, enableMockTypeMarker, "remove the marker", "constraint interfaces can't be mocked")
+	}
+
+	mockName := name + "Mock"
+
+	// the mock has to be declared in the package, as well as the members of it
+	declared := map[string]string{mockName: "type"}
+	members := map[string]string{"mu": "field"}
+
+	declare := func(names map[string]string, name, kind string) error {
+		if other, exists := names[name]; exists {
+			return newDiagnostic(codeCollision, enableMockTypeMarker, "rename the method", "the %s %s of %s collides with a generated %s", kind, name, mockName, other)
+		}
+		names[name] = kind
+
+		return nil
+	}
+
+	methods := make([]mockMethod, 0, iface.NumMethods())
+
+	for i := 0; i < iface.NumMethods(); i++ {
+		method := iface.Method(i)
+
+		if !method.Exported() && method.Pkg() != pkg.Types {
+			return newDiagnostic(codeUnsupportedType, enableMockTypeMarker, "remove the marker",
+				"unexported method %s of package %s can't be implemented", method.Name(), method.Pkg().Path())
+		}
+
+		sig := method.Type().(*types.Signature)
+		title := strings.ToUpper(method.Name()[:1]) + method.Name()[1:]
+
+		m := mockMethod{
+			Func:        method,
+			Signature:   sig,
+			CallType:    mockName + title + "Call",
+			FuncField:   method.Name() + "Func",
+			CallsMethod: method.Name() + "Calls",
+			calls:       "calls" + title,
+			returns:     "returns" + title,
+		}
+
+		// the arguments are recorded by the names of the parameters (if they have one)
+		callFields := make(map[string]bool, sig.Params().Len())
+		for i := 0; i < sig.Params().Len(); i++ {
+			field := sig.Params().At(i).Name()
+			if field != "" {
+				field = strings.ToUpper(field[:1]) + field[1:]
+			}
+			if field == "" || field == "_" || callFields[field] {
+				field = "Arg" + strconv.Itoa(i)
+			}
+			callFields[field] = true
+
+			m.CallFields = append(m.CallFields, field)
+		}
+
+		if err := declare(members, method.Name(), "method"); err != nil {
+			return err
+		}
+		if err := declare(members, m.FuncField, "field"); err != nil {
+			return err
+		}
+		if err := declare(members, m.CallsMethod, "method"); err != nil {
+			return err
+		}
+		if err := declare(members, m.calls, "field"); err != nil {
+			return err
+		}
+		if sig.Results().Len() > 0 {
+			m.ReturnsMethod = "Set" + title + "Returns"
+
+			if err := declare(members, m.ReturnsMethod, "method"); err != nil {
+				return err
+			}
+			if err := declare(members, m.returns, "field"); err != nil {
+				return err
+			}
+		}
+		if err := declare(declared, m.CallType, "type"); err != nil {
+			return err
+		}
+
+		methods = append(methods, m)
+	}
+
+	for declaration := range declared {
+		if pkg.Types.Scope().Lookup(declaration) != nil {
+			return newDiagnostic(codeCollision, enableMockTypeMarker, "rename it", "%s collides with an existing declaration in package %s", declaration, pkg.PkgPath)
+		}
+	}
+
+	fields := make([]jen.Code, 0, len(methods)*3+1)
+	for _, m := range methods {
+		fields = append(fields, jen.Commentf("%s implements %s if set.", m.FuncField, m.Name()))
+		fields = append(fields, jen.Id(m.FuncField).Func().Add(signatureCode(pkg, m.Signature)))
+	}
+	fields = append(fields, jen.Line(), jen.Id("mu").Qual("sync", "Mutex"))
+	for _, m := range methods {
+		fields = append(fields, jen.Id(m.calls).Index().Id(m.CallType))
+		if m.ReturnsMethod != "" {
+			fields = append(fields, jen.Id(m.returns).Struct(mockResults(pkg, m.Signature)...))
+		}
+	}
+
+	code.Commentf("%s is a fake implementation of %s for tests, recording the calls of its methods.", mockName, name)
+	code.Comment("")
+	code.Comment("Each method calls its <Method>Func field if it's set, and returns the values")
+	code.Comment("set by Set<Method>Returns otherwise (zero values by default).")
+	code.Type().Id(mockName).Struct(fields...)
+
+	code.Var().Id("_").Id(name).Op("=").Parens(jen.Op("*").Id(mockName)).Parens(jen.Nil())
+
+	for _, m := range methods {
+		generateMockMethod(code, pkg, mockName, m)
+	}
+
+	return nil
+}
+
+// generateMockMethod generates the method implementing the given one, and the
+// methods (and call type) configuring and inspecting it.
+func generateMockMethod(code *jen.File, pkg *loader.Package, mockName string, m mockMethod) {
+	sig := m.Signature
+
+	callFields := make([]jen.Code, 0, sig.Params().Len())
+	params := make([]jen.Code, 0, sig.Params().Len())
+	args := make([]jen.Code, 0, sig.Params().Len())
+	recorded := jen.Dict{}
+
+	for i := 0; i < sig.Params().Len(); i++ {
+		param := sig.Params().At(i)
+		arg := "arg" + strconv.Itoa(i)
+
+		paramType := typeCode(pkg, param.Type())
+		argCode := jen.Id(arg)
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			paramType = jen.Op("...").Add(typeCode(pkg, param.Type().(*types.Slice).Elem()))
+			argCode = jen.Id(arg).Op("...")
+		}
+
+		// variadic arguments are recorded as slices
+		callFields = append(callFields, jen.Id(m.CallFields[i]).Add(typeCode(pkg, param.Type())))
+		params = append(params, jen.Id(arg).Add(paramType))
+		args = append(args, argCode)
+		recorded[jen.Id(m.CallFields[i])] = jen.Id(arg)
+	}
+
+	results := make([]jen.Code, 0, sig.Results().Len())
+	for i := 0; i < sig.Results().Len(); i++ {
+		results = append(results, typeCode(pkg, sig.Results().At(i).Type()))
+	}
+
+	code.Commentf("%s records the arguments of a call of %s.%s.", m.CallType, mockName, m.Name())
+	code.Type().Id(m.CallType).Struct(callFields...)
+
+	body := []jen.Code{
+		jen.Id("m").Dot("mu").Dot("Lock").Call(),
+		jen.Id("m").Dot(m.calls).Op("=").Append(jen.Id("m").Dot(m.calls), jen.Id(m.CallType).Values(recorded)),
+	}
+
+	if m.ReturnsMethod == "" {
+		body = append(body,
+			jen.Id("fn").Op(":=").Id("m").Dot(m.FuncField),
+			jen.Id("m").Dot("mu").Dot("Unlock").Call(),
+			jen.Line(),
+			jen.If(jen.Id("fn").Op("!=").Nil()).Block(jen.Id("fn").Call(args...)),
+		)
+	} else {
+		returned := make([]jen.Code, 0, sig.Results().Len())
+		for i := 0; i < sig.Results().Len(); i++ {
+			returned = append(returned, jen.Id("returns").Dot("r"+strconv.Itoa(i)))
+		}
+
+		body = append(body,
+			jen.List(jen.Id("fn"), jen.Id("returns")).Op(":=").List(jen.Id("m").Dot(m.FuncField), jen.Id("m").Dot(m.returns)),
+			jen.Id("m").Dot("mu").Dot("Unlock").Call(),
+			jen.Line(),
+			jen.If(jen.Id("fn").Op("!=").Nil()).Block(jen.Return(jen.Id("fn").Call(args...))),
+			jen.Line(),
+			jen.Return(returned...),
+		)
+	}
+
+	code.Commentf("%s records the call, and calls %s if it's set.", m.Name(), m.FuncField)
+	code.Func().
+		Params(jen.Id("m").Op("*").Id(mockName)).
+		Id(m.Name()).
+		Params(params...).
+		Params(results...).
+		Block(body...)
+
+	code.Commentf("%s returns the recorded calls of %s.", m.CallsMethod, m.Name())
+	code.Func().
+		Params(jen.Id("m").Op("*").Id(mockName)).
+		Id(m.CallsMethod).
+		Params().
+		Index().Id(m.CallType).
+		Block(
+			jen.Id("m").Dot("mu").Dot("Lock").Call(),
+			jen.Defer().Id("m").Dot("mu").Dot("Unlock").Call(),
+			jen.Line(),
+			jen.Return(jen.Append(jen.Index().Id(m.CallType).Parens(jen.Nil()), jen.Id("m").Dot(m.calls).Op("..."))),
+		)
+
+	if m.ReturnsMethod == "" {
+		return
+	}
+
+	set := make([]jen.Code, 0, sig.Results().Len())
+	values := make([]jen.Code, 0, sig.Results().Len())
+	for i := 0; i < sig.Results().Len(); i++ {
+		set = append(set, jen.Id("m").Dot(m.returns).Dot("r"+strconv.Itoa(i)))
+		values = append(values, jen.Id("r"+strconv.Itoa(i)))
+	}
+
+	code.Commentf("%s sets the values returned by %s when %s isn't set.", m.ReturnsMethod, m.Name(), m.FuncField)
+	code.Func().
+		Params(jen.Id("m").Op("*").Id(mockName)).
+		Id(m.ReturnsMethod).
+		Params(mockResults(pkg, sig)...).
+		Block(
+			jen.Id("m").Dot("mu").Dot("Lock").Call(),
+			jen.Defer().Id("m").Dot("mu").Dot("Unlock").Call(),
+			jen.Line(),
+			jen.List(set...).Op("=").List(values...),
+		)
+}
+
+// mockResults returns the results of the given signature as named parameters or fields (r0, r1, ...).
+func mockResults(pkg *loader.Package, sig *types.Signature) []jen.Code {
+	results := make([]jen.Code, 0, sig.Results().Len())
+	for i := 0; i < sig.Results().Len(); i++ {
+		results = append(results, jen.Id("r"+strconv.Itoa(i)).Add(typeCode(pkg, sig.Results().At(i).Type())))
+	}
+
+	return results
+}
@@ -0,0 +1,229 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+var (
+	enableOptionsTypeMarker = markers.Must(markers.MakeDefinition("options:generate", markers.DescribesType, false))
+
+	defaultFieldMarker = markers.Must(markers.MakeDefinition("default", markers.DescribesField, markers.RawArguments(nil)))
+)
+
+func init() {
+	registerGenerator("options", OptionsGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// OptionsGenerator generates functional options constructors for structs.
+type OptionsGenerator struct{}
+
+func (OptionsGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableOptionsTypeMarker, defaultFieldMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableOptionsTypeMarker,
+		markers.SimpleHelp("object", "enables or disables functional options constructor generation for this type"),
+	)
+	into.AddHelp(
+		defaultFieldMarker,
+		markers.SimpleHelp("object", "sets the default value of this field, as a Go literal"),
+	)
+
+	return nil
+}
+
+func (OptionsGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableOptionsTypeMarker, "zz_generated.options.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		// option functions are package-level, so they must be unique across types
+		optionsFor := make(map[string][]string)
+		for _, s := range structs {
+			for i := 0; i < s.Struct.NumFields(); i++ {
+				if field := s.Struct.Field(i); field.Exported() {
+					optionsFor[optionFuncName(field)] = append(optionsFor[optionFuncName(field)], s.Info.Name)
+				}
+			}
+		}
+
+		for _, s := range structs {
+			generateOptions(code, root, s.Info, s.Struct, optionsFor)
+		}
+	})
+}
+
+// optionFuncName returns the name of the option function setting the given field.
+func optionFuncName(field *types.Var) string {
+	return "With" + field.Name()
+}
+
+// generateOptions generates the option type, the constructor and the option
+// functions of the given struct, the types generating each option function
+// are listed in optionsFor.
+//
+// Problems are reported on the fields, the options of types having any aren't generated.
+func generateOptions(code *jen.File, pkg *loader.Package, info *markers.TypeInfo, stype *types.Struct, optionsFor map[string][]string) {
+	optionName := info.Name + "Option"
+
+	var defaults []keyValue
+	// pointerDefaults allocate the values of pointer fields with defaults
+	var pointerDefaults []jen.Code
+	var options []jen.Code
+	failed := false
+
+	for i := 0; i < stype.NumFields(); i++ {
+		field := stype.Field(i)
+
+		if i < len(info.Fields) {
+			// the default values of pointer fields are the values they point to, like with the default generator
+			pointer, isPointer := field.Type().(*types.Pointer)
+			valueType := field.Type()
+			if isPointer {
+				valueType = pointer.Elem()
+			}
+
+			value, err := defaultValue(pkg, info.Fields[i], field, valueType)
+			switch {
+			case err != nil:
+				report(pkg, fieldNode(info, i), newDiagnostic(codeInvalidMarker, defaultFieldMarker, "", "%v", err))
+				failed = true
+			case value == nil:
+			case isPointer:
+				pointerDefaults = append(pointerDefaults,
+					jen.Id("o").Dot(field.Name()).Op("=").New(typeCode(pkg, valueType)),
+					jen.Op("*").Id("o").Dot(field.Name()).Op("=").Add(value),
+				)
+			default:
+				defaults = append(defaults, keyValue{Key: field.Name(), Value: value})
+			}
+		}
+
+		// unexported fields can only have defaults
+		if !field.Exported() {
+			continue
+		}
+
+		funcName := optionFuncName(field)
+		if owners := optionsFor[funcName]; len(owners) > 1 {
+			report(pkg, fieldNode(info, i), newDiagnostic(codeCollision, enableOptionsTypeMarker, "rename the field in all but one of them",
+				"option %s of field %s would be generated for each of %s", funcName, field.Name(), strings.Join(owners, ", ")))
+			failed = true
+
+			continue
+		}
+		if existing := pkg.Types.Scope().Lookup(funcName); existing != nil {
+			report(pkg, fieldNode(info, i), newDiagnostic(codeCollision, enableOptionsTypeMarker, "rename the field, or the existing declaration",
+				"option %s of field %s of %s collides with an existing declaration", funcName, field.Name(), info.Name))
+			failed = true
+
+			continue
+		}
+
+		options = append(options,
+			jen.Commentf("%s sets the %s field of %s.", funcName, field.Name(), info.Name).Line().
+				Func().
+				Id(funcName).
+				Params(jen.Id("value").Add(typeCode(pkg, field.Type()))).
+				Params(jen.Id(optionName)).
+				Block(jen.Return(jen.Func().Params(jen.Id("o").Op("*").Id(info.Name)).Block(
+					jen.Id("o").Dot(field.Name()).Op("=").Id("value"),
+				))),
+		)
+	}
+
+	if failed {
+		return
+	}
+
+	code.Commentf("%s configures a %s created by New%s.", optionName, info.Name, info.Name)
+	code.Type().Id(optionName).Func().Params(jen.Op("*").Id(info.Name))
+
+	body := append([]jen.Code{jen.Id("o").Op(":=").Op("&").Id(info.Name).Values(orderedDict(defaults)...)}, pointerDefaults...)
+	body = append(body,
+		jen.For(jen.List(jen.Id("_"), jen.Id("opt")).Op(":=").Range().Id("opts")).Block(
+			jen.Id("opt").Call(jen.Id("o")),
+		),
+		jen.Return(jen.Id("o")),
+	)
+
+	code.Commentf("New%s creates a new %s, applying the given options on top of the defaults.", info.Name, info.Name)
+	code.Func().
+		Id("New" + info.Name).
+		Params(jen.Id("opts").Op("...").Id(optionName)).
+		Params(jen.Op("*").Id(info.Name)).
+		Block(body...)
+
+	for _, option := range options {
+		code.Add(option)
+	}
+}
+
+// defaultValue returns the default value of the given field (or nil if it
+// doesn't have one), which has to be assignable to the given type.
+//
+// Default values are Go expressions evaluated in the scope of the package
+// (e.g. literals or constants of the package). time.Duration values can also
+// be duration strings (e.g. "30s"), converted like by the default generator.
+func defaultValue(pkg *loader.Package, info markers.FieldInfo, field *types.Var, t types.Type) (jen.Code, error) {
+	value := info.Markers.Get(defaultFieldMarker.Name)
+	if value == nil {
+		return nil, nil
+	}
+
+	literal := string(value.(markers.RawArguments))
+
+	if expr, err := parser.ParseExpr(literal); err == nil && isDuration(t) {
+		if lit, isLit := expr.(*ast.BasicLit); isLit && lit.Kind == token.STRING {
+			code, err := literalOfType(pkg, t, literal)
+			if err != nil {
+				return nil, fmt.Errorf("invalid default value %s of field %s: %w", literal, field.Name(), err)
+			}
+
+			return code, nil
+		}
+	}
+
+	result, err := types.Eval(pkg.Fset, pkg.Types, token.NoPos, literal)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default value %s of field %s: %w", literal, field.Name(), err)
+	}
+
+	if !types.AssignableTo(result.Type, t) {
+		return nil, fmt.Errorf("default value %s of field %s has type %s, which is not assignable to %s", literal, field.Name(), result.Type, t)
+	}
+
+	// untyped constants are assignable to any numeric type, but have to fit into integers
+	if basic, isBasic := t.Underlying().(*types.Basic); isBasic && basic.Info()&types.IsInteger != 0 && result.Value != nil {
+		if err := checkIntegerRange(basic, result.Value); err != nil {
+			return nil, fmt.Errorf("invalid default value %s of field %s: %w", literal, field.Name(), err)
+		}
+	}
+
+	return jen.Op(literal), nil
+}
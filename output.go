@@ -0,0 +1,77 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+// +controllertools:marker:generateHelp:category=""
+
+// OutputToBase outputs package-associated artifacts to the directory of their
+// import path under the given base directory (e.g. <base>/github.com/org/repo/pkg),
+// and other artifacts to the base directory itself.
+type OutputToBase string
+
+func (o OutputToBase) Open(pkg *loader.Package, itemPath string) (io.WriteCloser, error) {
+	outDir := string(o)
+	if pkg != nil {
+		outDir = filepath.Join(outDir, filepath.FromSlash(pkg.PkgPath))
+	}
+
+	// ensure the directory exists
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	return os.Create(filepath.Join(outDir, itemPath))
+}
+
+// outputDryRun lists the artifacts that would be written, without writing them.
+type outputDryRun struct {
+	out io.Writer
+}
+
+func (o outputDryRun) Open(pkg *loader.Package, itemPath string) (io.WriteCloser, error) {
+	if pkg != nil {
+		itemPath = pkg.PkgPath + ": " + itemPath
+	}
+
+	return &dryRunWriter{out: o.out, item: itemPath}, nil
+}
+
+// dryRunWriter counts the bytes of an artifact, reporting them when closed.
+type dryRunWriter struct {
+	out  io.Writer
+	item string
+	size int
+}
+
+func (w *dryRunWriter) Write(p []byte) (int, error) {
+	w.size += len(p)
+
+	return len(p), nil
+}
+
+func (w *dryRunWriter) Close() error {
+	_, err := fmt.Fprintf(w.out, "would write %s (%d bytes)\n", w.item, w.size)
+
+	return err
+}
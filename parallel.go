@@ -0,0 +1,101 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+// processRoots calls process for each root package using the given number of
+// workers (the number of CPUs if not positive).
+//
+// Each call gets a copy of the context buffering the files it outputs, which are
+// written in the order of the roots after all of them are processed, so that
+// outputs (e.g. to stdout) don't depend on scheduling. Errors may only be added
+// to the processed root.
+//
+// The type checker of the context isn't safe for concurrent use, so roots have
+// to be type-checked before calling this.
+func processRoots(ctx *genall.GenerationContext, workers int, process func(ctx *genall.GenerationContext, root *loader.Package)) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	// the roots checked up front are done, the time spent on each of them is added below
+	finishPackages()
+
+	outputs := make([]bufferedOutput, len(ctx.Roots))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				rootCtx := *ctx
+				rootCtx.OutputRule = &outputs[i]
+
+				start := time.Now()
+				process(&rootCtx, ctx.Roots[i])
+				addPackageDuration(ctx.Roots[i], time.Since(start))
+			}
+		}()
+	}
+
+	for i := range ctx.Roots {
+		indexes <- i
+	}
+	close(indexes)
+
+	wg.Wait()
+
+	for i, root := range ctx.Roots {
+		for _, file := range outputs[i].files {
+			writeOut(ctx, root, file.itemPath, file.Bytes())
+		}
+	}
+}
+
+// bufferedOutput collects the artifacts of a single package in memory.
+type bufferedOutput struct {
+	files []*bufferedFile
+}
+
+func (o *bufferedOutput) Open(_ *loader.Package, itemPath string) (io.WriteCloser, error) {
+	file := &bufferedFile{itemPath: itemPath}
+	o.files = append(o.files, file)
+
+	return file, nil
+}
+
+// bufferedFile is a buffered artifact.
+type bufferedFile struct {
+	bytes.Buffer
+
+	itemPath string
+}
+
+func (*bufferedFile) Close() error {
+	return nil
+}
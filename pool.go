@@ -0,0 +1,128 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+var (
+	enablePoolTypeMarker = markers.Must(markers.MakeDefinition("pool:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("pool", PoolGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// PoolGenerator generates code containing a sync.Pool for each marked struct,
+// with Get<Type> and Put<Type> functions taking values from and returning them
+// to it.
+//
+// Put<Type> resets the values before returning them to the pool, using their
+// Reset methods (e.g. generated by reset in the same run), or setting them to
+// the zero value if they have none.
+type PoolGenerator struct{}
+
+func (PoolGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enablePoolTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enablePoolTypeMarker,
+		markers.SimpleHelp("object", "enables or disables pool generation for this type"),
+	)
+
+	return nil
+}
+
+func (PoolGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enablePoolTypeMarker, "zz_generated.pool.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		// reset using Reset methods generated in the same run as well
+		resetGenerated, err := markedTypeNames(ctx.Collector, root, enableResetTypeMarker)
+		if err != nil {
+			root.AddError(err)
+
+			return
+		}
+
+		for _, s := range structs {
+			if err := generatePool(code, root, s, resetGenerated[s.Info.Name] || hasResetMethod(root, s.Type)); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+	})
+}
+
+// generatePool generates the pool of the given struct, and the functions using
+// it. The returned errors are diagnostics.
+func generatePool(code *jen.File, pkg *loader.Package, s markedStruct, hasReset bool) error {
+	poolVar, getFunc, putFunc := "pool"+s.Info.Name, "Get"+s.Info.Name, "Put"+s.Info.Name
+
+	for _, declaration := range []string{poolVar, getFunc, putFunc} {
+		if pkg.Types.Scope().Lookup(declaration) != nil {
+			return newDiagnostic(codeCollision, enablePoolTypeMarker, "rename it", "%s collides with an existing declaration in package %s", declaration, pkg.PkgPath)
+		}
+	}
+
+	reset := jen.Op("*").Id("o").Op("=").Id(s.Info.Name).Values()
+	if hasReset {
+		reset = jen.Id("o").Dot(resetMethod).Call()
+	}
+
+	code.Commentf("%s holds the %s values returned by %s for reuse.", poolVar, s.Info.Name, putFunc)
+	code.Var().Id(poolVar).Op("=").Qual("sync", "Pool").Values(jen.Dict{
+		jen.Id("New"): jen.Func().Params().Interface().Block(jen.Return(jen.New(jen.Id(s.Info.Name)))),
+	})
+
+	code.Commentf("%s returns a %s from the pool, allocating it if the pool is empty.", getFunc, s.Info.Name)
+	code.Func().
+		Id(getFunc).
+		Params().
+		Op("*").Id(s.Info.Name).
+		Block(jen.Return(jen.Id(poolVar).Dot("Get").Call().Assert(jen.Op("*").Id(s.Info.Name))))
+
+	code.Commentf("%s resets the given %s and returns it to the pool, it must not be used afterwards.", putFunc, s.Info.Name)
+	code.Func().
+		Id(putFunc).
+		Params(jen.Id("o").Op("*").Id(s.Info.Name)).
+		Block(
+			jen.If(jen.Id("o").Op("==").Nil()).Block(jen.Return()),
+			jen.Line(),
+			reset,
+			jen.Id(poolVar).Dot("Put").Call(jen.Id("o")),
+		)
+
+	return nil
+}
+
+// hasResetMethod checks if pointers to the given type have a Reset method (without parameters and results).
+func hasResetMethod(pkg *loader.Package, typeInfo types.Type) bool {
+	method, _, _ := types.LookupFieldOrMethod(typeInfo, true, pkg.Types, resetMethod)
+	if method == nil {
+		return false
+	}
+
+	sig, isFunc := method.Type().(*types.Signature)
+
+	return isFunc && sig.Params().Len() == 0 && sig.Results().Len() == 0
+}
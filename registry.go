@@ -0,0 +1,106 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// registerGenerator makes the given generator available on the command line
+// under the given name (e.g. to be used as <name>:<option>=<value>).
+//
+// Generators register themselves from init functions.
+func registerGenerator(name string, gen genall.Generator) {
+	if _, exists := allGenerators[name]; exists {
+		panic(fmt.Sprintf("generator %s is already registered", name))
+	}
+
+	allGenerators[name] = gen
+}
+
+// markedStruct is a struct type marked for generation.
+type markedStruct struct {
+	Info *markers.TypeInfo
+	// Type is the named type itself.
+	Type types.Type
+	// Struct is the underlying struct of the type.
+	Struct *types.Struct
+}
+
+// markedStructs collects the exported structs marked with the given marker in
+// the given package, reporting other kinds of marked types (and generic
+// structs) as errors.
+func markedStructs(ctx *genall.GenerationContext, root *loader.Package, enableMarker *markers.Definition) ([]markedStruct, error) {
+	infos, err := markedTypes(ctx, root, enableMarker)
+	if err != nil {
+		return nil, err
+	}
+
+	var structs []markedStruct
+
+	for _, info := range infos {
+		typeInfo := root.TypesInfo.TypeOf(info.RawSpec.Name)
+		if typeInfo == types.Typ[types.Invalid] {
+			report(root, info.RawSpec, newDiagnostic(codeUnknownType, nil, "fix the type errors of the package first", "unknown type %s", info.Name))
+
+			continue
+		}
+
+		stype, ok := typeInfo.Underlying().(*types.Struct)
+		if !ok {
+			report(root, info.RawSpec, newDiagnostic(codeUnsupportedType, enableMarker, "remove the marker", "%s is not a struct type", info.Name))
+
+			continue
+		}
+
+		if reportGeneric(root, info, typeInfo, enableMarker) {
+			continue
+		}
+
+		structs = append(structs, markedStruct{Info: info, Type: typeInfo, Struct: stype})
+	}
+
+	return structs, nil
+}
+
+// generateStructs renders the code generated for the marked structs of each
+// package into the given file, skipping packages without any.
+func generateStructs(ctx *genall.GenerationContext, enableMarker *markers.Definition, fileName string, generate func(code *jen.File, root *loader.Package, structs []markedStruct)) error {
+	for _, root := range ctx.Roots {
+		structs, err := markedStructs(ctx, root, enableMarker)
+		if err != nil {
+			root.AddError(err)
+			return nil
+		}
+
+		if len(structs) == 0 {
+			continue
+		}
+
+		code := jen.NewFile(root.Name)
+
+		generate(code, root, structs)
+
+		renderOut(ctx, root, code, fileName, "")
+	}
+
+	return nil
+}
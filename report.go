@@ -0,0 +1,451 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+// jsonReport is the only supported report format.
+const jsonReport = "json"
+
+// reportOptions configures the report written after a run (see --report).
+type reportOptions struct {
+	// Format is the report format, no report is written if empty.
+	Format string
+	// File is the file the report is written to, Stdout if empty.
+	File   string
+	Stdout io.Writer
+}
+
+// runStats collects what happens during a run for the report, it may be
+// updated by several workers at the same time.
+var runStats struct {
+	sync.Mutex
+
+	// generator is the name of the running generator.
+	generator string
+	// current is the package processed by the running generator (if it
+	// processes packages one after the other), since started.
+	current *loader.Package
+	started time.Time
+
+	packages map[string]*packageStats
+}
+
+// packageStats is what happened to a single package during a run.
+type packageStats struct {
+	matched   map[string]map[string]bool
+	files     []reportedFile
+	skipped   []reportedSkip
+	durations map[string]time.Duration
+}
+
+// statsFor returns the stats of the given package, runStats has to be locked.
+func statsFor(root *loader.Package) *packageStats {
+	if runStats.packages == nil {
+		runStats.packages = make(map[string]*packageStats)
+	}
+
+	stats, ok := runStats.packages[root.PkgPath]
+	if !ok {
+		stats = &packageStats{matched: make(map[string]map[string]bool), durations: make(map[string]time.Duration)}
+		runStats.packages[root.PkgPath] = stats
+	}
+
+	return stats
+}
+
+// startPackage records that the running generator started processing the
+// given package, finishing the previous one.
+func startPackage(root *loader.Package) {
+	runStats.Lock()
+	defer runStats.Unlock()
+
+	if runStats.current == root {
+		return
+	}
+
+	finishCurrentPackage()
+
+	runStats.current, runStats.started = root, time.Now()
+}
+
+// finishPackages records that the running generator finished processing the
+// packages it processes one after the other.
+func finishPackages() {
+	runStats.Lock()
+	defer runStats.Unlock()
+
+	finishCurrentPackage()
+}
+
+// finishCurrentPackage adds the time since the current package was started to
+// its duration, runStats has to be locked.
+func finishCurrentPackage() {
+	if runStats.current == nil {
+		return
+	}
+
+	statsFor(runStats.current).durations[runStats.generator] += time.Since(runStats.started)
+
+	runStats.current = nil
+}
+
+// addPackageDuration adds the given time spent by the running generator on the
+// given package (for packages processed in parallel).
+func addPackageDuration(root *loader.Package, d time.Duration) {
+	runStats.Lock()
+	defer runStats.Unlock()
+
+	statsFor(root).durations[runStats.generator] += d
+}
+
+// matchType records that the given marker enables generation for the type
+// with the given name in the given package.
+func matchType(root *loader.Package, marker string, typeName string) {
+	runStats.Lock()
+	defer runStats.Unlock()
+
+	stats := statsFor(root)
+	if stats.matched[marker] == nil {
+		stats.matched[marker] = make(map[string]bool)
+	}
+	stats.matched[marker][typeName] = true
+}
+
+// writtenFile records that the running generator output the given file for
+// the given package.
+func writtenFile(root *loader.Package, fileName string, size int) {
+	runStats.Lock()
+	defer runStats.Unlock()
+
+	stats := statsFor(root)
+	stats.files = append(stats.files, reportedFile{Generator: runStats.generator, Path: fileName, Bytes: size})
+}
+
+// skippedPackage records that the running generator skipped the given package
+// for the given reason, keeping its files as they are.
+func skippedPackage(root *loader.Package, reason string) {
+	runStats.Lock()
+	defer runStats.Unlock()
+
+	stats := statsFor(root)
+	stats.skipped = append(stats.skipped, reportedSkip{Generator: runStats.generator, Reason: reason})
+}
+
+// reportedGenerator is a generator whose run is recorded in runStats.
+type reportedGenerator struct {
+	genall.Generator
+
+	name string
+	// duration and err are the results of the last run.
+	duration time.Duration
+	err      error
+}
+
+func (g *reportedGenerator) Generate(ctx *genall.GenerationContext) error {
+	runStats.Lock()
+	runStats.generator = g.name
+	runStats.Unlock()
+
+	start := time.Now()
+	g.err = g.Generator.Generate(ctx)
+	g.duration = time.Since(start)
+
+	finishPackages()
+
+	return g.err
+}
+
+// generatorName returns the name the given generator is registered with.
+func generatorName(gen genall.Generator) string {
+	for name, registered := range allGenerators {
+		if reflect.TypeOf(registered) == reflect.TypeOf(gen) {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("%T", gen)
+}
+
+// runAndReport runs the generators of the given runtime like rt.Run, printing
+// warnings to the given output, then writes the report if configured.  It
+// reports whether there were any errors.
+//
+// The generators are replaced in place (keeping their per-generator output
+// rules), so the runtime can't be run again.
+func runAndReport(rt *genall.Runtime, out io.Writer, opts reportOptions) bool {
+	runStats.Lock()
+	runStats.generator, runStats.current, runStats.packages = "", nil, nil
+	runStats.Unlock()
+
+	generators := make([]*reportedGenerator, 0, len(rt.Generators))
+	for _, gen := range rt.Generators {
+		reported := &reportedGenerator{Generator: *gen, name: generatorName(*gen)}
+		generators = append(generators, reported)
+
+		*gen = reported
+	}
+
+	start := time.Now()
+	hadErrs := rt.Run()
+	if reportStaleFiles(rt, out) {
+		hadErrs = true
+	}
+	duration := time.Since(start)
+
+	diagnostics := takeDiagnostics()
+	printWarnings(out, diagnostics)
+
+	if opts.Format == "" {
+		return hadErrs
+	}
+
+	report := buildReport(rt, generators, diagnostics, duration, !hadErrs)
+	if err := writeReport(report, opts); err != nil {
+		fmt.Fprintf(out, "writing the report: %v\n", err)
+
+		return true
+	}
+
+	return hadErrs
+}
+
+// runReport is the summary of a run written by --report=json.
+type runReport struct {
+	// Success is false if the run failed (e.g. had errors).
+	Success    bool    `json:"success"`
+	DurationMS float64 `json:"durationMs"`
+
+	Generators []reportedGeneratorRun `json:"generators"`
+	// Packages are all the packages scanned, in the order they were loaded in.
+	Packages []reportedPackage `json:"packages"`
+	Totals   reportTotals      `json:"totals"`
+	// Diagnostics are all the problems found, including the ones without a
+	// diagnostic code (e.g. failing to write files).
+	Diagnostics []reportedDiagnostic `json:"diagnostics"`
+}
+
+// reportedGeneratorRun is the run of a single generator.
+type reportedGeneratorRun struct {
+	Name       string  `json:"name"`
+	DurationMS float64 `json:"durationMs"`
+	// Error is the error the generator failed with, as opposed to the
+	// errors of the packages it processed.
+	Error string `json:"error,omitempty"`
+}
+
+// reportedPackage is what happened to a single package.
+type reportedPackage struct {
+	Path string `json:"path"`
+	// MatchedTypes are the names of the types generation is enabled for, by marker.
+	MatchedTypes map[string][]string `json:"matchedTypes"`
+	Files        []reportedFile      `json:"files"`
+	Skipped      []reportedSkip      `json:"skipped"`
+	DurationMS   float64             `json:"durationMs"`
+	// DurationsMS is DurationMS by generator.
+	DurationsMS map[string]float64 `json:"durationsMs"`
+	Errors      int                `json:"errors"`
+	Warnings    int                `json:"warnings"`
+}
+
+// reportedFile is a file output for a package.
+type reportedFile struct {
+	Generator string `json:"generator"`
+	Path      string `json:"path"`
+	Bytes     int    `json:"bytes"`
+}
+
+// reportedSkip is a package left as it is by a generator.
+type reportedSkip struct {
+	Generator string `json:"generator"`
+	Reason    string `json:"reason"`
+}
+
+// reportTotals sums the packages of the report.
+type reportTotals struct {
+	Packages        int            `json:"packages"`
+	MatchedTypes    map[string]int `json:"matchedTypes"`
+	FilesWritten    int            `json:"filesWritten"`
+	PackagesSkipped int            `json:"packagesSkipped"`
+	// PackagesWithoutFiles are the packages with matched types that no files were written for.
+	PackagesWithoutFiles []string `json:"packagesWithoutFiles"`
+	Errors               int      `json:"errors"`
+	Warnings             int      `json:"warnings"`
+}
+
+// reportedDiagnostic is a problem found during the run.
+type reportedDiagnostic struct {
+	Package    string `json:"package,omitempty"`
+	Position   string `json:"position,omitempty"`
+	Severity   string `json:"severity"`
+	Code       string `json:"code,omitempty"`
+	Marker     string `json:"marker,omitempty"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// buildReport summarizes the finished run of the given runtime.
+func buildReport(rt *genall.Runtime, generators []*reportedGenerator, diagnostics []positionedDiagnostic, duration time.Duration, success bool) runReport {
+	report := runReport{
+		Success:     success,
+		DurationMS:  milliseconds(duration),
+		Generators:  make([]reportedGeneratorRun, 0, len(generators)),
+		Packages:    make([]reportedPackage, 0, len(rt.Roots)),
+		Totals:      reportTotals{MatchedTypes: map[string]int{}, PackagesWithoutFiles: []string{}},
+		Diagnostics: []reportedDiagnostic{},
+	}
+
+	for _, gen := range generators {
+		run := reportedGeneratorRun{Name: gen.name, DurationMS: milliseconds(gen.duration)}
+		if gen.err != nil {
+			run.Error = gen.err.Error()
+			report.Diagnostics = append(report.Diagnostics, reportedDiagnostic{Severity: "error", Message: fmt.Sprintf("%s: %v", gen.name, gen.err)})
+		}
+
+		report.Generators = append(report.Generators, run)
+	}
+
+	// errors reported as diagnostics are found among the package errors by
+	// position and message, so that they keep their details
+	byError := make(map[string]diagnostic)
+	for _, d := range diagnostics {
+		if !d.diagnostic.Warning || strictDiagnostics {
+			byError[d.position.String()+"\x00"+d.diagnostic.Error()] = d.diagnostic
+		}
+	}
+
+	runStats.Lock()
+	defer runStats.Unlock()
+
+	for _, root := range rt.Roots {
+		stats := statsFor(root)
+
+		pkg := reportedPackage{
+			Path:         root.PkgPath,
+			MatchedTypes: make(map[string][]string, len(stats.matched)),
+			Files:        append([]reportedFile{}, stats.files...),
+			Skipped:      append([]reportedSkip{}, stats.skipped...),
+			DurationsMS:  make(map[string]float64, len(stats.durations)),
+		}
+
+		for marker, names := range stats.matched {
+			pkg.MatchedTypes[marker] = sortedKeys(names)
+			report.Totals.MatchedTypes[marker] += len(names)
+		}
+
+		var total time.Duration
+		for generator, d := range stats.durations {
+			pkg.DurationsMS[generator] = milliseconds(d)
+			total += d
+		}
+		pkg.DurationMS = milliseconds(total)
+
+		// type errors are skipped like when printing them, they're probably just from partial type-checking
+		for _, err := range root.Errors {
+			if err.Kind == packages.TypeError {
+				continue
+			}
+
+			reported := reportedDiagnostic{Package: root.PkgPath, Position: err.Pos, Severity: "error", Message: err.Msg}
+			if d, ok := byError[err.Pos+"\x00"+err.Msg]; ok {
+				reported.Code, reported.Marker, reported.Message, reported.Suggestion = string(d.Code), d.Marker, d.Message, d.Suggestion
+			}
+
+			report.Diagnostics = append(report.Diagnostics, reported)
+			pkg.Errors++
+		}
+
+		report.Totals.FilesWritten += len(pkg.Files)
+		if len(pkg.Skipped) > 0 {
+			report.Totals.PackagesSkipped++
+		}
+		if len(pkg.MatchedTypes) > 0 && len(pkg.Files) == 0 && len(pkg.Skipped) == 0 {
+			report.Totals.PackagesWithoutFiles = append(report.Totals.PackagesWithoutFiles, pkg.Path)
+		}
+
+		report.Packages = append(report.Packages, pkg)
+	}
+
+	packageIndexes := make(map[string]int, len(report.Packages))
+	for i, pkg := range report.Packages {
+		packageIndexes[pkg.Path] = i
+	}
+
+	for _, d := range diagnostics {
+		if !d.diagnostic.Warning || strictDiagnostics {
+			continue
+		}
+
+		report.Diagnostics = append(report.Diagnostics, reportedDiagnostic{
+			Package:    d.pkg.PkgPath,
+			Position:   d.position.String(),
+			Severity:   "warning",
+			Code:       string(d.diagnostic.Code),
+			Marker:     d.diagnostic.Marker,
+			Message:    d.diagnostic.Message,
+			Suggestion: d.diagnostic.Suggestion,
+		})
+
+		if i, ok := packageIndexes[d.pkg.PkgPath]; ok {
+			report.Packages[i].Warnings++
+		}
+	}
+
+	for _, pkg := range report.Packages {
+		report.Totals.Errors += pkg.Errors
+		report.Totals.Warnings += pkg.Warnings
+	}
+	report.Totals.Packages = len(report.Packages)
+
+	return report
+}
+
+// writeReport writes the given report in the configured format.
+func writeReport(report runReport, opts reportOptions) error {
+	if opts.Format != jsonReport {
+		return fmt.Errorf("unsupported report format %q", opts.Format)
+	}
+
+	reportBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	reportBytes = append(reportBytes, '\n')
+
+	if opts.File == "" {
+		_, err := opts.Stdout.Write(reportBytes)
+
+		return err
+	}
+
+	return os.WriteFile(opts.File, reportBytes, 0644)
+}
+
+// milliseconds converts the given duration for the report.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
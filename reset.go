@@ -0,0 +1,126 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/types"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// resetMethod is the name of the generated method.
+const resetMethod = "Reset"
+
+var (
+	enableResetTypeMarker        = markers.Must(markers.MakeDefinition("reset:generate", markers.DescribesType, false))
+	keepCapacityResetFieldMarker = markers.Must(markers.MakeDefinition("reset:keepCapacity", markers.DescribesField, struct{}{}))
+)
+
+func init() {
+	registerGenerator("reset", ResetGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// ResetGenerator generates code containing Reset method implementations,
+// setting every field back to its zero value (e.g. before reusing the value
+// from a sync.Pool).
+//
+// Slice and map fields marked to keep their capacity are emptied instead:
+// their elements are cleared (so they don't hold on to other values), but
+// their backing arrays are kept for reuse.
+type ResetGenerator struct{}
+
+func (ResetGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableResetTypeMarker, keepCapacityResetFieldMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableResetTypeMarker,
+		markers.SimpleHelp("object", "enables or disables Reset implementation generation for this type"),
+	)
+	into.AddHelp(
+		keepCapacityResetFieldMarker,
+		markers.SimpleHelp("object", "empties this slice or map field instead of setting it to nil, keeping its capacity for reuse"),
+	)
+
+	return nil
+}
+
+func (ResetGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableResetTypeMarker, "zz_generated.reset.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		for _, s := range structs {
+			if err := generateReset(code, root, s); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+	})
+}
+
+// generateReset generates the Reset method of the given struct. The returned
+// errors are diagnostics.
+func generateReset(code *jen.File, pkg *loader.Package, s markedStruct) error {
+	if _, ind, _ := types.LookupFieldOrMethod(s.Type, true, pkg.Types, resetMethod); len(ind) == 1 {
+		return newDiagnostic(codeCollision, enableResetTypeMarker, "rename it", "%s collides with an existing field or method", resetMethod)
+	}
+
+	var body []jen.Code
+	var kept []string
+	values := jen.Dict{}
+
+	for i := 0; i < s.Struct.NumFields(); i++ {
+		field := s.Struct.Field(i)
+
+		if i >= len(s.Info.Fields) || s.Info.Fields[i].Markers.Get(keepCapacityResetFieldMarker.Name) == nil {
+			continue
+		}
+
+		value := jen.Id("o").Dot(field.Name())
+
+		// the elements are cleared up to the capacity, as the ones past the length are kept as well
+		switch field.Type().Underlying().(type) {
+		case *types.Slice:
+			body = append(body, jen.Id("clear").Call(value.Clone().Index(jen.Empty(), jen.Cap(value.Clone()))))
+			values[jen.Id(field.Name())] = value.Clone().Index(jen.Empty(), jen.Lit(0))
+		case *types.Map:
+			body = append(body, jen.Id("clear").Call(value.Clone()))
+			values[jen.Id(field.Name())] = value.Clone()
+		default:
+			return newDiagnostic(codeUnsupportedOption, keepCapacityResetFieldMarker, "remove the marker", "field %s: only slices and maps can keep their capacity", field.Name())
+		}
+
+		kept = append(kept, field.Name())
+	}
+
+	body = append(body, jen.Op("*").Id("o").Op("=").Id(s.Info.Name).Values(values))
+
+	if len(kept) > 0 {
+		code.Commentf("%s sets the fields of o to their zero values, emptying %s (keeping their capacity).", resetMethod, strings.Join(kept, ", "))
+	} else {
+		code.Commentf("%s sets the fields of o to their zero values.", resetMethod)
+	}
+	code.Func().
+		Params(jen.Id("o").Op("*").Id(s.Info.Name)).
+		Id(resetMethod).
+		Params().
+		Block(body...)
+
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// stringMethod is the name of the generated method.
+const stringMethod = "String"
+
+var (
+	enableStringerTypeMarker = markers.Must(markers.MakeDefinition("stringer:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("stringer", StringerGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// StringerGenerator generates code containing String method implementations.
+//
+// For integer and string types the constants of the type declared in the
+// same package are printed by name (like the stringer tool does), for
+// structs the fields are printed as name/value pairs.
+type StringerGenerator struct{}
+
+func (StringerGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableStringerTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableStringerTypeMarker,
+		markers.SimpleHelp("object", "enables or disables String implementation generation for this type"),
+	)
+
+	return nil
+}
+
+func (StringerGenerator) Generate(ctx *genall.GenerationContext) error {
+	for _, root := range ctx.Roots {
+		infos, err := markedTypes(ctx, root, enableStringerTypeMarker)
+		if err != nil {
+			root.AddError(err)
+			return nil
+		}
+
+		if len(infos) == 0 {
+			continue
+		}
+
+		code := jen.NewFile(root.Name)
+
+		for _, info := range infos {
+			typeInfo := root.TypesInfo.TypeOf(info.RawSpec.Name)
+			if typeInfo == types.Typ[types.Invalid] {
+				report(root, info.RawSpec, newDiagnostic(codeUnknownType, nil, "fix the type errors of the package first", "unknown type %s", info.Name))
+
+				continue
+			}
+
+			if reportGeneric(root, info, typeInfo, enableStringerTypeMarker) {
+				continue
+			}
+
+			if _, ind, _ := types.LookupFieldOrMethod(typeInfo, true, root.Types, stringMethod); len(ind) == 1 {
+				report(root, info.RawSpec, newDiagnostic(codeCollision, enableStringerTypeMarker, "remove the marker",
+					"%s already has a %s field or method", info.Name, stringMethod))
+
+				continue
+			}
+
+			var err error
+
+			switch underlying := typeInfo.Underlying().(type) {
+			case *types.Struct:
+				generateStructString(code, info.Name, underlying)
+
+			case *types.Basic:
+				err = generateEnumString(code, root, info.Name, typeInfo, underlying)
+
+			default:
+				err = newDiagnostic(codeUnsupportedType, enableStringerTypeMarker, "remove the marker",
+					"%s is neither a struct nor an integer or string type", info.Name)
+			}
+			if err != nil {
+				report(root, info.RawSpec, err.(diagnostic))
+			}
+		}
+
+		renderOut(ctx, root, code, "zz_generated.stringer.go", "")
+	}
+
+	return nil
+}
+
+// generateStructString generates the String method of the given struct, printing its fields.
+func generateStructString(code *jen.File, name string, stype *types.Struct) {
+	var format []string
+	args := []jen.Code{nil}
+
+	for i := 0; i < stype.NumFields(); i++ {
+		field := stype.Field(i)
+
+		if field.Name() == "_" {
+			continue
+		}
+
+		format = append(format, field.Name()+": %v")
+		args = append(args, jen.Id("o").Dot(field.Name()))
+	}
+
+	args[0] = jen.Lit(name + "{" + strings.Join(format, ", ") + "}")
+
+	code.Commentf("String returns the fields of o as name/value pairs.")
+	code.Func().
+		Params(jen.Id("o").Id(name)).
+		Id(stringMethod).
+		Params().
+		Params(jen.String()).
+		Block(jen.Return(jen.Qual("fmt", "Sprintf").Call(args...)))
+}
+
+// generateEnumString generates the String method of the given integer or string type,
+// printing the names of its constants. The returned errors are diagnostics.
+func generateEnumString(code *jen.File, pkg *loader.Package, name string, t types.Type, basic *types.Basic) error {
+	var fallback jen.Code
+
+	switch {
+	case basic.Info()&types.IsUnsigned != 0:
+		fallback = jen.Qual("fmt", "Sprintf").Call(jen.Lit(name+"(%d)"), jen.Uint64().Call(jen.Id("v")))
+	case basic.Info()&types.IsInteger != 0:
+		fallback = jen.Qual("fmt", "Sprintf").Call(jen.Lit(name+"(%d)"), jen.Int64().Call(jen.Id("v")))
+	case basic.Info()&types.IsString != 0:
+		fallback = jen.Qual("fmt", "Sprintf").Call(jen.Lit(name+"(%q)"), jen.String().Call(jen.Id("v")))
+	default:
+		return newDiagnostic(codeUnsupportedType, enableStringerTypeMarker, "remove the marker",
+			"%s is neither a struct nor an integer or string type", name)
+	}
+
+	consts := typeConstants(pkg, t)
+	if len(consts) == 0 {
+		return newDiagnostic(codeUnsupportedType, enableStringerTypeMarker, fmt.Sprintf("declare constants of type %s", name), "%s has no constants", name)
+	}
+
+	cases := make([]jen.Code, 0, len(consts))
+	for _, c := range consts {
+		cases = append(cases, jen.Case(jen.Id(c.Name())).Block(jen.Return(jen.Lit(c.Name()))))
+	}
+
+	code.Commentf("String returns the name of the %s constant v.", name)
+	code.Func().
+		Params(jen.Id("v").Id(name)).
+		Id(stringMethod).
+		Params().
+		Params(jen.String()).
+		Block(
+			jen.Switch(jen.Id("v")).Block(cases...),
+			jen.Return(fallback),
+		)
+
+	return nil
+}
+
+// typeConstants returns the constants of the given type declared in the
+// package, in the order of declaration.
+//
+// Aliases of a value are left out, the first name declared wins.
+func typeConstants(pkg *loader.Package, t types.Type) []*types.Const {
+	var consts []*types.Const
+
+	scope := pkg.Types.Scope()
+	for _, constName := range scope.Names() {
+		c, isConst := scope.Lookup(constName).(*types.Const)
+		if !isConst || c.Name() == "_" || !types.Identical(c.Type(), t) {
+			continue
+		}
+
+		consts = append(consts, c)
+	}
+
+	// keep the order of declaration, like the constants are listed in the source
+	sort.Slice(consts, func(i, j int) bool {
+		return consts[i].Pos() < consts[j].Pos()
+	})
+
+	unique := consts[:0]
+	seen := make(map[string]bool, len(consts))
+
+	for _, c := range consts {
+		value := c.Val().ExactString()
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+
+		unique = append(unique, c)
+	}
+
+	return unique
+}
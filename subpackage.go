@@ -0,0 +1,286 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+// checkSubPackage checks the sub-package directory (relative to the
+// directories of the packages) to generate code into, returning its name.
+func checkSubPackage(dir string) (string, error) {
+	if dir == "" || path.IsAbs(dir) || path.Clean(dir) != dir || strings.HasPrefix(dir, "..") {
+		return "", fmt.Errorf("invalid package %q: must be a relative slash-separated directory inside the package (e.g. generated)", dir)
+	}
+
+	name := path.Base(dir)
+	if !token.IsIdentifier(name) || name == "main" || strings.HasSuffix(name, "_test") {
+		return "", fmt.Errorf("invalid package %q: %s can't be used as a package name", dir, name)
+	}
+
+	return name, nil
+}
+
+// checkSubPackageCopy checks that the given type can be copied by a function
+// of another package. The returned errors are diagnostics.
+func checkSubPackageCopy(s copyStructs) error {
+	invalid := func(format string, args ...interface{}) error {
+		return newDiagnostic(codeUnsupportedOption, nil, "remove the marker, or generate methods in the package of the type", format, args...)
+	}
+
+	switch {
+	case s.Method == "" || s.Method != s.CopyMethod:
+		return invalid("%s declares a %s method, it can't be completed by a function in another package", s.StructName, s.CopyMethod)
+	case s.Fuzz || s.Tests:
+		return invalid("tests of %s can't be generated in another package", s.StructName)
+	case s.Implements != nil:
+		return invalid("%s can't be generated for %s in another package", implementsTypeMarker.Name, s.StructName)
+	case len(s.TypeParams) > 0:
+		return invalid("generic type %s can't be copied by a function in another package", s.StructName)
+	case len(s.DeepCopies) > 0:
+		return invalid("the fields of %s tagged %s:\"deep\" can't be copied in another package", s.StructName, copyTag)
+	}
+
+	for _, field := range s.Fields {
+		// copying field by field would silently lose these
+		if !ast.IsExported(field) {
+			return newDiagnostic(codeUnsupportedType, nil, fmt.Sprintf("skip it with +%s", skipFieldMarker.Name),
+				"%s has unexported field %s, it can't be copied outside of its package", s.StructName, field)
+		}
+	}
+
+	return nil
+}
+
+// generateSubPackageFiles generates standalone <Method><Type> functions (e.g.
+// ShallowCopyMyStruct) copying the given types of the package (and the given
+// external types) into the given file of its sub-package.
+func generateSubPackageFiles(ctx *genall.GenerationContext, root *loader.Package, dir, name string, structs []copyStructs, externals []externalCopy, fileName, headerText string) {
+	if len(structs) == 0 && len(externals) == 0 {
+		return
+	}
+
+	code := jen.NewFilePathName(root.PkgPath+"/"+dir, name)
+	code.ImportName(root.PkgPath, root.Name)
+
+	funcs := make(map[string]bool, len(structs)+len(externals))
+	declare := func(funcName string) bool {
+		if funcs[funcName] {
+			root.AddError(newDiagnostic(codeCollision, nil, "", "%s is generated for several types in package %s", funcName, dir))
+
+			return false
+		}
+		funcs[funcName] = true
+
+		return true
+	}
+
+	for _, s := range structs {
+		if declare(s.CopyMethod+s.StructName) && (s.IntoMethod == "" || declare(s.IntoMethod+s.StructName)) {
+			generateSubPackageCopy(code, root, s)
+		}
+	}
+	for _, external := range externals {
+		if declare(external.FuncName) {
+			generateExternalCopy(code, root, external)
+		}
+	}
+
+	renderOut(ctx, root, code, path.Join(dir, fileName), headerText)
+}
+
+// generateSubPackageCopy generates the standalone function copying the given
+// type of the package from its sub-package.
+func generateSubPackageCopy(code *jen.File, root *loader.Package, s copyStructs) {
+	if s.SchemaVersion != "" {
+		code.Const().Id(s.StructName + "SchemaVersion").Op("=").Lit(s.SchemaVersion)
+	}
+
+	funcName := s.CopyMethod + s.StructName
+	self := func() *jen.Statement {
+		return jen.Qual(root.PkgPath, s.StructName)
+	}
+
+	param, result := self(), self()
+	value := jen.Id("o")
+
+	var body []jen.Code
+
+	switch underlying := s.Underlying.(type) {
+	case nil:
+		fields := make([]keyValue, 0, len(s.Fields))
+		for _, field := range s.Fields {
+			fields = append(fields, keyValue{Key: field, Value: fieldValue(s, field)})
+		}
+
+		value = self().Values(orderedDict(fields)...)
+
+	case *types.Slice, *types.Map:
+		if !s.Elements {
+			break
+		}
+
+		fill := jen.Copy(jen.Id("c"), jen.Id("o"))
+		if _, isMap := underlying.(*types.Map); isMap {
+			fill = jen.For(jen.List(jen.Id("k"), jen.Id("v")).Op(":=").Range().Id("o")).Block(
+				jen.Id("c").Index(jen.Id("k")).Op("=").Id("v"),
+			)
+		}
+
+		body = append(body,
+			jen.If(jen.Id("o").Op("==").Nil()).Block(jen.Return(jen.Nil())),
+			jen.Id("c").Op(":=").Make(self(), jen.Len(jen.Id("o"))),
+			fill,
+		)
+		value = jen.Id("c")
+	}
+
+	if s.Pointer {
+		param, result = jen.Op("*").Add(param), jen.Op("*").Add(result)
+		value = jen.Op("&").Add(value)
+
+		nilResult := []jen.Code{jen.Nil()}
+		if s.ValidateAfter {
+			nilResult = append(nilResult, jen.Nil())
+		}
+
+		body = append([]jen.Code{jen.If(jen.Id("o").Op("==").Nil()).Block(jen.Return(nilResult...))}, body...)
+	}
+
+	code.Commentf("%s returns a shallow copy of o.", funcName)
+
+	if s.IntoMethod != "" {
+		defer generateSubPackageCopyInto(code, s, param, self)
+	}
+
+	if !s.ValidateAfter {
+		code.Func().
+			Id(funcName).
+			Params(jen.Id("o").Add(param)).
+			Params(result).
+			Block(append(body, jen.Return(value))...)
+
+		return
+	}
+
+	zero := self().Values()
+	if s.Pointer {
+		zero = jen.Nil()
+	}
+
+	body = append(body,
+		jen.Id("c").Op(":=").Add(value),
+		jen.If(jen.Err().Op(":=").Id("c").Dot("Validate").Call(), jen.Err().Op("!=").Nil()).Block(
+			jen.Return(zero, jen.Err()),
+		),
+		jen.Return(jen.Id("c"), jen.Nil()),
+	)
+
+	code.Func().
+		Id(funcName).
+		Params(jen.Id("o").Add(param)).
+		Params(result, jen.Error()).
+		Block(body...)
+}
+
+// generateSubPackageCopyInto generates the standalone function copying the
+// given struct of the package into a destination from its sub-package.
+func generateSubPackageCopyInto(code *jen.File, s copyStructs, param jen.Code, self func() *jen.Statement) {
+	funcName := s.IntoMethod + s.StructName
+
+	fields := make([]keyValue, 0, len(s.Fields))
+	for _, field := range s.Fields {
+		fields = append(fields, keyValue{Key: field, Value: fieldValue(s, field)})
+	}
+
+	var assignments []jen.Code
+	if s.Pointer {
+		assignments = append(assignments, nilIntoGuard(s, self))
+	}
+
+	// the whole destination is assigned, so that skipped fields end up zero like in the result of the copy
+	assignments = append(assignments, jen.Op("*").Id("out").Op("=").Add(self().Values(orderedDict(fields)...)))
+
+	code.Commentf("%s copies the fields of o into out.", funcName)
+
+	if !s.ValidateAfter {
+		code.Func().
+			Id(funcName).
+			Params(jen.Id("o").Add(param), jen.Id("out").Op("*").Add(self())).
+			Block(assignments...)
+
+		return
+	}
+
+	assignments = append(assignments, jen.Return(jen.Id("out").Dot("Validate").Call()))
+
+	code.Func().
+		Id(funcName).
+		Params(jen.Id("o").Add(param), jen.Id("out").Op("*").Add(self())).
+		Params(jen.Error()).
+		Block(assignments...)
+}
+
+// outputWithDirs creates the directories of the artifacts written to
+// subdirectories of their package (e.g. of a sub-package), which the output
+// rules writing to the disk don't create themselves.
+type outputWithDirs struct {
+	genall.OutputRule
+}
+
+func (o outputWithDirs) Open(pkg *loader.Package, itemPath string) (io.WriteCloser, error) {
+	if dir := filepath.Dir(filepath.FromSlash(itemPath)); pkg != nil && dir != "." {
+		if outDir := outputDir(o.OutputRule, pkg); outDir != "" {
+			if err := os.MkdirAll(filepath.Join(outDir, dir), os.ModePerm); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return o.OutputRule.Open(pkg, itemPath)
+}
+
+// outputDir returns the directory the given rule writes the artifacts of the
+// given package to, or "" if it doesn't write them to the disk.
+func outputDir(rule genall.OutputRule, pkg *loader.Package) string {
+	switch rule := rule.(type) {
+	case outputWithDirs:
+		return outputDir(rule.OutputRule, pkg)
+	case genall.OutputArtifacts:
+		if rule.Code != "" {
+			return string(rule.Code)
+		} else if len(pkg.CompiledGoFiles) > 0 {
+			return filepath.Dir(pkg.CompiledGoFiles[0])
+		}
+	case genall.OutputToDirectory:
+		return string(rule)
+	case OutputToBase:
+		return filepath.Join(string(rule), filepath.FromSlash(pkg.PkgPath))
+	}
+
+	return ""
+}
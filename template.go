@@ -0,0 +1,187 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+var (
+	enableTemplateTypeMarker = markers.Must(markers.MakeDefinition("template:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("template", TemplateGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// TemplateGenerator generates code for structs using a text/template file.
+//
+// The template is executed once for each package with marked structs, and has
+// to produce a complete Go file (starting with the package clause, which the
+// generated header is prepended to). It receives the package name as .Package,
+// its import path as .PkgPath, and the marked structs as .Types: each of them
+// has a .Name, .Doc, .Markers and .Fields, with every field having a .Name,
+// .Type (as written in the package), .Tag, .Embedded, .Exported, .Doc and .Markers.
+type TemplateGenerator struct {
+	// File specifies the template file.
+	File string
+	// OutputFile specifies the name of the generated file (zz_generated.template.go by default).
+	OutputFile string `marker:",optional"`
+}
+
+// templateData is what the template is executed with.
+type templateData struct {
+	Package string
+	PkgPath string
+	Types   []templateType
+}
+
+// templateType is a marked struct, as seen by the template.
+type templateType struct {
+	Name    string
+	Doc     string
+	Markers markers.MarkerValues
+	Fields  []templateField
+}
+
+// templateField is a field of a marked struct, as seen by the template.
+type templateField struct {
+	Name     string
+	Type     string
+	Tag      reflect.StructTag
+	Embedded bool
+	Exported bool
+	Doc      string
+	Markers  markers.MarkerValues
+}
+
+func (TemplateGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableTemplateTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableTemplateTypeMarker,
+		markers.SimpleHelp("object", "enables or disables template based generation for this type"),
+	)
+
+	return nil
+}
+
+func (g TemplateGenerator) Generate(ctx *genall.GenerationContext) error {
+	outputFile := g.OutputFile
+	if outputFile == "" {
+		outputFile = "zz_generated.template.go"
+	}
+
+	if filepath.Base(outputFile) != outputFile || filepath.Ext(outputFile) != ".go" {
+		return fmt.Errorf("invalid output file name %q: must be a Go file name without directories", outputFile)
+	}
+
+	templateBytes, err := ctx.ReadFile(g.File)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.New(filepath.Base(g.File)).Parse(string(templateBytes))
+	if err != nil {
+		return fmt.Errorf("invalid template %s: %w", g.File, err)
+	}
+
+	for _, root := range ctx.Roots {
+		structs, err := markedStructs(ctx, root, enableTemplateTypeMarker)
+		if err != nil {
+			root.AddError(err)
+			return nil
+		}
+
+		if len(structs) == 0 {
+			continue
+		}
+
+		data := templateData{
+			Package: root.Name,
+			PkgPath: root.PkgPath,
+			Types:   make([]templateType, 0, len(structs)),
+		}
+
+		// types of other packages are qualified by their name, like in the source
+		qualifier := func(pkg *types.Package) string {
+			if pkg == root.Types {
+				return ""
+			}
+
+			return pkg.Name()
+		}
+
+		for _, s := range structs {
+			tmplType := templateType{
+				Name:    s.Info.Name,
+				Doc:     s.Info.Doc,
+				Markers: s.Info.Markers,
+				Fields:  make([]templateField, 0, s.Struct.NumFields()),
+			}
+
+			for i := 0; i < s.Struct.NumFields(); i++ {
+				field := s.Struct.Field(i)
+
+				tmplField := templateField{
+					Name:     field.Name(),
+					Type:     types.TypeString(field.Type(), qualifier),
+					Tag:      reflect.StructTag(s.Struct.Tag(i)),
+					Embedded: field.Anonymous(),
+					Exported: field.Exported(),
+				}
+				if i < len(s.Info.Fields) {
+					tmplField.Doc = s.Info.Fields[i].Doc
+					tmplField.Markers = s.Info.Fields[i].Markers
+				}
+
+				tmplType.Fields = append(tmplType.Fields, tmplField)
+			}
+
+			data.Types = append(data.Types, tmplType)
+		}
+
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			root.AddError(newDiagnostic(codeTemplate, nil, "", "executing template %s: %v", g.File, err))
+
+			continue
+		}
+
+		if !strings.HasPrefix(strings.TrimSpace(b.String()), "package ") {
+			root.AddError(newDiagnostic(codeTemplate, nil, "start the template with the package clause (e.g. package {{.Package}})",
+				"template %s has to produce a Go file starting with the package clause", g.File))
+
+			continue
+		}
+
+		formatOut(ctx, root, b.Bytes(), outputFile, "")
+	}
+
+	return nil
+}
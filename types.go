@@ -0,0 +1,145 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+// typeCode renders the given type as code in the given package,
+// qualifying named types coming from other packages.
+func typeCode(pkg *loader.Package, t types.Type) *jen.Statement {
+	switch t := t.(type) {
+	case *types.Basic:
+		if t.Kind() == types.UnsafePointer {
+			return jen.Qual("unsafe", "Pointer")
+		}
+
+		return jen.Id(t.Name())
+
+	case *types.Named:
+		var code *jen.Statement
+
+		obj := t.Obj()
+		if obj.Pkg() == nil || obj.Pkg() == pkg.Types {
+			code = jen.Id(obj.Name())
+		} else {
+			code = jen.Qual(obj.Pkg().Path(), obj.Name())
+		}
+
+		if t.TypeArgs().Len() == 0 {
+			return code
+		}
+
+		args := make([]jen.Code, 0, t.TypeArgs().Len())
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			args = append(args, typeCode(pkg, t.TypeArgs().At(i)))
+		}
+
+		return code.Index(jen.List(args...))
+
+	case *types.TypeParam:
+		return jen.Id(t.Obj().Name())
+
+	case *types.Pointer:
+		return jen.Op("*").Add(typeCode(pkg, t.Elem()))
+
+	case *types.Slice:
+		return jen.Index().Add(typeCode(pkg, t.Elem()))
+
+	case *types.Array:
+		return jen.Index(jen.Lit(int(t.Len()))).Add(typeCode(pkg, t.Elem()))
+
+	case *types.Map:
+		return jen.Map(typeCode(pkg, t.Key())).Add(typeCode(pkg, t.Elem()))
+
+	case *types.Chan:
+		switch t.Dir() {
+		case types.SendOnly:
+			return jen.Chan().Op("<-").Add(typeCode(pkg, t.Elem()))
+		case types.RecvOnly:
+			return jen.Op("<-").Chan().Add(typeCode(pkg, t.Elem()))
+		default:
+			return jen.Chan().Add(typeCode(pkg, t.Elem()))
+		}
+
+	case *types.Signature:
+		return jen.Func().Add(signatureCode(pkg, t))
+
+	case *types.Struct:
+		fields := make([]jen.Code, 0, t.NumFields())
+		for i := 0; i < t.NumFields(); i++ {
+			field := t.Field(i)
+
+			var fieldCode *jen.Statement
+			if field.Anonymous() {
+				fieldCode = typeCode(pkg, field.Type())
+			} else {
+				fieldCode = jen.Id(field.Name()).Add(typeCode(pkg, field.Type()))
+			}
+
+			if tag := t.Tag(i); tag != "" {
+				fieldCode = fieldCode.Op("`" + tag + "`")
+			}
+
+			fields = append(fields, fieldCode)
+		}
+
+		return jen.Struct(fields...)
+
+	case *types.Interface:
+		methods := make([]jen.Code, 0, t.NumExplicitMethods()+t.NumEmbeddeds())
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			methods = append(methods, typeCode(pkg, t.EmbeddedType(i)))
+		}
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			method := t.ExplicitMethod(i)
+
+			methods = append(methods, jen.Id(method.Name()).Add(signatureCode(pkg, method.Type().(*types.Signature))))
+		}
+
+		return jen.Interface(methods...)
+
+	default:
+		return jen.Id(t.String())
+	}
+}
+
+// signatureCode renders the parameters and results of the given function signature.
+func signatureCode(pkg *loader.Package, sig *types.Signature) *jen.Statement {
+	params := make([]jen.Code, 0, sig.Params().Len())
+	for i := 0; i < sig.Params().Len(); i++ {
+		param := sig.Params().At(i)
+
+		paramType := typeCode(pkg, param.Type())
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			paramType = jen.Op("...").Add(typeCode(pkg, param.Type().(*types.Slice).Elem()))
+		}
+
+		params = append(params, jen.Id(param.Name()).Add(paramType))
+	}
+
+	results := make([]jen.Code, 0, sig.Results().Len())
+	for i := 0; i < sig.Results().Len(); i++ {
+		result := sig.Results().At(i)
+
+		results = append(results, jen.Id(result.Name()).Add(typeCode(pkg, result.Type())))
+	}
+
+	return jen.Params(params...).Params(results...)
+}
@@ -0,0 +1,281 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"regexp"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+// validateMethod is the name of the generated method.
+const validateMethod = "Validate"
+
+var (
+	enableValidateTypeMarker = markers.Must(markers.MakeDefinition("validate:generate", markers.DescribesType, false))
+
+	requiredValidateFieldMarker = markers.Must(markers.MakeDefinition("validate:required", markers.DescribesField, struct{}{}))
+	minValidateFieldMarker      = markers.Must(markers.MakeDefinition("validate:min", markers.DescribesField, markers.RawArguments(nil)))
+	maxValidateFieldMarker      = markers.Must(markers.MakeDefinition("validate:max", markers.DescribesField, markers.RawArguments(nil)))
+	minLenValidateFieldMarker   = markers.Must(markers.MakeDefinition("validate:minLen", markers.DescribesField, 0))
+	maxLenValidateFieldMarker   = markers.Must(markers.MakeDefinition("validate:maxLen", markers.DescribesField, 0))
+	patternValidateFieldMarker  = markers.Must(markers.MakeDefinition("validate:pattern", markers.DescribesField, ""))
+)
+
+func init() {
+	registerGenerator("validate", ValidateGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// ValidateGenerator generates code containing Validate method implementations,
+// checking the constraints set with validate field markers and returning all
+// the violations joined into a single error.
+//
+// Constraints on pointer fields apply to the values they point to (when they
+// aren't nil), and fields of types having a Validate method themselves (or
+// generated in the same run) are validated using it.
+type ValidateGenerator struct{}
+
+func (ValidateGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into,
+		enableValidateTypeMarker,
+		requiredValidateFieldMarker,
+		minValidateFieldMarker,
+		maxValidateFieldMarker,
+		minLenValidateFieldMarker,
+		maxLenValidateFieldMarker,
+		patternValidateFieldMarker,
+	); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableValidateTypeMarker,
+		markers.SimpleHelp("object", "enables or disables Validate implementation generation for this type"),
+	)
+	into.AddHelp(
+		requiredValidateFieldMarker,
+		markers.SimpleHelp("object", "requires this field to be non-zero (non-nil for pointers, slices and maps)"),
+	)
+	into.AddHelp(
+		minValidateFieldMarker,
+		markers.SimpleHelp("object", "sets the minimum of this numeric (or duration) field, as a Go literal"),
+	)
+	into.AddHelp(
+		maxValidateFieldMarker,
+		markers.SimpleHelp("object", "sets the maximum of this numeric (or duration) field, as a Go literal"),
+	)
+	into.AddHelp(
+		minLenValidateFieldMarker,
+		markers.SimpleHelp("object", "sets the minimum length of this string (in bytes), slice or map field"),
+	)
+	into.AddHelp(
+		maxLenValidateFieldMarker,
+		markers.SimpleHelp("object", "sets the maximum length of this string (in bytes), slice or map field"),
+	)
+	into.AddHelp(
+		patternValidateFieldMarker,
+		markers.SimpleHelp("object", "sets a regular expression this string field has to match"),
+	)
+
+	return nil
+}
+
+func (ValidateGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableValidateTypeMarker, "zz_generated.validate.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		generated := make(map[string]bool, len(structs))
+		for _, s := range structs {
+			generated[s.Info.Name] = true
+		}
+
+		for _, s := range structs {
+			if err := generateValidate(code, root, generated, s); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+	})
+}
+
+// generateValidate generates the Validate method of the given struct, and the
+// variables holding the compiled patterns of its fields. The returned errors
+// are diagnostics.
+func generateValidate(code *jen.File, pkg *loader.Package, generated map[string]bool, s markedStruct) error {
+	if _, ind, _ := types.LookupFieldOrMethod(s.Type, true, pkg.Types, validateMethod); len(ind) == 1 {
+		return newDiagnostic(codeCollision, enableValidateTypeMarker, "rename it", "%s collides with an existing field or method", validateMethod)
+	}
+
+	var patterns []jen.Code
+	body := []jen.Code{jen.Var().Id("errs").Index().Error()}
+
+	for i := 0; i < s.Struct.NumFields(); i++ {
+		field := s.Struct.Field(i)
+
+		var fieldMarkers markers.MarkerValues
+		if i < len(s.Info.Fields) {
+			fieldMarkers = s.Info.Fields[i].Markers
+		}
+
+		fieldValue := func() *jen.Statement { return jen.Id("o").Dot(field.Name()) }
+		violation := func(format string, args ...jen.Code) jen.Code {
+			if len(args) == 0 {
+				return jen.Id("errs").Op("=").Append(jen.Id("errs"), jen.Qual("errors", "New").Call(jen.Lit(field.Name()+" "+format)))
+			}
+
+			return jen.Id("errs").Op("=").Append(jen.Id("errs"), jen.Qual("fmt", "Errorf").Call(append([]jen.Code{jen.Lit(field.Name() + " " + format)}, args...)...))
+		}
+
+		if fieldMarkers.Get(requiredValidateFieldMarker.Name) != nil {
+			body = append(body, jen.If(zeroCheck(pkg, fieldValue(), field.Type(), true)).Block(violation("is required")))
+		}
+
+		// constraints apply to the values pointers point to
+		valueType := field.Type()
+		value := fieldValue
+		if pointer, isPointer := field.Type().(*types.Pointer); isPointer {
+			valueType = pointer.Elem()
+			value = func() *jen.Statement { return jen.Op("*").Add(fieldValue()) }
+		}
+
+		var checks []jen.Code
+
+		for _, bound := range []struct {
+			marker *markers.Definition
+			op     string
+			text   string
+		}{
+			{minValidateFieldMarker, "<", "must be at least"},
+			{maxValidateFieldMarker, ">", "must be at most"},
+		} {
+			literal, isSet := fieldMarkers.Get(bound.marker.Name).(markers.RawArguments)
+			if !isSet {
+				continue
+			}
+
+			if basic, isBasic := valueType.Underlying().(*types.Basic); !isBasic || basic.Info()&types.IsNumeric == 0 {
+				return newDiagnostic(codeUnsupportedOption, bound.marker, "remove the marker", "field %s is marked with %s, but it isn't numeric", field.Name(), bound.marker.Name)
+			}
+
+			limit, err := literalOfType(pkg, valueType, string(literal))
+			if err != nil {
+				return newDiagnostic(codeInvalidMarker, bound.marker, "", "invalid %s value %s of field %s: %v", bound.marker.Name, literal, field.Name(), err)
+			}
+
+			checks = append(checks, jen.If(value().Op(bound.op).Add(limit)).Block(violation(bound.text+" %v, got %v", limit, value())))
+		}
+
+		for _, bound := range []struct {
+			marker *markers.Definition
+			op     string
+			text   string
+		}{
+			{minLenValidateFieldMarker, "<", "must have a length of at least"},
+			{maxLenValidateFieldMarker, ">", "must have a length of at most"},
+		} {
+			length, isSet := fieldMarkers.Get(bound.marker.Name).(int)
+			if !isSet {
+				continue
+			}
+
+			if !hasLength(valueType) {
+				return newDiagnostic(codeUnsupportedOption, bound.marker, "remove the marker",
+					"field %s is marked with %s, but it isn't a string, slice or map", field.Name(), bound.marker.Name)
+			}
+
+			if length < 0 {
+				return newDiagnostic(codeInvalidMarker, bound.marker, "", "invalid %s value %d of field %s: lengths can't be negative", bound.marker.Name, length, field.Name())
+			}
+
+			checks = append(checks, jen.If(jen.Len(value()).Op(bound.op).Lit(length)).Block(violation(fmt.Sprintf("%s %d, got %%d", bound.text, length), jen.Len(value()))))
+		}
+
+		if pattern, isSet := fieldMarkers.Get(patternValidateFieldMarker.Name).(string); isSet {
+			if basic, isBasic := valueType.Underlying().(*types.Basic); !isBasic || basic.Info()&types.IsString == 0 {
+				return newDiagnostic(codeUnsupportedOption, patternValidateFieldMarker, "remove the marker",
+					"field %s is marked with %s, but it isn't a string", field.Name(), patternValidateFieldMarker.Name)
+			}
+
+			if _, err := regexp.Compile(pattern); err != nil {
+				return newDiagnostic(codeInvalidMarker, patternValidateFieldMarker, "", "invalid %s value of field %s: %v", patternValidateFieldMarker.Name, field.Name(), err)
+			}
+
+			// patterns are only compiled once, when the package is initialized
+			patternVar := "validate" + s.Info.Name + strings.ToUpper(field.Name()[:1]) + field.Name()[1:] + "Pattern"
+			if pkg.Types.Scope().Lookup(patternVar) != nil {
+				return newDiagnostic(codeCollision, patternValidateFieldMarker, "rename it", "%s of field %s collides with an existing declaration", patternVar, field.Name())
+			}
+
+			patterns = append(patterns, jen.Id(patternVar).Op("=").Qual("regexp", "MustCompile").Call(jen.Lit(pattern)))
+
+			matched := value()
+			if !types.Identical(valueType, types.Typ[types.String]) {
+				matched = jen.String().Call(matched)
+			}
+
+			checks = append(checks, jen.If(jen.Op("!").Id(patternVar).Dot("MatchString").Call(matched)).Block(
+				violation("must match %s, got %q", jen.Id(patternVar), value()),
+			))
+		}
+
+		if named, isNamed := valueType.(*types.Named); isNamed && ((named.Obj().Pkg() == pkg.Types && generated[named.Obj().Name()]) || hasValidateMethod(pkg, named)) {
+			// methods are called through the pointer, if any
+			checks = append(checks, jen.If(jen.Err().Op(":=").Add(fieldValue()).Dot(validateMethod).Call(), jen.Err().Op("!=").Nil()).Block(
+				violation("is invalid: %w", jen.Err()),
+			))
+		}
+
+		if len(checks) == 0 {
+			continue
+		}
+
+		if valueType != field.Type() {
+			body = append(body, jen.If(fieldValue().Op("!=").Nil()).Block(checks...))
+		} else {
+			body = append(body, checks...)
+		}
+	}
+
+	if len(patterns) > 0 {
+		code.Var().Defs(patterns...)
+	}
+
+	code.Commentf("%s checks the constraints on the fields of o, returning all the violations.", validateMethod)
+	code.Func().
+		Params(jen.Id("o").Id(s.Info.Name)).
+		Id(validateMethod).
+		Params().
+		Params(jen.Error()).
+		Block(append(body, jen.Return(jen.Qual("errors", "Join").Call(jen.Id("errs").Op("..."))))...)
+
+	return nil
+}
+
+// hasLength checks if len can be used on values of the given type.
+func hasLength(t types.Type) bool {
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic:
+		return underlying.Info()&types.IsString != 0
+	case *types.Slice, *types.Map:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package validated
+
+import "time"
+
+type Name string
+
+// +validate:generate=true
+type Tenant struct {
+	// +validate:required
+	// +validate:maxLen=8
+	// +validate:pattern=` + "`^[a-z][a-z0-9-]*$`" + `
+	Name Name
+	// +validate:min=1
+	// +validate:max=10
+	Replicas int
+	// +validate:min=0.1
+	Ratio *float64
+	// +validate:min="1s"
+	Timeout time.Duration
+	// +validate:minLen=1
+	Owners []string
+	// +validate:required
+	Quota *Quota
+	Limits Quota
+}
+
+// +validate:generate=true
+type Quota struct {
+	// +validate:max=1024
+	StorageGiB uint32
+}
+`,
+		"types_test.go": `package validated
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	valid := func() Tenant {
+		return Tenant{Name: "tenant", Replicas: 1, Timeout: time.Second, Owners: []string{"owner"}, Quota: &Quota{StorageGiB: 1024}}
+	}
+
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("Validate() of a valid value = %v", err)
+	}
+
+	ratio, lowRatio := 0.1, 0.05
+	for _, test := range []struct {
+		name   string
+		change func(o *Tenant)
+		want   string
+	}{
+		{name: "ratio at the limit", change: func(o *Tenant) { o.Ratio = &ratio }},
+		{name: "missing name", change: func(o *Tenant) { o.Name = "" }, want: "Name is required\nName must match ^[a-z][a-z0-9-]*$, got \"\""},
+		{name: "long name", change: func(o *Tenant) { o.Name = "tenant-name" }, want: "Name must have a length of at most 8, got 11"},
+		{name: "malformed name", change: func(o *Tenant) { o.Name = "Tenant" }, want: "Name must match ^[a-z][a-z0-9-]*$, got \"Tenant\""},
+		{name: "no replicas", change: func(o *Tenant) { o.Replicas = 0 }, want: "Replicas must be at least 1, got 0"},
+		{name: "too many replicas", change: func(o *Tenant) { o.Replicas = 11 }, want: "Replicas must be at most 10, got 11"},
+		{name: "low ratio", change: func(o *Tenant) { o.Ratio = &lowRatio }, want: "Ratio must be at least 0.1, got 0.05"},
+		{name: "short timeout", change: func(o *Tenant) { o.Timeout = time.Millisecond }, want: "Timeout must be at least 1s, got 1ms"},
+		{name: "no owners", change: func(o *Tenant) { o.Owners = nil }, want: "Owners must have a length of at least 1, got 0"},
+		{name: "missing quota", change: func(o *Tenant) { o.Quota = nil }, want: "Quota is required"},
+		{name: "invalid quota", change: func(o *Tenant) { o.Quota.StorageGiB = 1025 }, want: "Quota is invalid: StorageGiB must be at most 1024, got 1025"},
+		{name: "invalid limits", change: func(o *Tenant) { o.Limits.StorageGiB = 2048 }, want: "Limits is invalid: StorageGiB must be at most 1024, got 2048"},
+		{name: "all of them", change: func(o *Tenant) { o.Replicas, o.Owners = 0, nil }, want: "Replicas must be at least 1, got 0\nOwners must have a length of at least 1, got 0"},
+	} {
+		tenant := valid()
+		test.change(&tenant)
+
+		err := tenant.Validate()
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("%s: Validate() = %v, want no error", test.name, err)
+			}
+
+			continue
+		}
+
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: Validate() = %v, want %s", test.name, err, test.want)
+		}
+	}
+
+	// the violations of nested values are wrapped
+	tenant := valid()
+	tenant.Quota.StorageGiB = 1025
+	joined, _ := tenant.Validate().(interface{ Unwrap() []error })
+	if joined == nil || len(joined.Unwrap()) != 1 {
+		t.Fatalf("Validate() = %v, want the violations joined", joined)
+	}
+	if wrapped := errors.Unwrap(joined.Unwrap()[0]); wrapped == nil || wrapped.Error() != tenant.Quota.Validate().Error() {
+		t.Errorf("Validate() wraps %v, want the error of the quota", wrapped)
+	}
+}
+`,
+	}, "validate").succeeded(t).test(t)
+}
+
+func TestValidateUnsupportedMarker(t *testing.T) {
+	skipInShortMode(t)
+
+	generateTestPackage(t, map[string]string{
+		"types.go": `package validated
+
+// +validate:generate=true
+type Tenant struct {
+	// +validate:pattern=` + "`^[a-z]+$`" + `
+	Replicas int
+}
+`,
+	}, "validate").failedWith(t, "field Replicas is marked with validate:pattern, but it isn't a string")
+}
@@ -0,0 +1,337 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+)
+
+// diffContext is the number of unchanged lines shown around changes in diffs.
+const diffContext = 3
+
+// +controllertools:marker:generateHelp:category=""
+
+// OutputVerify compares artifacts with the existing ones instead of writing
+// them, printing a diff and failing if they're different (e.g. to check in
+// CI that generated code is up to date).
+//
+// Package-associated artifacts are compared to the ones in their package's
+// source files' directory, others to the ones in the Config directory.
+// Generated files in the directories of the packages that the run doesn't
+// generate anymore (e.g. after removing the markers of a package, or dropping
+// a generator) fail the verification as well.
+type OutputVerify struct {
+	// Config points to the directory containing configuration.
+	Config genall.OutputToDirectory `marker:",optional"`
+}
+
+func (o OutputVerify) Open(pkg *loader.Package, itemPath string) (io.WriteCloser, error) {
+	outDir := string(o.Config)
+
+	if pkg != nil {
+		if len(pkg.CompiledGoFiles) == 0 {
+			return nil, fmt.Errorf("cannot verify output of a package with no path on disk")
+		}
+		outDir = filepath.Dir(pkg.CompiledGoFiles[0])
+	}
+
+	path := filepath.Join(outDir, itemPath)
+
+	verifiedFiles.Lock()
+	if verifiedFiles.paths == nil {
+		verifiedFiles.paths = make(map[string]bool)
+	}
+	verifiedFiles.paths[path] = true
+	verifiedFiles.Unlock()
+
+	return &verifyWriter{path: path}, nil
+}
+
+// verifiedFiles collects the paths of the files verified by a run until it's
+// finished, they may be verified by several workers at the same time.
+var verifiedFiles struct {
+	sync.Mutex
+	paths map[string]bool
+}
+
+// verifiesAll checks if all the output of the given rules is verified.
+func verifiesAll(rules genall.OutputRules) bool {
+	if _, verifies := rules.Default.(OutputVerify); !verifies {
+		return false
+	}
+
+	for _, rule := range rules.ByGenerator {
+		if _, verifies := rule.(OutputVerify); !verifies {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reportStaleFiles adds an error to the given roots for each generated file in
+// their directory that the run didn't verify, printing them to the given output
+// as well. It reports whether there were any.
+//
+// It only checks runs verifying all their output, the files written by others
+// aren't tracked.
+func reportStaleFiles(rt *genall.Runtime, out io.Writer) bool {
+	verifiedFiles.Lock()
+	verified := verifiedFiles.paths
+	verifiedFiles.paths = nil
+	verifiedFiles.Unlock()
+
+	if !verifiesAll(rt.OutputRules) {
+		return false
+	}
+
+	stale := false
+	for _, root := range rt.Roots {
+		if len(root.CompiledGoFiles) == 0 {
+			continue
+		}
+
+		files, err := generatedFiles(filepath.Dir(root.CompiledGoFiles[0]))
+		if err != nil {
+			root.AddError(err)
+			stale = true
+
+			continue
+		}
+
+		for _, file := range files {
+			if verified[file] {
+				continue
+			}
+
+			err := fmt.Errorf("%s is stale: the generators don't generate it anymore (remove it)", file)
+			fmt.Fprintln(out, err)
+			root.AddError(err)
+			stale = true
+		}
+	}
+
+	return stale
+}
+
+// generatedFiles returns the paths of the Go files in the given directory
+// written by the generators, sorted by name.
+func generatedFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".go" {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		// the comment follows the build tags and the header, if any
+		if bytes.Contains(contents, []byte("\n"+generatedComment+"\n")) {
+			files = append(files, path)
+		}
+	}
+
+	return files, nil
+}
+
+// verifyWriter collects the generated contents of a file, comparing them with
+// the existing ones when closed.
+type verifyWriter struct {
+	bytes.Buffer
+
+	path string
+}
+
+func (w *verifyWriter) Close() error {
+	existing, err := os.ReadFile(w.path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s is missing", w.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(existing, w.Bytes()) {
+		return nil
+	}
+
+	writeDiff(os.Stderr, w.path, existing, w.Bytes())
+
+	return fmt.Errorf("%s is out of date", w.path)
+}
+
+// diffLine is a line of a diff, with its operation (' ', '-' or '+').
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// writeDiff writes a unified diff of the existing and generated contents of a file.
+func writeDiff(out io.Writer, path string, existing, generated []byte) {
+	lines := diffLines(splitLines(existing), splitLines(generated))
+
+	fmt.Fprintf(out, "--- %s\n+++ %s (generated)\n", path, path)
+
+	// the positions of the lines in the existing and generated files
+	existingPos, generatedPos := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, line := range lines {
+		existingPos[i+1], generatedPos[i+1] = existingPos[i], generatedPos[i]
+		if line.op != '+' {
+			existingPos[i+1]++
+		}
+		if line.op != '-' {
+			generatedPos[i+1]++
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+
+			continue
+		}
+
+		start, end := i-diffContext, i
+		if start < 0 {
+			start = 0
+		}
+
+		// merge changes separated by only a few unchanged lines into a single hunk
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+
+				continue
+			}
+
+			unchanged := end
+			for unchanged < len(lines) && lines[unchanged].op == ' ' {
+				unchanged++
+			}
+
+			if unchanged == len(lines) || unchanged-end > 2*diffContext {
+				end += diffContext
+				if end > len(lines) {
+					end = len(lines)
+				}
+
+				break
+			}
+
+			end = unchanged
+		}
+
+		fmt.Fprintf(out, "@@ -%s +%s @@\n",
+			hunkRange(existingPos[start], existingPos[end]),
+			hunkRange(generatedPos[start], generatedPos[end]),
+		)
+		for _, line := range lines[start:end] {
+			fmt.Fprintf(out, "%c%s\n", line.op, line.text)
+		}
+
+		i = end
+	}
+}
+
+// hunkRange formats the range of lines [from, to) of a hunk.
+func hunkRange(from, to int) string {
+	if from == to {
+		// empty ranges refer to the line before them
+		return fmt.Sprintf("%d,0", from)
+	}
+
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
+
+// splitLines splits the given contents into lines, without the line endings.
+func splitLines(contents []byte) []string {
+	if len(contents) == 0 {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+}
+
+// diffLines returns the lines of a minimal diff between a and b, based on
+// their longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	var prefix, suffix []diffLine
+
+	// most changes are small, so only compare what's between the common prefix and suffix
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, diffLine{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]diffLine{{' ', a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	lines := prefix
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	return append(lines, suffix...)
+}
@@ -0,0 +1,273 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/types"
+
+	"github.com/dave/jennifer/jen"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+	"sigs.k8s.io/controller-tools/pkg/loader"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+)
+
+const (
+	// walkMethod is the name of the generated method.
+	walkMethod = "Walk"
+	// walkPathFunc prefixes the paths passed to a walk function, generated once per package.
+	walkPathFunc = "walkPath"
+)
+
+var (
+	enableWalkTypeMarker = markers.Must(markers.MakeDefinition("walk:generate", markers.DescribesType, false))
+)
+
+func init() {
+	registerGenerator("walk", WalkGenerator{})
+}
+
+// +controllertools:marker:generateHelp
+
+// WalkGenerator generates code containing Walk method implementations,
+// calling a function with the path and the value of every field.
+//
+// The paths are dotted (e.g. Spec.Name), with the indices of slices and arrays
+// and the keys of maps in brackets (e.g. Pools[0].Labels[zone]). Fields of
+// types having a Walk method themselves (or generated in the same run) are
+// walked into, as well as their pointers, slices, arrays and maps. Map keys
+// are visited in sorted order if they're ordered, so the walk is repeatable.
+type WalkGenerator struct{}
+
+func (WalkGenerator) RegisterMarkers(into *markers.Registry) error {
+	if err := markers.RegisterAll(into, enableWalkTypeMarker); err != nil {
+		return err
+	}
+
+	into.AddHelp(
+		enableWalkTypeMarker,
+		markers.SimpleHelp("object", "enables or disables Walk implementation generation for this type"),
+	)
+
+	return nil
+}
+
+func (WalkGenerator) Generate(ctx *genall.GenerationContext) error {
+	return generateStructs(ctx, enableWalkTypeMarker, "zz_generated.walk.go", func(code *jen.File, root *loader.Package, structs []markedStruct) {
+		if root.Types.Scope().Lookup(walkPathFunc) != nil {
+			report(root, structs[0].Info.RawSpec, newDiagnostic(codeCollision, enableWalkTypeMarker, "rename it",
+				"%s collides with an existing declaration in package %s", walkPathFunc, root.PkgPath))
+
+			return
+		}
+
+		code.ImportName("slices", "slices")
+
+		walker := &fieldWalker{pkg: root, generated: make(map[string]bool, len(structs))}
+		for _, s := range structs {
+			walker.generated[s.Info.Name] = true
+		}
+
+		code.Commentf("%s returns a walk function calling fn with the paths prefixed by the given one.", walkPathFunc)
+		code.Func().
+			Id(walkPathFunc).
+			Params(jen.Id("prefix").String(), jen.Id("fn").Add(walkFuncType())).
+			Add(walkFuncType()).
+			Block(jen.Return(jen.Func().Params(jen.Id("path").String(), jen.Id("value").Interface()).Error().Block(
+				jen.Return(jen.Id("fn").Call(jen.Id("prefix").Op("+").Id("path"), jen.Id("value"))),
+			)))
+
+		for _, s := range structs {
+			if err := generateWalk(code, walker, s); err != nil {
+				reportOnType(root, s.Info, err)
+			}
+		}
+	})
+}
+
+// walkFuncType returns the type of the functions called by the Walk methods.
+func walkFuncType() *jen.Statement {
+	return jen.Func().Params(jen.Id("path").String(), jen.Id("value").Interface()).Error()
+}
+
+// generateWalk generates the Walk method of the given struct. The returned
+// errors are diagnostics.
+func generateWalk(code *jen.File, walker *fieldWalker, s markedStruct) error {
+	if _, ind, _ := types.LookupFieldOrMethod(s.Type, true, walker.pkg.Types, walkMethod); len(ind) == 1 {
+		return newDiagnostic(codeCollision, enableWalkTypeMarker, "rename it", "%s collides with an existing field or method", walkMethod)
+	}
+
+	var body []jen.Code
+
+	for i := 0; i < s.Struct.NumFields(); i++ {
+		field := s.Struct.Field(i)
+
+		if field.Name() == "_" {
+			continue
+		}
+
+		body = append(body, walker.visit(literalPath(field.Name()), jen.Id("o").Dot(field.Name()), field.Type(), 0)...)
+	}
+
+	body = append(body, jen.Return(jen.Nil()))
+
+	code.Commentf("%s calls fn with the path and the value of every field of o (walking into nested ones), stopping at the first error.", walkMethod)
+	code.Func().
+		Params(jen.Id("o").Id(s.Info.Name)).
+		Id(walkMethod).
+		Params(jen.Id("fn").Add(walkFuncType())).
+		Error().
+		Block(body...)
+
+	return nil
+}
+
+// fieldWalker emits the statements visiting values of a given type.
+type fieldWalker struct {
+	pkg *loader.Package
+	// generated are the names of the types Walk methods are generated for in this run.
+	generated map[string]bool
+}
+
+// walkPathExpr returns the expression of a path followed by the given suffix.
+type walkPathExpr func(suffix string) *jen.Statement
+
+// literalPath returns the given constant path.
+func literalPath(path string) walkPathExpr {
+	return func(suffix string) *jen.Statement { return jen.Lit(path + suffix) }
+}
+
+// variablePath returns the path stored in the given variable.
+func variablePath(name string) walkPathExpr {
+	return func(suffix string) *jen.Statement {
+		if suffix == "" {
+			return jen.Id(name)
+		}
+
+		return jen.Id(name).Op("+").Lit(suffix)
+	}
+}
+
+// visit returns the statements calling fn with the given path and value, then walking into it.
+func (w *fieldWalker) visit(path walkPathExpr, value *jen.Statement, t types.Type, depth int) []jen.Code {
+	return append([]jen.Code{
+		jen.If(jen.Err().Op(":=").Id("fn").Call(path(""), value.Clone()), jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Err())),
+	}, w.walkInto(path, value, t, depth)...)
+}
+
+// walkInto returns the statements visiting what the given value (at the given path) contains.
+//
+// The depth is the loop nesting level, used for naming loop variables.
+func (w *fieldWalker) walkInto(path walkPathExpr, value *jen.Statement, t types.Type, depth int) []jen.Code {
+	if w.hasWalk(t) {
+		return []jen.Code{
+			jen.If(
+				jen.Err().Op(":=").Add(value.Clone()).Dot(walkMethod).Call(jen.Id(walkPathFunc).Call(path("."), jen.Id("fn"))),
+				jen.Err().Op("!=").Nil(),
+			).Block(jen.Return(jen.Err())),
+		}
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		// methods are called on the pointer itself
+		pointee := jen.Parens(jen.Op("*").Add(value.Clone()))
+		if w.hasWalk(u.Elem()) {
+			pointee = value
+		}
+
+		elem := w.walkInto(path, pointee, u.Elem(), depth)
+		if len(elem) == 0 {
+			return nil
+		}
+
+		return []jen.Code{jen.If(value.Clone().Op("!=").Nil()).Block(elem...)}
+
+	case *types.Slice, *types.Array:
+		elemType := u.(interface{ Elem() types.Type }).Elem()
+		index, elem, elemPath := loopVar("i", depth), loopVar("elem", depth), loopVar("path", depth)
+
+		return []jen.Code{
+			jen.For(jen.List(jen.Id(index), jen.Id(elem)).Op(":=").Range().Add(value.Clone())).Block(append([]jen.Code{
+				jen.Id(elemPath).Op(":=").Add(path("[")).Op("+").Qual("strconv", "Itoa").Call(jen.Id(index)).Op("+").Lit("]"),
+			}, w.visit(variablePath(elemPath), jen.Id(elem), elemType, depth+1)...)...),
+		}
+
+	case *types.Map:
+		key, elemPath := loopVar("key", depth), loopVar("path", depth)
+
+		// string keys are written as they are, others as printed by fmt
+		keyString := jen.Qual("fmt", "Sprint").Call(jen.Id(key))
+		if basic, isBasic := u.Key().Underlying().(*types.Basic); isBasic && basic.Info()&types.IsString != 0 {
+			keyString = jen.String().Call(jen.Id(key))
+			if types.Identical(u.Key(), types.Typ[types.String]) {
+				keyString = jen.Id(key)
+			}
+		}
+
+		visitElem := append([]jen.Code{
+			jen.Id(elemPath).Op(":=").Add(path("[")).Op("+").Add(keyString).Op("+").Lit("]"),
+		}, w.visit(variablePath(elemPath), value.Clone().Index(jen.Id(key)), u.Elem(), depth+1)...)
+
+		basic, isBasic := u.Key().Underlying().(*types.Basic)
+		if !isBasic || basic.Info()&types.IsOrdered == 0 {
+			return []jen.Code{jen.For(jen.Id(key).Op(":=").Range().Add(value.Clone())).Block(visitElem...)}
+		}
+
+		// the sorted keys are scoped to the map, so they don't clash with the ones of other fields
+		keys := loopVar("keys", depth)
+
+		return []jen.Code{jen.If(jen.Len(value.Clone()).Op(">").Lit(0)).Block(
+			jen.Id(keys).Op(":=").Make(jen.Index().Add(typeCode(w.pkg, u.Key())), jen.Lit(0), jen.Len(value.Clone())),
+			jen.For(jen.Id(key).Op(":=").Range().Add(value.Clone())).Block(
+				jen.Id(keys).Op("=").Append(jen.Id(keys), jen.Id(key)),
+			),
+			jen.Qual("slices", "Sort").Call(jen.Id(keys)),
+			jen.For(jen.List(jen.Id("_"), jen.Id(key)).Op(":=").Range().Id(keys)).Block(visitElem...),
+		)}
+
+	default:
+		return nil
+	}
+}
+
+// hasWalk checks if the given type has a Walk method (or one generated in this run).
+func (w *fieldWalker) hasWalk(t types.Type) bool {
+	named, isNamed := t.(*types.Named)
+	if !isNamed {
+		return false
+	}
+
+	if named.Obj().Pkg() == w.pkg.Types && w.generated[named.Obj().Name()] {
+		return true
+	}
+
+	method, _, _ := types.LookupFieldOrMethod(named, false, w.pkg.Types, walkMethod)
+	fn, isFunc := method.(*types.Func)
+	if !isFunc {
+		return false
+	}
+
+	sig := fn.Type().(*types.Signature)
+	if sig.Params().Len() != 1 || sig.Results().Len() != 1 || !types.Identical(sig.Results().At(0).Type(), types.Universe.Lookup("error").Type()) {
+		return false
+	}
+
+	param, isFunc := sig.Params().At(0).Type().(*types.Signature)
+
+	return isFunc && param.Params().Len() == 2 && param.Results().Len() == 1 &&
+		types.Identical(param.Params().At(0).Type(), types.Typ[types.String]) &&
+		types.Identical(param.Params().At(1).Type(), types.NewInterfaceType(nil, nil)) &&
+		types.Identical(param.Results().At(0).Type(), types.Universe.Lookup("error").Type())
+}
@@ -0,0 +1,144 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"sigs.k8s.io/controller-tools/pkg/genall"
+)
+
+// watchSettleTime is how long to wait for further changes after a source file
+// changes, so that saving several files at once only triggers a single run.
+const watchSettleTime = 200 * time.Millisecond
+
+// generatedFile matches the comment marking generated Go files (see https://golang.org/s/generatedcode).
+var generatedFile = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+// watchAndRun runs the generators using the given function, then runs them
+// again (loading the packages again) whenever their source files change, until
+// interrupted.
+//
+// Generated files are excluded from the loaded ones by the ignore_autogenerated
+// build tag, so writing them doesn't trigger another run. Packages created
+// after starting aren't watched.
+func watchAndRun(out io.Writer, newRuntime func() (*genall.Runtime, error), run func(*genall.Runtime) bool) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	watchedDirs := make(map[string]bool)
+	var sources map[string]bool
+
+	for {
+		rt, err := newRuntime()
+		if err != nil {
+			// keep watching the packages loaded the last time (e.g. until a removed package is restored)
+			if sources == nil {
+				return err
+			}
+
+			fmt.Fprintf(out, "%v, waiting for changes\n", err)
+		} else {
+			hadErrs := run(rt)
+
+			if hadErrs {
+				fmt.Fprintln(out, "not all generators ran successfully, waiting for changes")
+			} else {
+				fmt.Fprintln(out, "generated code is up to date, waiting for changes")
+			}
+
+			sources = make(map[string]bool)
+			for _, root := range rt.Roots {
+				for _, file := range root.CompiledGoFiles {
+					sources[file] = true
+
+					if dir := filepath.Dir(file); !watchedDirs[dir] {
+						if err := watcher.Add(dir); err != nil {
+							return err
+						}
+						watchedDirs[dir] = true
+					}
+				}
+			}
+
+			if len(watchedDirs) == 0 {
+				return fmt.Errorf("no package directories to watch")
+			}
+		}
+
+		if err := waitForChanges(watcher, sources); err != nil {
+			return err
+		}
+	}
+}
+
+// waitForChanges blocks until a source file changes, then until changes settle.
+func waitForChanges(watcher *fsnotify.Watcher, sources map[string]bool) error {
+	for {
+		select {
+		case event := <-watcher.Events:
+			if !changesSource(event, sources) {
+				continue
+			}
+
+			settled := time.After(watchSettleTime)
+			for {
+				select {
+				case <-watcher.Events:
+				case err := <-watcher.Errors:
+					return err
+				case <-settled:
+					return nil
+				}
+			}
+		case err := <-watcher.Errors:
+			return err
+		}
+	}
+}
+
+// changesSource checks if the given event changes one of the given source files,
+// or creates a new (non-test) one in the directory of a package.
+func changesSource(event fsnotify.Event, sources map[string]bool) bool {
+	if event.Op == fsnotify.Chmod || filepath.Ext(event.Name) != ".go" {
+		return false
+	}
+
+	if sources[event.Name] {
+		return true
+	}
+
+	if strings.HasSuffix(event.Name, "_test.go") {
+		return false
+	}
+
+	// files that can't be read got removed again (or don't matter)
+	contents, err := os.ReadFile(event.Name)
+	if err != nil {
+		return false
+	}
+
+	return !generatedFile.Match(contents)
+}
@@ -1,3 +1,4 @@
+//go:build !ignore_autogenerated
 // +build !ignore_autogenerated
 
 // My header
@@ -10,6 +11,94 @@ import (
 	"sigs.k8s.io/controller-tools/pkg/markers"
 )
 
+func (AccessorsGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates getter and setter methods for struct fields.",
+			Details: "",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (BuilderGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates fluent builder types for structs.",
+			Details: "",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (ConvertGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing ConvertTo and ConvertFrom method implementations, converting structs to (and from) other versions of them (e.g. v1alpha1 and v1 API types) field by field. ",
+			Details: "Fields are matched by name, fields without a counterpart in the other type are errors (unless ignored). Values of identical types are assigned, other types are converted if their underlying types are identical, or using their ConvertTo and ConvertFrom methods (e.g. generated in the same run), and pointers, slices, maps and arrays of those are converted element by element.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (DeepCopyGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing DeepCopy and DeepCopyInto method implementations.",
+			Details: "",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (DefaultsGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing SetDefaults method implementations, assigning the default values set with +default markers to zero-valued fields. ",
+			Details: "Defaults can be set on fields of string, numeric and bool types (and pointers to them, which are only defaulted when nil), as literals of the field type. time.Duration fields also accept duration strings (e.g. \"30s\"). \n Fields of types having a SetDefaults method themselves (or generated in the same run) are defaulted using it.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (DiffGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing Diff method implementations, listing the fields that differ between two values (e.g. for audit logs). ",
+			Details: "Fields are compared like the equal generator does, and a FieldDiff type holding the name and the old and new values of a field is generated in each package.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (EnumGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code for integer and string types with constants declared in the same package, containing the IsValid, MarshalText and UnmarshalText methods, and the <Type>Values and Parse<Type> functions. ",
+			Details: "The text form of the constants of string types is their value, for integer types it's the name of the constant (the first one declared for aliases).",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (EqualGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing Equal method implementations. ",
+			Details: "Slices and maps are equal if they have the same length and equal elements (so nil and empty ones are equal), pointers are equal if they point to equal values, and types having an Equal method themselves (e.g. time.Time) are compared using it.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
 func (Generator) Help() *markers.DefinitionHelp {
 	return &markers.DefinitionHelp{
 		Category: "",
@@ -17,6 +106,207 @@ func (Generator) Help() *markers.DefinitionHelp {
 			Summary: "generates code containing ShallowCopy method implementations.",
 			Details: "",
 		},
+		FieldHelp: map[string]markers.DetailedHelp{
+			"OutputFile": markers.DetailedHelp{
+				Summary: "specifies the name of the generated file (zz_generated.shallowcopy.go by default). ",
+				Details: "Fuzz and unit tests are generated next to it, with a _test suffix.",
+			},
+			"SplitBySource": markers.DetailedHelp{
+				Summary: "specifies whether to generate a separate file for the types of each source file, adding the name of the source file to the output file name (e.g. zz_generated.shallowcopy.types.go for types.go).",
+				Details: "",
+			},
+			"HeaderFile": markers.DetailedHelp{
+				Summary: "specifies the header text (e.g. license) to prepend to generated files.",
+				Details: "",
+			},
+			"Year": markers.DetailedHelp{
+				Summary: "specifies the year to substitute for \" YEAR\" in the header file.",
+				Details: "",
+			},
+			"Config": markers.DetailedHelp{
+				Summary: "specifies a YAML file listing additional types to generate shallowcopy methods for, as if they were marked with shallowcopy:generate=true (e.g. for vendored packages that can't be modified). ",
+				Details: "The listed packages have to be loaded as well (using the paths option).",
+			},
+			"Package": markers.DetailedHelp{
+				Summary: "specifies a sub-package (e.g. generated) of each package to generate standalone ShallowCopy<Type> functions into, instead of methods next to the types. ",
+				Details: "The functions can only copy exported fields, and external types are copied in the sub-package as well.",
+			},
+			"Workers": markers.DetailedHelp{
+				Summary: "specifies the number of packages to process in parallel (the number of CPUs by default).",
+				Details: "",
+			},
+			"Cache": markers.DetailedHelp{
+				Summary: "specifies a file to store hashes of the inputs of each package in (its source files, the ones of the packages it imports and the options), skipping packages that haven't changed since their code was last generated successfully, unless some of the files generated for them are missing. ",
+				Details: "Skipped packages aren't output at all, so the cache is ignored unless the generated files are written to disk (e.g. it's ignored by dry runs and the verify output rule). Remove it to regenerate everything.",
+			},
+		},
+	}
+}
+
+func (HashGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing Hash method implementations, returning the FNV-1a hash of the fields in the order of declaration. ",
+			Details: "The hashes only depend on the values (not on the process or the platform), so they can be used as cache keys. Values equal according to the generated Equal methods have equal hashes: nil and empty slices and maps are hashed equally, pointers are hashed by the values they point to, and time.Time values by their instant. Types having a Hash method themselves (or generated in the same run) are hashed using it.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (ImmutableGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates read-only Immutable<Type> wrappers of structs, returned by their Immutable methods. ",
+			Details: "The wrappers have a getter named after each exported field, and With<Field> methods returning a modified copy (made by ShallowCopy, which has to be generated in the same run or declared). Slices and maps are copied when passed to or returned by them, so the wrapped values can't be modified through them, but the values they (and pointers) refer to are shared.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (MarshalGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing MarshalJSON and UnmarshalJSON method implementations, encoding and decoding structs without reflection, like encoding/json does (honoring json tags, omitempty and the fields of embedded structs). ",
+			Details: "Fields have to be of basic, pointer, slice, array or string keyed map types, of types implementing the json or encoding marshaler interfaces, or of types generated in the same run (by marshal, or enum for the text interfaces). The code reading JSON is written once per package, into a separate file.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (MergeGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing Merge method implementations, overlaying the non-zero fields of another value onto the receiver. ",
+			Details: "Pointers, slices and maps are zero when they're nil, and fields of types having a Merge method themselves (or generated in the same run) are merged using it.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (MockGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates fake implementations of interfaces for tests, named <Interface>Mock, recording the calls of their methods. ",
+			Details: "Each <Method> of the mock calls its <Method>Func field if it's set, and returns the values set by Set<Method>Returns otherwise (zero values by default). The recorded calls are returned by <Method>Calls, with the arguments of each call in a <Interface>Mock<Method>Call struct.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (OptionsGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates functional options constructors for structs.",
+			Details: "",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (OutputToBase) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "outputs package-associated artifacts to the directory of their import path under the given base directory (e.g. <base>/github.com/org/repo/pkg), and other artifacts to the base directory itself.",
+			Details: "",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (OutputVerify) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "compares artifacts with the existing ones instead of writing them, printing a diff and failing if they're different (e.g. to check in CI that generated code is up to date). ",
+			Details: "Package-associated artifacts are compared to the ones in their package's source files' directory, others to the ones in the Config directory. Generated files in the directories of the packages that the run doesn't generate anymore (e.g. after removing the markers of a package, or dropping a generator) fail the verification as well.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{
+			"Config": markers.DetailedHelp{
+				Summary: "points to the directory containing configuration.",
+				Details: "",
+			},
+		},
+	}
+}
+
+func (PoolGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing a sync.Pool for each marked struct, with Get<Type> and Put<Type> functions taking values from and returning them to it. ",
+			Details: "Put<Type> resets the values before returning them to the pool, using their Reset methods (e.g. generated by reset in the same run), or setting them to the zero value if they have none.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (ResetGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing Reset method implementations, setting every field back to its zero value (e.g. before reusing the value from a sync.Pool). ",
+			Details: "Slice and map fields marked to keep their capacity are emptied instead: their elements are cleared (so they don't hold on to other values), but their backing arrays are kept for reuse.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (StringerGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing String method implementations. ",
+			Details: "For integer and string types the constants of the type declared in the same package are printed by name (like the stringer tool does), for structs the fields are printed as name/value pairs.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (TemplateGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code for structs using a text/template file. ",
+			Details: "The template is executed once for each package with marked structs, and has to produce a complete Go file (starting with the package clause, which the generated header is prepended to). It receives the package name as .Package, its import path as .PkgPath, and the marked structs as .Types: each of them has a .Name, .Doc, .Markers and .Fields, with every field having a .Name, .Type (as written in the package), .Tag, .Embedded, .Exported, .Doc and .Markers.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{
+			"File": markers.DetailedHelp{
+				Summary: "specifies the template file.",
+				Details: "",
+			},
+			"OutputFile": markers.DetailedHelp{
+				Summary: "specifies the name of the generated file (zz_generated.template.go by default).",
+				Details: "",
+			},
+		},
+	}
+}
+
+func (ValidateGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing Validate method implementations, checking the constraints set with validate field markers and returning all the violations joined into a single error. ",
+			Details: "Constraints on pointer fields apply to the values they point to (when they aren't nil), and fields of types having a Validate method themselves (or generated in the same run) are validated using it.",
+		},
+		FieldHelp: map[string]markers.DetailedHelp{},
+	}
+}
+
+func (WalkGenerator) Help() *markers.DefinitionHelp {
+	return &markers.DefinitionHelp{
+		Category: "",
+		DetailedHelp: markers.DetailedHelp{
+			Summary: "generates code containing Walk method implementations, calling a function with the path and the value of every field. ",
+			Details: "The paths are dotted (e.g. Spec.Name), with the indices of slices and arrays and the keys of maps in brackets (e.g. Pools[0].Labels[zone]). Fields of types having a Walk method themselves (or generated in the same run) are walked into, as well as their pointers, slices, arrays and maps. Map keys are visited in sorted order if they're ordered, so the walk is repeatable.",
+		},
 		FieldHelp: map[string]markers.DetailedHelp{},
 	}
 }